@@ -0,0 +1,367 @@
+package shapefile
+
+import (
+	"errors"
+	"github.com/jonas-p/go-shp"
+	"math"
+)
+
+// Strategies for handling POLYLINE and POLYGON shapes with edges that cross
+// the antimeridian (edges whose longitudes differ by more than 180 degrees).
+// "split" cuts the shape at the antimeridian so that there are parts on
+// either side of it. "normalize" shifts negative longitudes by 360 degrees
+// so that the shape is continuous in a 0 to 360 range. "none" leaves the
+// shape as-is which means it will wrap around the entire globe.
+
+const (
+	ANTIMERIDIAN_SPLIT     = "split"
+	ANTIMERIDIAN_NORMALIZE = "normalize"
+	ANTIMERIDIAN_NONE      = "none"
+)
+
+func AntimeridianStrategies() []string {
+
+	return []string{
+		ANTIMERIDIAN_NONE,
+		ANTIMERIDIAN_NORMALIZE,
+		ANTIMERIDIAN_SPLIT,
+	}
+}
+
+func IsValidAntimeridianStrategy(test string) bool {
+
+	valid := false
+
+	for _, strategy := range AntimeridianStrategies() {
+
+		if strategy == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// AntimeridianShape returns a copy of s (whose coordinates are WGS84
+// longitudes and latitudes) with any edges that cross the antimeridian
+// handled according to strategy along with a boolean flag indicating whether
+// any such edges were found. Polygon rings that encircle a pole can not be
+// split or normalized and are left untouched.
+
+func AntimeridianShape(s shp.Shape, strategy string) (shp.Shape, bool, error) {
+
+	if strategy == ANTIMERIDIAN_NONE {
+		return s, false, nil
+	}
+
+	if !IsValidAntimeridianStrategy(strategy) {
+		return nil, false, errors.New("Invalid antimeridian strategy")
+	}
+
+	switch shape := s.(type) {
+
+	case *shp.Point, *shp.MultiPoint:
+		return s, false, nil
+
+	case *shp.PolyLine:
+
+		lines := shapeParts(shape.Parts, shape.Points)
+
+		if !partsCrossAntimeridian(lines) {
+			return s, false, nil
+		}
+
+		parts := make([][]shp.Point, 0)
+
+		for _, line := range lines {
+
+			if strategy == ANTIMERIDIAN_NORMALIZE {
+				parts = append(parts, normalizeLongitudes(line))
+				continue
+			}
+
+			parts = append(parts, splitLineAtAntimeridian(line)...)
+		}
+
+		return shp.NewPolyLine(parts), true, nil
+
+	case *shp.Polygon:
+
+		all_rings := shapeParts(shape.Parts, shape.Points)
+
+		if !partsCrossAntimeridian(all_rings) {
+			return s, false, nil
+		}
+
+		rings := make([][]shp.Point, 0)
+
+		// normalizing applies to every part of the shape so that the
+		// parts that don't cross the antimeridian are in the same range
+		// as those that do
+
+		for _, poly := range groupRings(all_rings) {
+
+			if strategy != ANTIMERIDIAN_NORMALIZE && !partsCrossAntimeridian(poly) {
+				rings = append(rings, poly...)
+				continue
+			}
+
+			var polys [][][]shp.Point
+			var err error
+
+			if strategy == ANTIMERIDIAN_NORMALIZE {
+				polys = normalizePolygon(poly)
+			} else {
+				polys, err = splitPolygonAtAntimeridian(poly)
+			}
+
+			if err != nil {
+				return nil, true, err
+			}
+
+			for _, p := range polys {
+
+				rings = append(rings, orientRing(p[0], true))
+
+				for _, hole := range p[1:] {
+					rings = append(rings, orientRing(hole, false))
+				}
+			}
+		}
+
+		if len(rings) == 0 {
+			return nil, true, errors.New("Polygon has no rings after splitting at the antimeridian")
+		}
+
+		return newPolygon(rings), true, nil
+
+	default:
+		return nil, false, errors.New("Unsupported shape type")
+	}
+}
+
+func partsCrossAntimeridian(parts [][]shp.Point) bool {
+
+	for _, pts := range parts {
+
+		for i := 1; i < len(pts); i++ {
+
+			if math.Abs(pts[i].X-pts[i-1].X) > 180.0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// unwrapLongitudes returns a copy of pts where each longitude is shifted by
+// a multiple of 360 degrees so that no edge is longer than 180 degrees. The
+// result may contain longitudes outside of the -180 to 180 range.
+
+func unwrapLongitudes(pts []shp.Point) []shp.Point {
+
+	unwrapped := make([]shp.Point, len(pts))
+
+	for i, pt := range pts {
+
+		if i > 0 {
+
+			prev := unwrapped[i-1].X
+
+			for pt.X-prev > 180.0 {
+				pt.X -= 360.0
+			}
+
+			for pt.X-prev < -180.0 {
+				pt.X += 360.0
+			}
+		}
+
+		unwrapped[i] = pt
+	}
+
+	return unwrapped
+}
+
+func normalizeLongitudes(pts []shp.Point) []shp.Point {
+
+	normalized := make([]shp.Point, len(pts))
+
+	for i, pt := range pts {
+
+		if pt.X < 0.0 {
+			pt.X += 360.0
+		}
+
+		normalized[i] = pt
+	}
+
+	return normalized
+}
+
+func normalizePolygon(poly [][]shp.Point) [][][]shp.Point {
+
+	normalized := make([][]shp.Point, len(poly))
+
+	for i, ring := range poly {
+
+		if isPolarRing(ring) {
+			return [][][]shp.Point{poly}
+		}
+
+		normalized[i] = normalizeLongitudes(ring)
+	}
+
+	return [][][]shp.Point{normalized}
+}
+
+// isPolarRing returns true if ring encircles a pole, which is to say that it
+// does not close once its longitudes have been unwrapped.
+
+func isPolarRing(ring []shp.Point) bool {
+
+	unwrapped := unwrapLongitudes(ring)
+	count := len(unwrapped)
+
+	return math.Abs(unwrapped[count-1].X-unwrapped[0].X) > 1e-9
+}
+
+// splitLineAtAntimeridian splits line in to parts that end (and start) at
+// the antimeridian whenever one of its edges crosses it.
+
+func splitLineAtAntimeridian(line []shp.Point) [][]shp.Point {
+
+	parts := make([][]shp.Point, 0)
+
+	if len(line) == 0 {
+		return parts
+	}
+
+	current := []shp.Point{line[0]}
+
+	for i := 1; i < len(line); i++ {
+
+		a := line[i-1]
+		b := line[i]
+
+		dx := b.X - a.X
+
+		if math.Abs(dx) <= 180.0 {
+			current = append(current, b)
+			continue
+		}
+
+		// the meridian (180 or -180) the edge leaves through and the
+		// unwrapped longitude of b relative to a
+
+		exit := 180.0
+		unwrapped_x := b.X + 360.0
+
+		if dx > 0.0 {
+			exit = -180.0
+			unwrapped_x = b.X - 360.0
+		}
+
+		t := (exit - a.X) / (unwrapped_x - a.X)
+		y := a.Y + t*(b.Y-a.Y)
+
+		current = append(current, shp.Point{X: exit, Y: y})
+		parts = append(parts, current)
+
+		current = []shp.Point{shp.Point{X: -exit, Y: y}, b}
+	}
+
+	parts = append(parts, current)
+
+	lines := make([][]shp.Point, 0)
+
+	for _, part := range parts {
+
+		part = dedupePoints(part)
+
+		if len(part) >= 2 {
+			lines = append(lines, part)
+		}
+	}
+
+	return lines
+}
+
+// splitPolygonAtAntimeridian unwraps poly (an outer ring followed by zero or
+// more holes) and then clips it against each 360 degree wide "world" that
+// it overlaps, shifting the pieces back in to the -180 to 180 range.
+
+func splitPolygonAtAntimeridian(poly [][]shp.Point) ([][][]shp.Point, error) {
+
+	unwrapped := make([][]shp.Point, len(poly))
+
+	for i, ring := range poly {
+
+		if isPolarRing(ring) {
+			return [][][]shp.Point{poly}, nil
+		}
+
+		unwrapped[i] = unwrapLongitudes(ring)
+	}
+
+	// make sure the holes are in the same "world" as the shell
+
+	shell_box := shp.BBoxFromPoints(unwrapped[0])
+	center := (shell_box.MinX + shell_box.MaxX) / 2.0
+
+	for _, hole := range unwrapped[1:] {
+
+		offset := math.Round((center-hole[0].X)/360.0) * 360.0
+
+		for j := range hole {
+			hole[j].X += offset
+		}
+	}
+
+	first := int(math.Floor((shell_box.MinX + 180.0) / 360.0))
+	last := int(math.Floor((shell_box.MaxX + 180.0) / 360.0))
+
+	polys := make([][][]shp.Point, 0)
+
+	for world := first; world <= last; world++ {
+
+		offset := float64(world) * 360.0
+
+		// latitudes are irrelevant so make the box tall enough that
+		// its top and bottom edges never touch the polygon
+
+		box := []shp.Point{
+			shp.Point{X: offset - 180.0, Y: -1000.0},
+			shp.Point{X: offset - 180.0, Y: 1000.0},
+			shp.Point{X: offset + 180.0, Y: 1000.0},
+			shp.Point{X: offset + 180.0, Y: -1000.0},
+			shp.Point{X: offset - 180.0, Y: -1000.0},
+		}
+
+		pieces, _, err := clipPolygon(unwrapped, [][]shp.Point{box})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, piece := range pieces {
+
+			shifted := make([][]shp.Point, len(piece))
+
+			for i, ring := range piece {
+
+				shifted[i] = make([]shp.Point, len(ring))
+
+				for j, pt := range ring {
+					shifted[i][j] = shp.Point{X: pt.X - offset, Y: pt.Y}
+				}
+			}
+
+			polys = append(polys, shifted)
+		}
+	}
+
+	return polys, nil
+}
@@ -0,0 +1,255 @@
+package shapefile
+
+import (
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// antimeridianTests are polygons that cross the antimeridian along with their
+// area and bounding box once they have been split or normalized.
+
+var antimeridianTests = []struct {
+	label     string
+	rings     [][]shp.Point
+	area      float64
+	parts     int
+	split     shp.Box
+	normalize shp.Box
+}{
+	{
+		label:     "crosses",
+		rings:     [][]shp.Point{testRing(178, -17, 178, -16, -179, -16, -179, -17, 178, -17)},
+		area:      3.0,
+		parts:     2,
+		split:     shp.Box{MinX: -180, MinY: -17, MaxX: 180, MaxY: -16},
+		normalize: shp.Box{MinX: 178, MinY: -17, MaxX: 181, MaxY: -16},
+	},
+	{
+		label:     "crosses with hole",
+		rings:     [][]shp.Point{testRing(170, -20, 170, -10, -170, -10, -170, -20, 170, -20), testRing(175, -16, 175, -14, -175, -14, -175, -16, 175, -16)},
+		area:      200.0 - 20.0,
+		parts:     2,
+		split:     shp.Box{MinX: -180, MinY: -20, MaxX: 180, MaxY: -10},
+		normalize: shp.Box{MinX: 170, MinY: -20, MaxX: 190, MaxY: -10},
+	},
+	{
+		label:     "vertex on antimeridian",
+		rings:     [][]shp.Point{testRing(179, -17, 180, -16.5, -179, -16, -179, -17, 179, -17)},
+		area:      1.0,
+		parts:     2,
+		split:     shp.Box{MinX: -180, MinY: -17, MaxX: 180, MaxY: -16},
+		normalize: shp.Box{MinX: 179, MinY: -17, MaxX: 181, MaxY: -16},
+	},
+	{
+		label:     "edges along antimeridian",
+		rings:     [][]shp.Point{testRing(175, 64, 180, 64, -180, 64, -175, 64, -175, 66, -180, 66, 180, 66, 175, 66, 175, 64)},
+		area:      20.0,
+		parts:     2,
+		split:     shp.Box{MinX: -180, MinY: 64, MaxX: 180, MaxY: 66},
+		normalize: shp.Box{MinX: 175, MinY: 64, MaxX: 185, MaxY: 66},
+	},
+	{
+		label:     "east of antimeridian",
+		rings:     [][]shp.Point{testRing(180, -17, -179, -17, -179, -16, 180, -16, 180, -17)},
+		area:      1.0,
+		parts:     1,
+		split:     shp.Box{MinX: -180, MinY: -17, MaxX: -179, MaxY: -16},
+		normalize: shp.Box{MinX: 180, MinY: -17, MaxX: 181, MaxY: -16},
+	},
+}
+
+func boxEquals(a shp.Box, b shp.Box) bool {
+	return math.Abs(a.MinX-b.MinX) < 1e-9 && math.Abs(a.MinY-b.MinY) < 1e-9 && math.Abs(a.MaxX-b.MaxX) < 1e-9 && math.Abs(a.MaxY-b.MaxY) < 1e-9
+}
+
+func TestAntimeridianShapePolygon(t *testing.T) {
+
+	for _, test := range antimeridianTests {
+
+		s := testPolygon(test.rings[0], test.rings[1:]...)
+
+		for _, strategy := range []string{ANTIMERIDIAN_SPLIT, ANTIMERIDIAN_NORMALIZE} {
+
+			label := fmt.Sprintf("%s (%s)", test.label, strategy)
+
+			out, crossed, err := AntimeridianShape(s, strategy)
+
+			if err != nil {
+				t.Errorf("%s: %s", label, err)
+				continue
+			}
+
+			if !crossed {
+				t.Errorf("%s: expected shape to cross the antimeridian", label)
+			}
+
+			poly := out.(*shp.Polygon)
+
+			expected_parts := test.parts
+			expected_box := test.split
+
+			if strategy == ANTIMERIDIAN_NORMALIZE {
+				expected_parts = len(test.rings)
+				expected_box = test.normalize
+			}
+
+			if int(poly.NumParts) != expected_parts {
+				t.Errorf("%s: expected %d parts but got %d", label, expected_parts, poly.NumParts)
+			}
+
+			area := shapeArea(out)
+
+			if math.Abs(area-test.area) > 1e-6 {
+				t.Errorf("%s: expected an area of %f but got %f", label, test.area, area)
+			}
+
+			if !boxEquals(out.BBox(), expected_box) {
+				t.Errorf("%s: expected a bounding box of %v but got %v", label, expected_box, out.BBox())
+			}
+
+			for _, pt := range poly.Points {
+
+				if strategy == ANTIMERIDIAN_SPLIT && (pt.X < -180.0 || pt.X > 180.0) {
+					t.Errorf("%s: point %v is outside the -180 to 180 range", label, pt)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestAntimeridianShapeUnchanged(t *testing.T) {
+
+	// touches the antimeridian but doesn't cross it
+
+	s := testPolygon(testRing(179, 0, 180, 1, 179, 2, 179, 0))
+
+	for _, strategy := range []string{ANTIMERIDIAN_SPLIT, ANTIMERIDIAN_NORMALIZE} {
+
+		out, crossed, err := AntimeridianShape(s, strategy)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if crossed || out != s {
+			t.Errorf("%s: expected shape to be unchanged", strategy)
+		}
+	}
+}
+
+func TestAntimeridianShapeLine(t *testing.T) {
+
+	line := shp.NewPolyLine([][]shp.Point{testRing(178, 0, -178, 2)})
+
+	out, _, err := AntimeridianShape(line, ANTIMERIDIAN_SPLIT)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl := out.(*shp.PolyLine)
+	parts := shapeParts(pl.Parts, pl.Points)
+
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts but got %d", len(parts))
+	}
+
+	if parts[0][1] != (shp.Point{X: 180, Y: 1}) || parts[1][0] != (shp.Point{X: -180, Y: 1}) {
+		t.Errorf("unexpected parts %v", parts)
+	}
+}
+
+func TestWriterAntimeridianBBox(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "antimeridian")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	// a polygon that crosses the antimeridian and one that doesn't, to
+	// make sure the file's bounding box covers both
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[178,-17],[-179,-17],[-179,-16],[178,-16],[178,-17]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Polygon","coordinates":[[[170,-20],[172,-20],[172,-19],[170,-19],[170,-20]]]}}`,
+	}
+
+	tests := map[string][2]shp.Box{
+		ANTIMERIDIAN_SPLIT: [2]shp.Box{
+			shp.Box{MinX: -180, MinY: -17, MaxX: 180, MaxY: -16},
+			shp.Box{MinX: -180, MinY: -20, MaxX: 180, MaxY: -16},
+		},
+		ANTIMERIDIAN_NORMALIZE: [2]shp.Box{
+			shp.Box{MinX: 178, MinY: -17, MaxX: 181, MaxY: -16},
+			shp.Box{MinX: 170, MinY: -20, MaxX: 181, MaxY: -16},
+		},
+		ANTIMERIDIAN_NONE: [2]shp.Box{
+			shp.Box{MinX: -179, MinY: -17, MaxX: 178, MaxY: -16},
+			shp.Box{MinX: -179, MinY: -20, MaxX: 178, MaxY: -16},
+		},
+	}
+
+	for strategy, boxes := range tests {
+
+		path := filepath.Join(root, strategy+".shp")
+
+		opts := NewDefaultWriterOptions()
+		opts.ShapeOptions.Antimeridian = strategy
+
+		wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range features {
+
+			f, err := feature.NewGeoJSONFeature([]byte(body))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = wr.AddFeature(f)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr, err := shp.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !boxEquals(rdr.BBox(), boxes[1]) {
+			t.Errorf("%s: expected a file bounding box of %v but got %v", strategy, boxes[1], rdr.BBox())
+		}
+
+		rdr.Next()
+		_, s := rdr.Shape()
+
+		rdr.Close()
+
+		if !boxEquals(s.BBox(), boxes[0]) {
+			t.Errorf("%s: expected a record bounding box of %v but got %v", strategy, boxes[0], s.BBox())
+		}
+	}
+}
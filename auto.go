@@ -0,0 +1,151 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-log"
+	"path/filepath"
+	"strings"
+)
+
+// NewAutoWriter returns a Writer that inspects the geometry type of each
+// feature and routes it to a sibling shapefile for that type. For example
+// if path is "out.shp" then Point geometries are written to "out_point.shp",
+// LineStrings and MultiLineStrings to "out_line.shp" and so on. Shapefiles
+// are only created once a feature of the corresponding type is added. If
+// opts.NullShapes is true then features with unsupported (or missing)
+// geometries are written to a NULL shapefile (for example "out_null.shp").
+// Point geometries are written at their own coordinates rather than the point
+// derived from opts.ShapeOptions.PointSources, which is intended for features
+// whose geometries aren't points.
+
+func NewAutoWriter(path string) (*Writer, error) {
+	return NewAutoWriterWithOptions(path, NewDefaultWriterOptions())
+}
+
+func NewAutoWriterWithOptions(path string, opts *WriterOptions) (*Writer, error) {
+
+	abs_path, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.SimpleWOFLogger()
+
+	wr := Writer{
+		Logger:        logger,
+		ShapeOptions:  opts.ShapeOptions,
+		options:       opts,
+		path:          abs_path,
+		auto:          true,
+		writers:       make(map[string]*Writer),
+		null_idx:      -1,
+		source_idx:    -1,
+		clipped_idx:   -1,
+		repairs_idx:   -1,
+		truncated_idx: -1,
+		overflow_idx:  -1,
+		computed_idx:  -1,
+	}
+
+	return &wr, nil
+}
+
+// AutoShapeTypeForGeometry returns the label and shape type that a GeoJSON
+// geometry type is routed to by an AUTO writer.
+
+func AutoShapeTypeForGeometry(geom_type string) (string, shp.ShapeType, error) {
+
+	switch geom_type {
+	case "Point":
+		return "point", shp.POINT, nil
+	case "MultiPoint":
+		return "multipoint", shp.MULTIPOINT, nil
+	case "LineString", "MultiLineString":
+		return "line", shp.POLYLINE, nil
+	case "Polygon", "MultiPolygon":
+		return "polygon", shp.POLYGON, nil
+	default:
+		msg := fmt.Sprintf("Unsupported geometry type '%s'", geom_type)
+		return "", shp.NULL, errors.New(msg)
+	}
+}
+
+func (wr *Writer) addFeatureAuto(f geojson.Feature) (int32, error) {
+
+	geom_type := gjson.GetBytes(f.Bytes(), "geometry.type").String()
+
+	label, shapetype, err := AutoShapeTypeForGeometry(geom_type)
+
+	if err != nil && !wr.options.NullShapes {
+		wr.skipped += 1
+		return -1, nil
+	}
+
+	geom_err := err
+
+	if geom_err != nil {
+		label = "null"
+		shapetype = shp.NULL
+	}
+
+	child, ok := wr.writers[label]
+
+	if !ok {
+
+		root := strings.TrimSuffix(wr.path, filepath.Ext(wr.path))
+		child_path := fmt.Sprintf("%s_%s.shp", root, label)
+
+		child_opts := wr.options
+
+		if shapetype == shp.POINT {
+
+			// the centroid of a point is the point itself
+
+			shape_opts := *wr.options.ShapeOptions
+			shape_opts.PointSources = []string{POINT_SOURCE_CENTROID}
+
+			point_opts := *wr.options
+			point_opts.ShapeOptions = &shape_opts
+
+			child_opts = &point_opts
+		}
+
+		child, err = NewWriterWithOptions(child_path, shapetype, child_opts)
+
+		if err != nil {
+			return -1, err
+		}
+
+		child.Logger = wr.Logger
+
+		wr.writers[label] = child
+	}
+
+	if geom_err != nil {
+		return child.addNullFeature(f, new(ShapeReport), geom_err)
+	}
+
+	return child.AddFeature(f)
+}
+
+func (wr *Writer) closeWriters() error {
+
+	var close_err error
+
+	for label, child := range wr.writers {
+
+		err := child.Close()
+
+		if err != nil && close_err == nil {
+			msg := fmt.Sprintf("Failed to close %s writer because %s", label, err)
+			close_err = errors.New(msg)
+		}
+	}
+
+	return close_err
+}
@@ -0,0 +1,172 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoWriter(t *testing.T) {
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Point","coordinates":[5,7]}}`,
+		`{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Point","coordinates":[1,1]}}`,
+		`{"type":"Feature","properties":{"wof:id":3},"geometry":{"type":"MultiPoint","coordinates":[[5,7],[8,9]]}}`,
+		`{"type":"Feature","properties":{"wof:id":4},"geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]}}`,
+		`{"type":"Feature","properties":{"wof:id":5},"geometry":{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":6},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,10],[10,10],[10,0],[0,0]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":7},"geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[0,10],[10,10],[10,0],[0,0]]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":8},"geometry":{"type":"Polygon","coordinates":[[[20,20],[20,30],[30,30],[30,20],[20,20]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":9},"geometry":{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[0,0]}]}}`,
+	}
+
+	// points are written at their own coordinates rather than those of
+	// the default point sources, which would be 0,0 (null island)
+
+	expected_points := map[string][]shp.Point{
+		"point":      testRing(5, 7, 1, 1),
+		"multipoint": testRing(5, 7, 8, 9),
+	}
+
+	tests := []struct {
+		label    string
+		nulls    bool
+		expected map[string]int
+		skipped  int64
+	}{
+		{
+			label:    "skip",
+			nulls:    false,
+			expected: map[string]int{"point": 2, "multipoint": 1, "line": 2, "polygon": 3},
+			skipped:  1,
+		},
+		{
+			label:    "nulls",
+			nulls:    true,
+			expected: map[string]int{"point": 2, "multipoint": 1, "line": 2, "polygon": 3, "null": 1},
+			skipped:  0,
+		},
+	}
+
+	for _, test := range tests {
+
+		root, err := ioutil.TempDir("", "auto")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.RemoveAll(root)
+
+		opts := NewDefaultWriterOptions()
+		opts.NullShapes = test.nulls
+
+		wr, err := NewWriterFromStringWithOptions(filepath.Join(root, "out.shp"), "AUTO", opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range features {
+
+			_, err = wr.AddFeature(testFeature(t, body))
+
+			if err != nil {
+				t.Fatalf("%s: %s", test.label, err)
+			}
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wr.Skipped() != test.skipped {
+			t.Errorf("%s: expected %d skipped features but got %d", test.label, test.skipped, wr.Skipped())
+		}
+
+		counts := wr.Counts()
+
+		if len(counts) != len(test.expected) {
+			t.Errorf("%s: expected counts for %d files but got %v", test.label, len(test.expected), counts)
+		}
+
+		for _, label := range []string{"point", "multipoint", "line", "polygon", "null"} {
+
+			path := filepath.Join(root, "out_"+label+".shp")
+
+			expected, ok := test.expected[label]
+
+			_, err := os.Stat(path)
+
+			if !ok {
+
+				if !os.IsNotExist(err) {
+					t.Errorf("%s: expected %s not to be created", test.label, path)
+				}
+
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%s: expected %s to be created but %s", test.label, path, err)
+				continue
+			}
+
+			if counts[path] != int64(expected) {
+				t.Errorf("%s: expected a count of %d for %s but got %d", test.label, expected, label, counts[path])
+			}
+
+			rdr, err := shp.Open(path)
+
+			if err != nil {
+				t.Errorf("%s: %s", test.label, err)
+				continue
+			}
+
+			records := 0
+			points := make([]shp.Point, 0)
+
+			for rdr.Next() {
+
+				records += 1
+
+				_, s := rdr.Shape()
+
+				switch shape := s.(type) {
+				case *shp.Point:
+					points = append(points, *shape)
+				case *shp.MultiPoint:
+					points = append(points, shape.Points...)
+				}
+			}
+
+			rdr.Close()
+
+			if records != expected {
+				t.Errorf("%s: expected %d records in %s but got %d", test.label, expected, label, records)
+			}
+
+			pts, ok := expected_points[label]
+
+			if !ok {
+				continue
+			}
+
+			if len(points) != len(pts) {
+				t.Errorf("%s: expected %d points in %s but got %v", test.label, len(pts), label, points)
+				continue
+			}
+
+			for i, pt := range pts {
+
+				if points[i] != pt {
+					t.Errorf("%s: expected point %d in %s to be %v but got %v", test.label, i, label, pt, points[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,702 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The name of the DBF field used to flag features whose geometry was cut at
+// the edge of the clip region (1) or left untouched (0).
+
+const CLIPPED_FIELD = "CLIPPED"
+
+// ErrOutsideClipRegion is returned (by way of FeatureToShapeWithReport) for
+// features that fall entirely outside of a clip region. These features are
+// always dropped, even if WriterOptions.NullShapes is true.
+
+var ErrOutsideClipRegion = errors.New("Feature is outside of the clip region")
+
+// ErrDegenerateClip is returned (by way of FeatureToShapeWithReport) for
+// features whose edges still overlap the edge of the clip region after being
+// nudged (see clipRings) and so can't be clipped reliably. Rather than guess,
+// these features are skipped or written as Null shapes.
+
+var ErrDegenerateClip = errors.New("Failed to clip feature because its edges overlap the edge of the clip region")
+
+// ClipRegion is a bounding box or one or more polygons, in WGS84 longitudes
+// and latitudes, used to clip shapes. If a region is made up of more than
+// one polygon they are assumed not to overlap.
+
+type ClipRegion struct {
+	polygons [][][]shp.Point
+	box      shp.Box
+	is_bbox  bool
+}
+
+func NewClipRegionFromBBox(minx float64, miny float64, maxx float64, maxy float64) (*ClipRegion, error) {
+
+	if minx >= maxx || miny >= maxy {
+		return nil, errors.New("Invalid bounding box")
+	}
+
+	shell := []shp.Point{
+		shp.Point{X: minx, Y: miny},
+		shp.Point{X: minx, Y: maxy},
+		shp.Point{X: maxx, Y: maxy},
+		shp.Point{X: maxx, Y: miny},
+		shp.Point{X: minx, Y: miny},
+	}
+
+	c, err := newClipRegion([][][]shp.Point{[][]shp.Point{shell}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.is_bbox = true
+	return c, nil
+}
+
+// NewClipRegionFromString returns a ClipRegion for a bounding box in the
+// form of a "minx,miny,maxx,maxy" string.
+
+func NewClipRegionFromString(str_bbox string) (*ClipRegion, error) {
+
+	parts := strings.Split(str_bbox, ",")
+
+	if len(parts) != 4 {
+		return nil, errors.New("Invalid bounding box, expected minx,miny,maxx,maxy")
+	}
+
+	coords := make([]float64, 4)
+
+	for i, str_coord := range parts {
+
+		coord, err := strconv.ParseFloat(strings.TrimSpace(str_coord), 64)
+
+		if err != nil {
+			msg := fmt.Sprintf("Invalid bounding box coordinate '%s'", str_coord)
+			return nil, errors.New(msg)
+		}
+
+		coords[i] = coord
+	}
+
+	return NewClipRegionFromBBox(coords[0], coords[1], coords[2], coords[3])
+}
+
+// NewClipRegionFromFile returns a ClipRegion for the polygons in a shapefile
+// (if path ends in ".shp") or a GeoJSON Feature, FeatureCollection or
+// geometry. Shapefiles are expected to use WGS84 coordinates.
+
+func NewClipRegionFromFile(path string) (*ClipRegion, error) {
+
+	if strings.ToLower(filepath.Ext(path)) == ".shp" {
+		return newClipRegionFromShapefile(path)
+	}
+
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClipRegionFromGeoJSON(body)
+}
+
+func NewClipRegionFromGeoJSON(body []byte) (*ClipRegion, error) {
+
+	features := make([]geojson.Feature, 0)
+
+	var bodies [][]byte
+
+	switch gjson.GetBytes(body, "type").String() {
+
+	case "FeatureCollection":
+
+		for _, r := range gjson.GetBytes(body, "features").Array() {
+			bodies = append(bodies, []byte(r.Raw))
+		}
+
+	case "Feature":
+		bodies = [][]byte{body}
+
+	case "Polygon", "MultiPolygon", "GeometryCollection":
+
+		wrapped := fmt.Sprintf(`{"type":"Feature","properties":{},"geometry":%s}`, body)
+		bodies = [][]byte{[]byte(wrapped)}
+
+	default:
+		return nil, errors.New("Unsupported GeoJSON type for clip region")
+	}
+
+	for _, b := range bodies {
+
+		f, err := feature.NewGeoJSONFeature(b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		features = append(features, f)
+	}
+
+	return NewClipRegionFromFeatures(features)
+}
+
+// NewClipRegionFromFeatures returns a ClipRegion for the polygons of one or
+// more features. Features without any polygons are ignored.
+
+func NewClipRegionFromFeatures(features []geojson.Feature) (*ClipRegion, error) {
+
+	polys := make([][][]shp.Point, 0)
+
+	for _, f := range features {
+
+		s, err := FeatureToPolygon(f)
+
+		if err != nil {
+			continue
+		}
+
+		poly := s.(*shp.Polygon)
+		polys = append(polys, groupRings(shapeParts(poly.Parts, poly.Points))...)
+	}
+
+	return newClipRegion(polys)
+}
+
+func newClipRegionFromShapefile(path string) (*ClipRegion, error) {
+
+	r, err := shp.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	polys := make([][][]shp.Point, 0)
+
+	for r.Next() {
+
+		_, s := r.Shape()
+
+		var rings [][]shp.Point
+
+		switch shape := s.(type) {
+		case *shp.Polygon:
+			rings = shapeParts(shape.Parts, shape.Points)
+		case *shp.PolygonZ:
+			rings = shapeParts(shape.Parts, shape.Points)
+		case *shp.PolygonM:
+			rings = shapeParts(shape.Parts, shape.Points)
+		default:
+			continue
+		}
+
+		polys = append(polys, groupRings(rings)...)
+	}
+
+	err = r.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newClipRegion(polys)
+}
+
+func newClipRegion(polys [][][]shp.Point) (*ClipRegion, error) {
+
+	if len(polys) == 0 {
+		return nil, errors.New("Clip region has no polygons")
+	}
+
+	pts := make([]shp.Point, 0)
+
+	for i, poly := range polys {
+
+		for j, ring := range poly {
+			polys[i][j] = closeRing(ring)
+		}
+
+		pts = append(pts, poly[0]...)
+	}
+
+	c := ClipRegion{
+		polygons: polys,
+		box:      shp.BBoxFromPoints(pts),
+	}
+
+	return &c, nil
+}
+
+// Box returns the bounding box of the clip region.
+
+func (c *ClipRegion) Box() shp.Box {
+	return c.box
+}
+
+// Contains returns true if pt falls inside the clip region.
+
+func (c *ClipRegion) Contains(pt shp.Point) bool {
+
+	if !boxContains(c.box, pt) {
+		return false
+	}
+
+	for _, poly := range c.polygons {
+
+		if !pointInRing(pt, poly[0]) {
+			continue
+		}
+
+		in_hole := false
+
+		for _, hole := range poly[1:] {
+
+			if pointInRing(pt, hole) {
+				in_hole = true
+				break
+			}
+		}
+
+		if !in_hole {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClipShape returns a copy of s (whose coordinates are WGS84 longitudes and
+// latitudes) cut at the edge of the clip region along with a boolean flag
+// indicating whether the shape was changed. POINT and MULTIPOINT shapes are
+// never cut but points outside the clip region are dropped. If nothing is
+// left of s the error is ErrOutsideClipRegion and if s can't be cut reliably
+// the error is ErrDegenerateClip.
+
+func (c *ClipRegion) ClipShape(s shp.Shape) (shp.Shape, bool, error) {
+
+	if !boxIntersects(c.box, s.BBox()) {
+		return nil, false, ErrOutsideClipRegion
+	}
+
+	if c.is_bbox && boxWithin(s.BBox(), c.box) {
+		return s, false, nil
+	}
+
+	switch shape := s.(type) {
+
+	case *shp.Point:
+
+		if !c.Contains(*shape) {
+			return nil, false, ErrOutsideClipRegion
+		}
+
+		return s, false, nil
+
+	case *shp.MultiPoint:
+
+		points := make([]shp.Point, 0)
+
+		for _, pt := range shape.Points {
+
+			if c.Contains(pt) {
+				points = append(points, pt)
+			}
+		}
+
+		if len(points) == 0 {
+			return nil, false, ErrOutsideClipRegion
+		}
+
+		if len(points) == len(shape.Points) {
+			return s, false, nil
+		}
+
+		multi := shp.MultiPoint{
+			Box:       shp.BBoxFromPoints(points),
+			NumPoints: int32(len(points)),
+			Points:    points,
+		}
+
+		return &multi, true, nil
+
+	case *shp.PolyLine:
+
+		parts := make([][]shp.Point, 0)
+		clipped := false
+
+		for _, line := range shapeParts(shape.Parts, shape.Points) {
+
+			lines, changed := c.clipLine(line)
+
+			parts = append(parts, lines...)
+			clipped = clipped || changed
+		}
+
+		if len(parts) == 0 {
+			return nil, false, ErrOutsideClipRegion
+		}
+
+		if !clipped {
+			return s, false, nil
+		}
+
+		return shp.NewPolyLine(parts), true, nil
+
+	case *shp.Polygon:
+
+		rings := make([][]shp.Point, 0)
+		clipped := false
+
+		for _, subject := range groupRings(shapeParts(shape.Parts, shape.Points)) {
+
+			// a subject polygon that falls outside every clip
+			// polygon is dropped which counts as a change
+
+			kept := false
+
+			for _, clip := range c.polygons {
+
+				polys, changed, err := clipPolygon(subject, clip)
+
+				if err != nil {
+					return nil, false, err
+				}
+
+				clipped = clipped || changed
+
+				if len(polys) > 0 {
+					kept = true
+				}
+
+				for _, poly := range polys {
+
+					rings = append(rings, orientRing(poly[0], true))
+
+					for _, hole := range poly[1:] {
+						rings = append(rings, orientRing(hole, false))
+					}
+				}
+			}
+
+			if !kept {
+				clipped = true
+			}
+		}
+
+		if len(rings) == 0 {
+			return nil, false, ErrOutsideClipRegion
+		}
+
+		if !clipped {
+			return s, false, nil
+		}
+
+		return newPolygon(rings), true, nil
+
+	default:
+		return nil, false, errors.New("Unsupported shape type")
+	}
+}
+
+// clipLine returns the parts of line that fall inside the clip region and a
+// boolean flag indicating whether any part of line was removed.
+
+func (c *ClipRegion) clipLine(line []shp.Point) ([][]shp.Point, bool) {
+
+	lines := make([][]shp.Point, 0)
+	current := make([]shp.Point, 0)
+
+	clipped := false
+
+	flush := func() {
+
+		current = dedupePoints(current)
+
+		if len(current) >= 2 {
+			lines = append(lines, current)
+		}
+
+		current = make([]shp.Point, 0)
+	}
+
+	for i := 1; i < len(line); i++ {
+
+		a := line[i-1]
+		b := line[i]
+
+		// split the segment everywhere it crosses the edge of the clip
+		// region and then test the middle of each piece
+
+		splits := []float64{0.0, 1.0}
+
+		for _, poly := range c.polygons {
+
+			for _, ring := range poly {
+
+				for j := 1; j < len(ring); j++ {
+
+					t, ok := segmentCrossing(a, b, ring[j-1], ring[j])
+
+					if ok {
+						splits = append(splits, t)
+					}
+				}
+			}
+		}
+
+		sort.Float64s(splits)
+
+		for j := 1; j < len(splits); j++ {
+
+			t0 := splits[j-1]
+			t1 := splits[j]
+
+			if t1-t0 <= 0.0 {
+				continue
+			}
+
+			p0 := interpolatePoint(a, b, t0)
+			p1 := interpolatePoint(a, b, t1)
+
+			if !c.Contains(interpolatePoint(a, b, (t0+t1)/2.0)) {
+				clipped = true
+				flush()
+				continue
+			}
+
+			if len(current) == 0 {
+				current = append(current, p0)
+			}
+
+			current = append(current, p1)
+		}
+	}
+
+	flush()
+
+	return lines, clipped
+}
+
+// clipPolygon returns the intersection of the subject and clip polygons
+// (each an outer ring followed by zero or more holes) as zero or more
+// polygons and a boolean flag indicating whether subject was changed. If the
+// two polygons do not overlap at all the result is empty and unchanged.
+
+func clipPolygon(subject [][]shp.Point, clip [][]shp.Point) ([][][]shp.Point, bool, error) {
+
+	shells, intersected, err := clipRings(subject[0], clip[0], gh_intersection)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := intersected
+
+	// edges that are shared with (or vertices that lie on) the edge of the
+	// clip polygon count as intersections even though nothing was cut, in
+	// which case the intersection is the same size as subject (give or take
+	// the nudging of degenerate rings, see clipRings)
+
+	if intersected && len(shells) == 1 {
+
+		d := math.Abs(math.Abs(ringArea(shells[0])) - math.Abs(ringArea(subject[0])))
+
+		if d < ringPerimeter(subject[0])*gh_sliver_width {
+			shells = [][]shp.Point{subject[0]}
+			changed = false
+		}
+	}
+
+	if !intersected {
+
+		if pointInRing(openRing(subject[0])[0], clip[0]) {
+			shells = [][]shp.Point{subject[0]}
+		} else if pointInRing(openRing(clip[0])[0], subject[0]) {
+			shells = [][]shp.Point{clip[0]}
+			changed = true
+		} else {
+			return nil, false, nil
+		}
+	}
+
+	polys := make([][][]shp.Point, len(shells))
+
+	for i, shell := range shells {
+		polys[i] = [][]shp.Point{shell}
+	}
+
+	// subject holes only matter if the shell was cut (in which case the
+	// shape has changed anyway) but clip holes always change the shape if
+	// they overlap it
+
+	holes := make([][]shp.Point, 0)
+	holes = append(holes, subject[1:]...)
+
+	count_subject := len(holes)
+	holes = append(holes, clip[1:]...)
+
+	for i, hole := range holes {
+
+		next := make([][][]shp.Point, 0)
+
+		for _, poly := range polys {
+
+			cut, affected, err := subtractHole(poly, hole)
+
+			if err != nil {
+				return nil, false, err
+			}
+
+			next = append(next, cut...)
+
+			if affected && i >= count_subject {
+				changed = true
+			}
+		}
+
+		polys = next
+	}
+
+	return polys, changed, nil
+}
+
+// subtractHole removes hole from poly returning zero or more polygons and a
+// boolean flag indicating whether hole overlapped poly.
+
+func subtractHole(poly [][]shp.Point, hole []shp.Point) ([][][]shp.Point, bool, error) {
+
+	shell := poly[0]
+
+	pieces, intersected, err := clipRings(shell, hole, gh_difference)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !intersected {
+
+		if pointInRing(openRing(shell)[0], hole) {
+			return nil, true, nil
+		}
+
+		if !pointInRing(openRing(hole)[0], shell) {
+			return [][][]shp.Point{poly}, false, nil
+		}
+
+		updated := [][]shp.Point{shell}
+
+		for _, existing := range poly[1:] {
+
+			// hole is already covered by an existing hole
+
+			if pointInRing(openRing(hole)[0], existing) {
+				return [][][]shp.Point{poly}, false, nil
+			}
+
+			// an existing hole is covered by hole
+
+			if pointInRing(openRing(existing)[0], hole) {
+				continue
+			}
+
+			updated = append(updated, existing)
+		}
+
+		updated = append(updated, hole)
+		return [][][]shp.Point{updated}, true, nil
+	}
+
+	polys := make([][][]shp.Point, len(pieces))
+
+	for i, piece := range pieces {
+		polys[i] = [][]shp.Point{piece}
+	}
+
+	for _, existing := range poly[1:] {
+
+		pt := openRing(existing)[0]
+
+		if pointInRing(pt, hole) {
+			continue
+		}
+
+		for i, piece := range pieces {
+
+			if pointInRing(pt, piece) {
+				polys[i] = append(polys[i], existing)
+				break
+			}
+		}
+	}
+
+	return polys, true, nil
+}
+
+// segmentCrossing returns the (relative) position along a,b where it crosses
+// the segment c,d. Collinear segments are not considered to cross.
+
+func segmentCrossing(a shp.Point, b shp.Point, c shp.Point, d shp.Point) (float64, bool) {
+
+	rx := b.X - a.X
+	ry := b.Y - a.Y
+	sx := d.X - c.X
+	sy := d.Y - c.Y
+
+	denom := rx*sy - ry*sx
+
+	if denom == 0.0 {
+		return 0.0, false
+	}
+
+	qpx := c.X - a.X
+	qpy := c.Y - a.Y
+
+	t := (qpx*sy - qpy*sx) / denom
+	u := (qpx*ry - qpy*rx) / denom
+
+	if t < 0.0 || t > 1.0 || u < 0.0 || u > 1.0 {
+		return 0.0, false
+	}
+
+	return t, true
+}
+
+func interpolatePoint(a shp.Point, b shp.Point, t float64) shp.Point {
+
+	if t == 0.0 {
+		return a
+	}
+
+	if t == 1.0 {
+		return b
+	}
+
+	return shp.Point{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+}
+
+func boxContains(box shp.Box, pt shp.Point) bool {
+	return pt.X >= box.MinX && pt.X <= box.MaxX && pt.Y >= box.MinY && pt.Y <= box.MaxY
+}
+
+func boxIntersects(a shp.Box, b shp.Box) bool {
+	return a.MinX <= b.MaxX && a.MaxX >= b.MinX && a.MinY <= b.MaxY && a.MaxY >= b.MinY
+}
+
+func boxWithin(inner shp.Box, outer shp.Box) bool {
+	return inner.MinX >= outer.MinX && inner.MaxX <= outer.MaxX && inner.MinY >= outer.MinY && inner.MaxY <= outer.MaxY
+}
@@ -0,0 +1,258 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"math"
+	"testing"
+)
+
+// testPolygon returns a POLYGON shape for a shell followed by zero or more
+// holes, oriented according to the ESRI spec.
+
+func testPolygon(shell []shp.Point, holes ...[]shp.Point) *shp.Polygon {
+
+	rings := [][]shp.Point{orientRing(shell, true)}
+
+	for _, hole := range holes {
+		rings = append(rings, orientRing(hole, false))
+	}
+
+	return newPolygon(rings)
+}
+
+// shapeArea returns the area of a POLYGON shape, with the area of its holes
+// removed.
+
+func shapeArea(s shp.Shape) float64 {
+
+	poly := s.(*shp.Polygon)
+	area := 0.0
+
+	for _, ring := range shapeParts(poly.Parts, poly.Points) {
+		area -= ringArea(ring)
+	}
+
+	return area
+}
+
+func TestClipShapePolygon(t *testing.T) {
+
+	box, err := NewClipRegionFromBBox(0.0, 0.0, 10.0, 10.0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same square as a polygon, so that shapes inside it aren't
+	// short-circuited by the bounding box test
+
+	square, err := newClipRegion([][][]shp.Point{[][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	triangle, err := newClipRegion([][][]shp.Point{[][]shp.Point{testRing(0, 0, 0, 10, 10, 0, 0, 0)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slope, err := newClipRegion([][][]shp.Point{[][]shp.Point{testRing(0, 0, 10, 5, 10, 0, 0, 0)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label   string
+		region  *ClipRegion
+		subject *shp.Polygon
+		area    float64
+		box     shp.Box
+		clipped bool
+	}{
+		{
+			label:   "inside box",
+			region:  box,
+			subject: testPolygon(testRing(2, 2, 2, 4, 4, 4, 4, 2, 2, 2)),
+			area:    4.0,
+			box:     shp.Box{MinX: 2, MinY: 2, MaxX: 4, MaxY: 4},
+		},
+		{
+			label:   "inside polygon",
+			region:  square,
+			subject: testPolygon(testRing(2, 2, 2, 4, 4, 4, 4, 2, 2, 2)),
+			area:    4.0,
+			box:     shp.Box{MinX: 2, MinY: 2, MaxX: 4, MaxY: 4},
+		},
+		{
+			label:   "contains clip region",
+			region:  square,
+			subject: testPolygon(testRing(-5, -5, -5, 15, 15, 15, 15, -5, -5, -5)),
+			area:    100.0,
+			box:     shp.Box{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10},
+			clipped: true,
+		},
+		{
+			label:   "crosses corner",
+			region:  square,
+			subject: testPolygon(testRing(-5, -5, -5, 5, 5, 5, 5, -5, -5, -5)),
+			area:    25.0,
+			box:     shp.Box{MinX: 0, MinY: 0, MaxX: 5, MaxY: 5},
+			clipped: true,
+		},
+		{
+			label:   "crosses with hole",
+			region:  square,
+			subject: testPolygon(testRing(5, 2, 5, 8, 15, 8, 15, 2, 5, 2), testRing(6, 4, 6, 6, 8, 6, 8, 4, 6, 4)),
+			area:    26.0,
+			box:     shp.Box{MinX: 5, MinY: 2, MaxX: 10, MaxY: 8},
+			clipped: true,
+		},
+		{
+			label:   "shares edges",
+			region:  square,
+			subject: testPolygon(testRing(0, 0, 0, 5, 5, 5, 5, 0, 0, 0)),
+			area:    25.0,
+			box:     shp.Box{MinX: 0, MinY: 0, MaxX: 5, MaxY: 5},
+		},
+		{
+			label:   "shares an edge and crosses",
+			region:  square,
+			subject: testPolygon(testRing(0, 2, 0, 8, 15, 8, 15, 2, 0, 2)),
+			area:    60.0,
+			box:     shp.Box{MinX: 0, MinY: 2, MaxX: 10, MaxY: 8},
+			clipped: true,
+		},
+		{
+			label:   "vertex on edge",
+			region:  square,
+			subject: testPolygon(testRing(5, 2, 5, 8, 10, 5, 5, 2)),
+			area:    15.0,
+			box:     shp.Box{MinX: 5, MinY: 2, MaxX: 10, MaxY: 8},
+		},
+		{
+			label:   "vertices on edge and crosses",
+			region:  square,
+			subject: testPolygon(testRing(10, 2, 7, 5, 10, 8, 13, 5, 10, 2)),
+			area:    9.0,
+			box:     shp.Box{MinX: 7, MinY: 2, MaxX: 10, MaxY: 8},
+			clipped: true,
+		},
+		{
+			label:   "vertex on diagonal edge",
+			region:  triangle,
+			subject: testPolygon(testRing(2, 2, 2, 4, 5, 5, 4, 2, 2, 2)),
+			area:    6.0,
+			box:     shp.Box{MinX: 2, MinY: 2, MaxX: 5, MaxY: 5},
+		},
+		{
+			label:   "vertices on diagonal edge and crosses",
+			region:  triangle,
+			subject: testPolygon(testRing(2, 2, 2, 8, 8, 8, 8, 2, 2, 2)),
+			area:    18.0,
+			box:     shp.Box{MinX: 2, MinY: 2, MaxX: 8, MaxY: 8},
+			clipped: true,
+		},
+		{
+			// the edge of the clip region is parallel to the first
+			// direction degenerate rings are nudged in
+
+			label:   "vertex on sloped edge",
+			region:  slope,
+			subject: testPolygon(testRing(4, -2, 4, 2, 8, 2, 8, -2, 4, -2)),
+			area:    8.0,
+			box:     shp.Box{MinX: 4, MinY: 0, MaxX: 8, MaxY: 2},
+			clipped: true,
+		},
+	}
+
+	for _, test := range tests {
+
+		s, clipped, err := test.region.ClipShape(test.subject)
+
+		if err != nil {
+			t.Errorf("%s: failed to clip shape, %s", test.label, err)
+			continue
+		}
+
+		if clipped != test.clipped {
+			t.Errorf("%s: expected clipped to be %t", test.label, test.clipped)
+		}
+
+		area := shapeArea(s)
+
+		if math.Abs(area-test.area) > 1e-6 {
+			t.Errorf("%s: expected an area of %f but got %f", test.label, test.area, area)
+		}
+
+		b := s.BBox()
+
+		if math.Abs(b.MinX-test.box.MinX) > 1e-9 || math.Abs(b.MinY-test.box.MinY) > 1e-9 || math.Abs(b.MaxX-test.box.MaxX) > 1e-9 || math.Abs(b.MaxY-test.box.MaxY) > 1e-9 {
+			t.Errorf("%s: expected a bounding box of %v but got %v", test.label, test.box, b)
+		}
+	}
+}
+
+func TestClipShapeOutside(t *testing.T) {
+
+	triangle, err := newClipRegion([][][]shp.Point{[][]shp.Point{testRing(0, 0, 0, 10, 10, 0, 0, 0)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]shp.Shape{
+		"outside box": testPolygon(testRing(20, 20, 20, 30, 30, 30, 30, 20, 20, 20)),
+		"inside box":  testPolygon(testRing(8, 8, 8, 9, 9, 9, 9, 8, 8, 8)),
+		"touches":     testPolygon(testRing(5, 5, 5, 9, 9, 9, 9, 5, 5, 5)),
+		"point":       &shp.Point{X: 8, Y: 8},
+		"line":        shp.NewPolyLine([][]shp.Point{testRing(6, 6, 9, 9)}),
+	}
+
+	for label, s := range tests {
+
+		_, _, err := triangle.ClipShape(s)
+
+		if err != ErrOutsideClipRegion {
+			t.Errorf("%s: expected ErrOutsideClipRegion but got %v", label, err)
+		}
+	}
+}
+
+func TestClipShapeLine(t *testing.T) {
+
+	box, err := NewClipRegionFromBBox(0.0, 0.0, 10.0, 10.0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := shp.NewPolyLine([][]shp.Point{testRing(-5, 5, 5, 5, 5, 15, 8, 15, 8, 5)})
+
+	s, clipped, err := box.ClipShape(line)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !clipped {
+		t.Fatal("expected line to be clipped")
+	}
+
+	pl := s.(*shp.PolyLine)
+	parts := shapeParts(pl.Parts, pl.Points)
+
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts but got %d", len(parts))
+	}
+
+	if parts[0][0] != (shp.Point{X: 0, Y: 5}) || parts[0][len(parts[0])-1] != (shp.Point{X: 5, Y: 10}) {
+		t.Errorf("unexpected first part %v", parts[0])
+	}
+
+	if parts[1][0] != (shp.Point{X: 8, Y: 10}) || parts[1][len(parts[1])-1] != (shp.Point{X: 8, Y: 5}) {
+		t.Errorf("unexpected second part %v", parts[1])
+	}
+}
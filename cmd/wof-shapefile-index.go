@@ -6,12 +6,14 @@ import (
 	"flag"
 	"fmt"
 	"github.com/whosonfirst/go-whosonfirst-cli/flags"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
 	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
 	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
 	"github.com/whosonfirst/go-whosonfirst-index"
 	"github.com/whosonfirst/go-whosonfirst-index/utils"
 	"github.com/whosonfirst/go-whosonfirst-log"
 	"github.com/whosonfirst/go-whosonfirst-shapefile"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
 	"github.com/whosonfirst/warning"
 	"io"
 	"os"
@@ -29,6 +31,9 @@ func main() {
 	valid_types := strings.Join(shapefile.ShapeTypes(), ",")
 	desc_types := fmt.Sprintf("The shapefile type to use indexing data. Valid types are: %s.", valid_types)
 
+	valid_strategies := strings.Join(shapefile.MultiPointStrategies(), ",")
+	desc_strategies := fmt.Sprintf("The strategy to use deriving points for MULTIPOINT shapes. Valid strategies are: %s.", valid_strategies)
+
 	// something something something take the filter code in go-whosonfirst-pip-v2
 	// and make it generally applicable to something like this - ultimately it should
 	// be made to work with go-whosonfirst-index callback function
@@ -44,10 +49,107 @@ func main() {
 	var belongs_to flags.MultiInt64
 	flag.Var(&belongs_to, "belongs-to", "Include only records that belong to this ID. You may pass multiple -belongs-to flags.")
 
+	var point_sources flags.MultiString
+	flag.Var(&point_sources, "point-source", "The source to use deriving POINT shapes: a property prefix (for example 'lbl', 'reversegeo', 'geom' or 'mps') or one of 'centroid', 'pia' (pole of inaccessibility) or 'nullisland'. You may pass multiple -point-source flags, in which case the first source that can be resolved is used. The default is lbl,reversegeo,geom,nullisland.")
+
 	mode := flag.String("mode", "repo", desc_modes)
 
 	shapetype := flag.String("shapetype", "POINT", desc_types)
 
+	multipoint_strategy := flag.String("multipoint-strategy", shapefile.MULTIPOINT_VERTICES, desc_strategies)
+
+	z_property := flag.String("z-property", "", "The (WOF) property to use for Z values when writing Z shape types. If empty the third coordinate of each position is used.")
+	z_unknown := flag.Float64("z-unknown", 0.0, "The Z value to write for points whose elevation is not known when writing Z shape types.")
+	m_property := flag.String("m-property", "", "The (WOF) property to use for M values when writing Z or M shape types, for example 'wof:inception' or 'date:inception_lower'.")
+
+	null_shapes := flag.Bool("null-shapes", false, "Write features whose geometry can not be converted to the shape type as Null shapes (with a NULL_WHY attribute) rather than skipping them.")
+
+	valid_algorithms := strings.Join(shapefile.SimplifyAlgorithms(), ",")
+	desc_algorithms := fmt.Sprintf("The algorithm to use simplifying POLYLINE and POLYGON shapes. Valid algorithms are: %s.", valid_algorithms)
+
+	simplify_tolerance := flag.Float64("simplify-tolerance", 0.0, "Simplify POLYLINE and POLYGON shapes using this tolerance, measured in the units of the output coordinates. If 0 no simplification is performed.")
+	simplify_algorithm := flag.String("simplify-algorithm", shapefile.SIMPLIFY_DOUGLAS_PEUCKER, desc_algorithms)
+
+	valid_projections := strings.Join(projection.Codes(), ",")
+	desc_projection := fmt.Sprintf("The coordinate reference system to project shapes in to. Valid options are: %s or any WGS84 UTM zone (EPSG:32601-32660, EPSG:32701-32760).", valid_projections)
+
+	proj := flag.String("projection", "EPSG:4326", desc_projection)
+	densify := flag.Float64("densify", shapefile.DEFAULT_DENSIFY, "When reprojecting shapes split edges longer than this many decimal degrees so that they remain faithful to the original geometry. If 0 edges are not split.")
+
+	valid_antimeridian := strings.Join(shapefile.AntimeridianStrategies(), ",")
+	desc_antimeridian := fmt.Sprintf("How to handle POLYLINE and POLYGON shapes that cross the antimeridian. Valid strategies are: %s.", valid_antimeridian)
+
+	antimeridian := flag.String("antimeridian", shapefile.ANTIMERIDIAN_NONE, desc_antimeridian)
+
+	valid_validation := strings.Join(shapefile.ValidationPolicies(), ",")
+	desc_validation := fmt.Sprintf("The policy to use for shapes with invalid geometries (unclosed rings, repeated points, self-intersections and so on). Valid policies are: %s.", valid_validation)
+
+	validation := flag.String("validation", shapefile.VALIDATION_NONE, desc_validation)
+	record_repairs := flag.Bool("record-repairs", false, "Add a REPAIRS attribute listing the repairs made to each record's geometry by the -validation repair policy.")
+
+	valid_schemas := strings.Join(shapefile.Schemas(), ",")
+	desc_schema := fmt.Sprintf("The schema to use for the attributes written for each feature. Valid schemas are: %s.", valid_schemas)
+
+	schema_name := flag.String("schema", shapefile.SCHEMA_DEFAULT, desc_schema)
+	schema_file := flag.String("schema-file", "", "The path to a JSON or YAML file defining the attributes written for each feature. If present this is used instead of -schema.")
+
+	infer_sample := flag.Int("infer-sample", 0, "The number of records to sample when inferring a schema with -schema infer. If 0 every record is sampled.")
+	infer_min_fill := flag.Float64("infer-min-fill", 0.0, "The fraction (0.0 - 1.0) of the sampled records that a property must have a value in to be included in an inferred schema.")
+	infer_out := flag.String("infer-out", "", "Write the schema inferred with -schema infer to this path, as YAML if it ends in '.yaml' or '.yml' and JSON otherwise.")
+	infer_only := flag.Bool("infer-only", false, "Stop once the schema inferred with -schema infer has been written to -infer-out, rather than writing a shapefile.")
+
+	var names flags.MultiString
+	flag.Var(&names, "name", "Add a column for this (WOF) name, for example 'fra_x_preferred' or 'fra' (shorthand for the preferred name). Names separated by '|' are tried in order and '*' may be used in place of the language to add a column for every matching name, for example '*_x_preferred'. You may pass multiple -name flags.")
+
+	valid_fallbacks := strings.Join(shapefile.NameFallbacks(), ",")
+	desc_fallbacks := fmt.Sprintf("The rule to apply when a record doesn't have any of the names for a -name column. Valid rules are: %s.", valid_fallbacks)
+
+	name_fallback := flag.String("name-fallback", shapefile.NAME_FALLBACK_NONE, desc_fallbacks)
+
+	hierarchy := flag.Bool("hierarchy", false, "Add an (integer) column for each placetype in a record's hierarchy, for example COUNTRY_ID or REGION_ID, and a HIER_COUNT column with the number of hierarchies the record has. Unless -hierarchy-placetype flags are passed columns are added for every placetype found in the data.")
+
+	var hierarchy_placetypes flags.MultiString
+	flag.Var(&hierarchy_placetypes, "hierarchy-placetype", "Add a hierarchy column for this placetype (implies -hierarchy). You may pass multiple -hierarchy-placetype flags.")
+
+	valid_hierarchy := strings.Join(shapefile.HierarchyStrategies(), ",")
+	desc_hierarchy := fmt.Sprintf("The strategy for choosing which hierarchy to use for records that have more than one. Valid strategies are: %s.", valid_hierarchy)
+
+	hierarchy_strategy := flag.String("hierarchy-strategy", shapefile.HIERARCHY_FIRST, desc_hierarchy)
+
+	edtf := flag.Bool("edtf", false, "Add columns for the lower bound, upper bound and precision of each record's edtf:inception and edtf:cessation properties.")
+	edtf_unknown := flag.String("edtf-unknown", "", "The dates to write for the lower and upper bounds of unknown -edtf values (like 'uuuu'), expressed as 'YYYY-MM-DD,YYYY-MM-DD' or as a single date for both bounds. If empty unknown bounds are left empty.")
+	edtf_open := flag.String("edtf-open", "", "The dates to write for the lower and upper bounds of open -edtf values (like '..' or '1990/..'), expressed as 'YYYY-MM-DD,YYYY-MM-DD' or as a single date for both bounds. If empty open bounds are left empty.")
+
+	var concordances flags.MultiString
+	flag.Var(&concordances, "concordance", "Add a column for this concordance (in wof:concordances), for example 'wd:id' or 'gn' (shorthand for 'gn:id'). You may pass multiple -concordance flags.")
+
+	valid_computed := strings.Join(shapefile.ComputedAttributes(), ",")
+	desc_computed := fmt.Sprintf("Add attributes computed from the shape written for each record. Lengths and areas are geodesic for longitude and latitude output and planar for projected output. Valid attributes are: %s. You may pass multiple -compute flags.", valid_computed)
+
+	var computed flags.MultiString
+	flag.Var(&computed, "compute", desc_computed)
+
+	var field_names flags.KeyValueArgs
+	flag.Var(&field_names, "field-name", "Override the DBF name of a field, expressed as 'property=NAME' (for example 'wof:parent_id=PARENT'). You may pass multiple -field-name flags.")
+
+	valid_field_maps := strings.Join(shapefile.FieldMapFormats(), ",")
+	desc_field_map := fmt.Sprintf("The format of the sidecar file that maps each DBF field to the property it was derived from. Valid formats are: %s.", valid_field_maps)
+
+	field_map := flag.String("field-map", shapefile.FIELD_MAP_CSV, desc_field_map)
+
+	valid_encodings := strings.Join(shapefile.Encodings(), ",")
+	desc_encoding := fmt.Sprintf("The character encoding of text attributes. Characters that can't be represented in a legacy encoding are transliterated or replaced with '?'. Valid encodings are: %s.", valid_encodings)
+
+	encoding := flag.String("encoding", shapefile.ENCODING_UTF8, desc_encoding)
+
+	valid_overflows := strings.Join(shapefile.OverflowFormats(), ",")
+	desc_overflow := fmt.Sprintf("The format of the table that text values which are too wide for their field are written to in full. Valid formats are: %s.", valid_overflows)
+
+	overflow := flag.String("overflow", shapefile.OVERFLOW_NONE, desc_overflow)
+
+	clip_bbox := flag.String("clip-bbox", "", "Clip shapes to this bounding box, expressed as 'minx,miny,maxx,maxy' in WGS84 coordinates.")
+	clip_path := flag.String("clip", "", "Clip shapes to a polygon (or polygons) read from this GeoJSON file or shapefile. Polygons must use WGS84 coordinates.")
+
 	out := flag.String("out", "", "Where to write the new shapefile")
 
 	timings := flag.Bool("timings", false, "Display timings during and after indexing")
@@ -59,43 +161,233 @@ func main() {
 	stdout := io.Writer(os.Stdout)
 	logger.AddLogger(stdout, "status")
 
-	writer, err := shapefile.NewWriterFromString(*out, *shapetype)
+	if !shapefile.IsValidMultiPointStrategy(*multipoint_strategy) {
+		logger.Fatal("Invalid -multipoint-strategy '%s'", *multipoint_strategy)
+	}
+
+	if !shapefile.IsValidAntimeridianStrategy(*antimeridian) {
+		logger.Fatal("Invalid -antimeridian '%s'", *antimeridian)
+	}
+
+	if !shapefile.IsValidValidationPolicy(*validation) {
+		logger.Fatal("Invalid -validation '%s'", *validation)
+	}
+
+	if !shapefile.IsValidNameFallback(*name_fallback) {
+		logger.Fatal("Invalid -name-fallback '%s'", *name_fallback)
+	}
+
+	if !shapefile.IsValidHierarchyStrategy(*hierarchy_strategy) {
+		logger.Fatal("Invalid -hierarchy-strategy '%s'", *hierarchy_strategy)
+	}
+
+	if !shapefile.IsValidFieldMapFormat(*field_map) {
+		logger.Fatal("Invalid -field-map '%s'", *field_map)
+	}
+
+	if !shapefile.IsValidEncoding(*encoding) {
+		logger.Fatal("Invalid -encoding '%s'", *encoding)
+	}
+
+	for _, attr := range computed {
+
+		if !shapefile.IsValidComputedAttribute(attr) {
+			logger.Fatal("Invalid -compute '%s'", attr)
+		}
+	}
+
+	if !shapefile.IsValidOverflowFormat(*overflow) {
+		logger.Fatal("Invalid -overflow '%s'", *overflow)
+	}
+
+	if !shapefile.IsValidSimplifyAlgorithm(*simplify_algorithm) {
+		logger.Fatal("Invalid -simplify-algorithm '%s'", *simplify_algorithm)
+	}
+
+	crs, err := projection.NewProjection(*proj)
 
 	if err != nil {
-		logger.Fatal("Failed to create new shape because %s", err)
+		logger.Fatal("Invalid -projection '%s' because %s", *proj, err)
 	}
 
-	writer.Logger = logger
+	schema, err := shapefile.NewSchema(*schema_name)
+
+	if err != nil {
+		logger.Fatal("Invalid -schema '%s'", *schema_name)
+	}
+
+	var inferred *shapefile.InferredSchema
+
+	if *schema_name == shapefile.SCHEMA_INFER && *schema_file == "" {
+
+		inferred, err = shapefile.NewInferredSchema(*infer_sample, *infer_min_fill)
+
+		if err != nil {
+			logger.Fatal("Invalid -schema infer because %s", err)
+		}
+
+		if *infer_only && *infer_out == "" {
+			logger.Fatal("-infer-only requires -infer-out")
+		}
+
+		schema = inferred
+	}
+
+	if *schema_file != "" {
+
+		schema, err = shapefile.NewFileSchema(*schema_file)
+
+		if err != nil {
+			logger.Fatal("Invalid -schema-file because %s", err)
+		}
+	}
+
+	opts := shapefile.NewDefaultWriterOptions()
+
+	opts.ShapeOptions.MultiPointStrategy = *multipoint_strategy
+	opts.ShapeOptions.ZProperty = *z_property
+	opts.ShapeOptions.ZUnknown = *z_unknown
+	opts.ShapeOptions.MProperty = *m_property
+	opts.ShapeOptions.SimplifyTolerance = *simplify_tolerance
+	opts.ShapeOptions.SimplifyAlgorithm = *simplify_algorithm
+	opts.ShapeOptions.Projection = crs
+	opts.ShapeOptions.Densify = *densify
+	opts.ShapeOptions.Antimeridian = *antimeridian
+	opts.ShapeOptions.Validation = *validation
+	opts.Schema = schema
+	opts.FieldNames = field_names.ToMap()
+	opts.FieldMap = *field_map
+	opts.Encoding = *encoding
+	opts.Overflow = *overflow
+	opts.Computed = computed
+	opts.NullShapes = *null_shapes
+	opts.RecordRepairs = *record_repairs
+
+	if *clip_bbox != "" && *clip_path != "" {
+		logger.Fatal("You can not pass both -clip-bbox and -clip")
+	}
+
+	if *clip_bbox != "" {
+
+		clip, err := shapefile.NewClipRegionFromString(*clip_bbox)
+
+		if err != nil {
+			logger.Fatal("Invalid -clip-bbox '%s' because %s", *clip_bbox, err)
+		}
+
+		opts.ShapeOptions.Clip = clip
+	}
+
+	if *clip_path != "" {
+
+		clip, err := shapefile.NewClipRegionFromFile(*clip_path)
+
+		if err != nil {
+			logger.Fatal("Failed to load clip region from %s because %s", *clip_path, err)
+		}
+
+		opts.ShapeOptions.Clip = clip
+	}
+
+	if len(point_sources) > 0 {
+		opts.ShapeOptions.PointSources = point_sources
+	}
+
+	schemas := []shapefile.Schema{schema}
+
+	if len(names) > 0 {
+
+		names_schema, err := shapefile.NewNamesSchema(names, *name_fallback)
+
+		if err != nil {
+			logger.Fatal("Invalid -name because %s", err)
+		}
+
+		schemas = append(schemas, names_schema)
+	}
+
+	if *edtf {
+
+		sentinels := shapefile.EDTFSentinels{}
+
+		sentinels.UnknownLower, sentinels.UnknownUpper, err = shapefile.ParseEDTFSentinel(*edtf_unknown)
+
+		if err != nil {
+			logger.Fatal("Invalid -edtf-unknown because %s", err)
+		}
+
+		sentinels.OpenLower, sentinels.OpenUpper, err = shapefile.ParseEDTFSentinel(*edtf_open)
+
+		if err != nil {
+			logger.Fatal("Invalid -edtf-open because %s", err)
+		}
+
+		schemas = append(schemas, shapefile.NewEDTFSchema(sentinels))
+	}
+
+	if *hierarchy || len(hierarchy_placetypes) > 0 {
+
+		hierarchy_schema, err := shapefile.NewHierarchySchema(hierarchy_placetypes, *hierarchy_strategy)
+
+		if err != nil {
+			logger.Fatal("Invalid -hierarchy-strategy because %s", err)
+		}
+
+		schemas = append(schemas, hierarchy_schema)
+	}
+
+	if len(concordances) > 0 {
+		schemas = append(schemas, shapefile.NewConcordancesSchema(concordances))
+	}
+
+	multi_schema := shapefile.NewMultiSchema(schemas...).(shapefile.ExpandableSchema)
+
+	if len(schemas) > 1 {
+		opts.Schema = multi_schema
+	}
 
 	/* please move all of this in to a package */
 
 	mu := new(sync.Mutex)
 
-	cb := func(fh io.Reader, ctx context.Context, args ...interface{}) error {
+	// load returns the feature in fh if it is a principal WOF record that
+	// passes the -include-placetype, -exclude-placetype and -belongs-to
+	// filters
+
+	load := func(fh io.Reader, ctx context.Context) (geojson.Feature, bool, error) {
 
 		path, err := index.PathForContext(ctx)
 
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 
 		ok, err := utils.IsPrincipalWOFRecord(fh, ctx)
 
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 
 		if !ok {
-			return nil
+			return nil, false, nil
 		}
 
-		f, err := feature.LoadGeoJSONFeatureFromReader(fh)
+		var f geojson.Feature
+
+		// the SPR for plain GeoJSON features only has an ID, name, placetype
+		// and coordinates so load WOF features as such
+
+		if *schema_name == shapefile.SCHEMA_SPR {
+			f, err = feature.LoadFeatureFromReader(fh)
+		} else {
+			f, err = feature.LoadGeoJSONFeatureFromReader(fh)
+		}
 
 		if err != nil {
 
 			if err != nil && !warning.IsWarning(err) {
 				msg := fmt.Sprintf("Unable to load %s, because %s", path, err)
-				return errors.New(msg)
+				return nil, false, errors.New(msg)
 			}
 		}
 
@@ -104,14 +396,14 @@ func main() {
 		if len(include_placetype) > 0 {
 
 			if !include_placetype.Contains(pt) {
-				return nil
+				return nil, false, nil
 			}
 		}
 
 		if len(exclude_placetype) > 0 {
 
 			if exclude_placetype.Contains(pt) {
-				return nil
+				return nil, false, nil
 			}
 		}
 
@@ -128,8 +420,93 @@ func main() {
 			}
 
 			if !ok {
+				return nil, false, nil
+			}
+		}
+
+		return f, true, nil
+	}
+
+	// columns that depend on the data (like wildcard names) are added in a
+	// first pass since the columns in a shapefile can't be changed once it
+	// has been created
+
+	if multi_schema.NeedsExpanding() {
+
+		expand_cb := func(fh io.Reader, ctx context.Context, args ...interface{}) error {
+
+			// for example once an inferred schema has sampled enough
+			// records
+
+			if !multi_schema.NeedsExpanding() {
 				return nil
 			}
+
+			f, ok, err := load(fh, ctx)
+
+			if err != nil || !ok {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			multi_schema.ExpandFromFeature(f)
+			return nil
+		}
+
+		expander, err := index.NewIndexer(*mode, expand_cb)
+
+		if err != nil {
+			logger.Fatal("Failed to create new indexer because: %s", err)
+		}
+
+		err = expander.IndexPaths(flag.Args())
+
+		if err != nil {
+			logger.Fatal("Failed to expand schema in %s mode because: %s", *mode, err)
+		}
+	}
+
+	if inferred != nil {
+
+		sampled := inferred.Sampled()
+
+		for _, st := range inferred.Stats() {
+			fill := float64(st.Count) / float64(sampled) * 100.0
+			logger.Status("%s: %s, max length %d, present in %d of %d records (%.1f%%)", st.Property, st.Type(), st.MaxLength, st.Count, sampled, fill)
+		}
+
+		if *infer_out != "" {
+
+			err := shapefile.WriteSchemaFile(*infer_out, inferred.SchemaFile())
+
+			if err != nil {
+				logger.Fatal("Failed to write inferred schema because %s", err)
+			}
+
+			logger.Status("wrote inferred schema to %s", *infer_out)
+		}
+
+		if *infer_only {
+			os.Exit(0)
+		}
+	}
+
+	writer, err := shapefile.NewWriterFromStringWithOptions(*out, *shapetype, opts)
+
+	if err != nil {
+		logger.Fatal("Failed to create new shape because %s", err)
+	}
+
+	writer.Logger = logger
+
+	cb := func(fh io.Reader, ctx context.Context, args ...interface{}) error {
+
+		f, ok, err := load(fh, ctx)
+
+		if err != nil || !ok {
+			return err
 		}
 
 		mu.Lock()
@@ -189,6 +566,44 @@ func main() {
 		logger.Fatal("Failed to index paths in %s mode because: %s", *mode, err)
 	}
 
-	writer.Close()
+	err = writer.Close()
+
+	if err != nil {
+		logger.Fatal("Failed to close shapefile because: %s", err)
+	}
+
+	for path, count := range writer.Counts() {
+		logger.Status("wrote %d records to %s", count, path)
+	}
+
+	if *simplify_tolerance > 0.0 {
+		vertices_in, vertices_out := writer.Vertices()
+		logger.Status("simplified %d vertices to %d vertices", vertices_in, vertices_out)
+	}
+
+	skipped := writer.Skipped()
+
+	if skipped > 0 {
+		logger.Status("skipped %d records that could not be written as %s shapes", skipped, *shapetype)
+	}
+
+	transliterated := writer.Transliterated()
+
+	if transliterated > 0 {
+		logger.Status("transliterated characters in %d values that could not be encoded as %s", transliterated, *encoding)
+	}
+
+	replaced := writer.Replaced()
+
+	if replaced > 0 {
+		logger.Status("replaced characters in %d values that could not be encoded as %s", replaced, *encoding)
+	}
+
+	truncated := writer.Truncated()
+
+	if truncated > 0 {
+		logger.Status("truncated %d values that were wider than their field", truncated)
+	}
+
 	os.Exit(0)
 }
@@ -0,0 +1,377 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
+	"math"
+)
+
+// The attributes that can be computed from the shape written for each feature,
+// after it has been clipped, reprojected and simplified. "area" is the area of
+// POLYGON shapes in square kilometres, "perimeter" is the length of the rings
+// of POLYGON shapes, or the length of POLYLINE shapes, in kilometres, "bbox"
+// is the bounding box of the shape in the coordinates of the shapefile and
+// "vertices" is the number of vertices in the shape. Lengths and areas are
+// geodesic if the shapefile uses longitude and latitude and planar (in the
+// projection's metres) otherwise.
+
+const (
+	COMPUTED_AREA      = "area"
+	COMPUTED_PERIMETER = "perimeter"
+	COMPUTED_BBOX      = "bbox"
+	COMPUTED_VERTICES  = "vertices"
+)
+
+func ComputedAttributes() []string {
+
+	return []string{
+		COMPUTED_AREA,
+		COMPUTED_BBOX,
+		COMPUTED_PERIMETER,
+		COMPUTED_VERTICES,
+	}
+}
+
+func IsValidComputedAttribute(test string) bool {
+
+	valid := false
+
+	for _, attr := range ComputedAttributes() {
+
+		if attr == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The names of the DBF fields used for computed attributes.
+
+const (
+	AREA_FIELD      = "AREA_KM2"
+	PERIMETER_FIELD = "PERIM_KM"
+	BBOX_MINX_FIELD = "BBOX_MINX"
+	BBOX_MINY_FIELD = "BBOX_MINY"
+	BBOX_MAXX_FIELD = "BBOX_MAXX"
+	BBOX_MAXY_FIELD = "BBOX_MAXY"
+	VERTICES_FIELD  = "VERTICES"
+)
+
+// The radius of the sphere with the same surface area as the WGS84 ellipsoid,
+// used to compute geodesic areas.
+
+const authalic_radius = 6371007.181
+
+// computedProvider defines the fields for a computed attribute and how their
+// values are derived from a shape. Values are nil if they don't apply to the
+// shape, for example the area of a POINT shape.
+
+type computedProvider struct {
+	fields []SchemaField
+	values func(g *computedGeometry) []interface{}
+}
+
+var computed_providers = map[string]computedProvider{
+	COMPUTED_AREA: computedProvider{
+		fields: []SchemaField{
+			SchemaField{Name: AREA_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 6},
+		},
+		values: func(g *computedGeometry) []interface{} {
+			return []interface{}{g.area()}
+		},
+	},
+	COMPUTED_PERIMETER: computedProvider{
+		fields: []SchemaField{
+			SchemaField{Name: PERIMETER_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 6},
+		},
+		values: func(g *computedGeometry) []interface{} {
+			return []interface{}{g.perimeter()}
+		},
+	},
+	COMPUTED_BBOX: computedProvider{
+		fields: []SchemaField{
+			SchemaField{Name: BBOX_MINX_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 8},
+			SchemaField{Name: BBOX_MINY_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 8},
+			SchemaField{Name: BBOX_MAXX_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 8},
+			SchemaField{Name: BBOX_MAXY_FIELD, Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		},
+		values: func(g *computedGeometry) []interface{} {
+
+			if g.shape == nil {
+				return []interface{}{nil, nil, nil, nil}
+			}
+
+			box := g.shape.BBox()
+			return []interface{}{box.MinX, box.MinY, box.MaxX, box.MaxY}
+		},
+	},
+	COMPUTED_VERTICES: computedProvider{
+		fields: []SchemaField{
+			SchemaField{Name: VERTICES_FIELD, Type: FIELD_NUMBER, Size: 10},
+		},
+		values: func(g *computedGeometry) []interface{} {
+			return []interface{}{g.vertices}
+		},
+	},
+}
+
+// computedFields returns the fields for attrs, in order, ignoring duplicates.
+
+func computedFields(attrs []string) []SchemaField {
+
+	fields := make([]SchemaField, 0)
+	seen := make(map[string]bool)
+
+	for _, attr := range attrs {
+
+		if seen[attr] {
+			continue
+		}
+
+		seen[attr] = true
+		fields = append(fields, computed_providers[attr].fields...)
+	}
+
+	return fields
+}
+
+// computedValues returns the values of attrs for s, in the same order as
+// computedFields. If geographic is true s uses longitude and latitude.
+
+func computedValues(attrs []string, s shp.Shape, geographic bool) []interface{} {
+
+	g := newComputedGeometry(s, geographic)
+
+	values := make([]interface{}, 0)
+	seen := make(map[string]bool)
+
+	for _, attr := range attrs {
+
+		if seen[attr] {
+			continue
+		}
+
+		seen[attr] = true
+		values = append(values, computed_providers[attr].values(g)...)
+	}
+
+	return values
+}
+
+// computedGeometry is the parts of a shape that computed attributes are
+// derived from. Null shapes have a nil shape.
+
+type computedGeometry struct {
+	shape      shp.Shape
+	parts      [][]shp.Point
+	polygon    bool
+	vertices   int
+	geographic bool
+}
+
+func newComputedGeometry(s shp.Shape, geographic bool) *computedGeometry {
+
+	g := computedGeometry{
+		parts:      make([][]shp.Point, 0),
+		geographic: geographic,
+	}
+
+	switch shape := s.(type) {
+	case *shp.Point, *shp.PointZ, *shp.PointM:
+		g.vertices = 1
+	case *shp.MultiPoint:
+		g.vertices = len(shape.Points)
+	case *shp.MultiPointZ:
+		g.vertices = len(shape.Points)
+	case *shp.MultiPointM:
+		g.vertices = len(shape.Points)
+	case *shp.PolyLine:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+	case *shp.PolyLineZ:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+	case *shp.PolyLineM:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+	case *shp.Polygon:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+		g.polygon = true
+	case *shp.PolygonZ:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+		g.polygon = true
+	case *shp.PolygonM:
+		g.parts = shapeParts(shape.Parts, shape.Points)
+		g.polygon = true
+	default:
+		return &g
+	}
+
+	g.shape = s
+
+	for _, part := range g.parts {
+		g.vertices += len(part)
+	}
+
+	return &g
+}
+
+// area returns the area of a polygon shape, in square kilometres, with the
+// area of its holes removed.
+
+func (g *computedGeometry) area() interface{} {
+
+	if !g.polygon {
+		return nil
+	}
+
+	area := 0.0
+
+	for _, poly := range groupRings(g.parts) {
+
+		for i, ring := range poly {
+
+			var a float64
+
+			if g.geographic {
+				a = math.Abs(sphericalRingArea(closeRing(ring)))
+			} else {
+				a = math.Abs(ringArea(closeRing(ring)))
+			}
+
+			if i == 0 {
+				area += a
+			} else {
+				area -= a
+			}
+		}
+	}
+
+	return area / 1000000.0
+}
+
+// perimeter returns the length of every ring of a polygon shape, or of every
+// part of a polyline shape, in kilometres.
+
+func (g *computedGeometry) perimeter() interface{} {
+
+	if g.shape == nil || len(g.parts) == 0 {
+		return nil
+	}
+
+	length := 0.0
+
+	for _, part := range g.parts {
+
+		if g.polygon {
+			part = closeRing(part)
+		}
+
+		for i := 1; i < len(part); i++ {
+
+			a := part[i-1]
+			b := part[i]
+
+			if g.geographic {
+				length += geodesicDistance(a.X, a.Y, b.X, b.Y)
+			} else {
+				length += math.Hypot(b.X-a.X, b.Y-a.Y)
+			}
+		}
+	}
+
+	return length / 1000.0
+}
+
+// sphericalRingArea returns the signed area, in square metres, of a closed
+// ring of longitude and latitude coordinates on the authalic sphere. See also:
+// Chamberlain and Duquette, "Some Algorithms for Polygons on a Sphere" (2007).
+// Unlike ringArea clockwise rings are positive.
+
+func sphericalRingArea(pts []shp.Point) float64 {
+
+	area := 0.0
+
+	for i := 0; i < len(pts)-1; i++ {
+
+		lon1 := pts[i].X * math.Pi / 180.0
+		lat1 := pts[i].Y * math.Pi / 180.0
+		lon2 := pts[i+1].X * math.Pi / 180.0
+		lat2 := pts[i+1].Y * math.Pi / 180.0
+
+		area += (lon2 - lon1) * (2.0 + math.Sin(lat1) + math.Sin(lat2))
+	}
+
+	return area * authalic_radius * authalic_radius / 2.0
+}
+
+// geodesicDistance returns the distance, in metres, between two points on the
+// WGS84 ellipsoid using Vincenty's inverse formula, falling back to the
+// great-circle distance on the authalic sphere for (nearly) antipodal points
+// where the formula doesn't converge.
+
+func geodesicDistance(lon1 float64, lat1 float64, lon2 float64, lat2 float64) float64 {
+
+	e := projection.WGS84
+
+	a := e.A
+	f := e.F
+	b := (1.0 - f) * a
+
+	L := (lon2 - lon1) * math.Pi / 180.0
+
+	U1 := math.Atan((1.0 - f) * math.Tan(lat1*math.Pi/180.0))
+	U2 := math.Atan((1.0 - f) * math.Tan(lat2*math.Pi/180.0))
+
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+
+	for i := 0; i < 200; i++ {
+
+		sinLambda, cosLambda := math.Sincos(lambda)
+
+		sinSigma := math.Hypot(cosU2*sinLambda, (cosU1*sinU2)-(sinU1*cosU2*cosLambda))
+
+		if sinSigma == 0.0 {
+			return 0.0
+		}
+
+		cosSigma := (sinU1 * sinU2) + (cosU1 * cosU2 * cosLambda)
+		sigma := math.Atan2(sinSigma, cosSigma)
+
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1.0 - (sinAlpha * sinAlpha)
+
+		// equatorial lines
+		cos2SigmaM := 0.0
+
+		if cos2Alpha != 0.0 {
+			cos2SigmaM = cosSigma - (2.0 * sinU1 * sinU2 / cos2Alpha)
+		}
+
+		C := f / 16.0 * cos2Alpha * (4.0 + f*(4.0-3.0*cos2Alpha))
+
+		prev := lambda
+		lambda = L + (1.0-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1.0+2.0*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-prev) > 1e-12 {
+			continue
+		}
+
+		u2 := cos2Alpha * ((a * a) - (b * b)) / (b * b)
+
+		A := 1.0 + u2/16384.0*(4096.0+u2*(-768.0+u2*(320.0-175.0*u2)))
+		B := u2 / 1024.0 * (256.0 + u2*(-128.0+u2*(74.0-47.0*u2)))
+
+		deltaSigma := B * sinSigma * (cos2SigmaM + B/4.0*(cosSigma*(-1.0+2.0*cos2SigmaM*cos2SigmaM)-B/6.0*cos2SigmaM*(-3.0+4.0*sinSigma*sinSigma)*(-3.0+4.0*cos2SigmaM*cos2SigmaM)))
+
+		return b * A * (sigma - deltaSigma)
+	}
+
+	phi1 := lat1 * math.Pi / 180.0
+	phi2 := lat2 * math.Pi / 180.0
+
+	h := math.Pow(math.Sin((phi2-phi1)/2.0), 2) + math.Cos(phi1)*math.Cos(phi2)*math.Pow(math.Sin(L/2.0), 2)
+	return 2.0 * authalic_radius * math.Asin(math.Min(1.0, math.Sqrt(h)))
+}
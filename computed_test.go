@@ -0,0 +1,199 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// valueEquals returns true if v is nil and expected is NaN or if v is a
+// float64 within tolerance (relative) of expected.
+
+func valueEquals(v interface{}, expected float64, tolerance float64) bool {
+
+	if math.IsNaN(expected) {
+		return v == nil
+	}
+
+	f, ok := v.(float64)
+
+	if !ok {
+		return false
+	}
+
+	return math.Abs(f-expected) <= math.Abs(expected)*tolerance
+}
+
+func TestComputedValues(t *testing.T) {
+
+	// a 1 x 1 degree cell at the equator, wound clockwise the ESRI way
+	cell := &shp.Polygon{
+		NumParts:  1,
+		NumPoints: 5,
+		Parts:     []int32{0},
+		Points:    testRing(0, 0, 0, 1, 1, 1, 1, 0, 0, 0),
+	}
+
+	// 10 x 10 km with a 2 x 2 km hole, in metres
+	holed := &shp.Polygon{
+		NumParts:  2,
+		NumPoints: 10,
+		Parts:     []int32{0, 5},
+		Points: append(
+			testRing(0, 0, 0, 10000, 10000, 10000, 10000, 0, 0, 0),
+			testRing(4000, 4000, 6000, 4000, 6000, 6000, 4000, 6000, 4000, 4000)...,
+		),
+	}
+
+	// along the equator and up the prime meridian
+	equator := &shp.PolyLine{NumParts: 1, NumPoints: 2, Parts: []int32{0}, Points: testRing(0, 0, 1, 0)}
+	meridian := &shp.PolyLine{NumParts: 1, NumPoints: 2, Parts: []int32{0}, Points: testRing(0, 0, 0, 1)}
+
+	nan := math.NaN()
+
+	tests := []struct {
+		label      string
+		shape      shp.Shape
+		geographic bool
+		area       float64
+		perimeter  float64
+	}{
+		// R^2 * 1° (in radians) * sin(1°) on the authalic sphere and
+		// the length of the equator, the 1°N parallel and two 1°
+		// meridian arcs on the WGS84 ellipsoid
+		{"geographic cell", cell, true, 12363.712, 111.319491 + 111.302650 + 2*110.574389},
+		{"projected cell", cell, false, 0.000001, 0.004},
+		{"projected holes", holed, false, 96.0, 48.0},
+		{"geographic equator", equator, true, nan, 111.319491},
+		{"geographic meridian", meridian, true, nan, 110.574389},
+		{"projected line", equator, false, nan, 0.001},
+		{"point", &shp.Point{X: 1, Y: 1}, true, nan, nan},
+		{"null", nil, true, nan, nan},
+	}
+
+	for _, test := range tests {
+
+		values := computedValues([]string{COMPUTED_AREA, COMPUTED_PERIMETER}, test.shape, test.geographic)
+
+		if !valueEquals(values[0], test.area, 1e-5) {
+			t.Errorf("%s: expected an area of %f but got %v", test.label, test.area, values[0])
+		}
+
+		if !valueEquals(values[1], test.perimeter, 1e-5) {
+			t.Errorf("%s: expected a perimeter of %f but got %v", test.label, test.perimeter, values[1])
+		}
+	}
+}
+
+func TestWriterComputed(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "computed")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,1],[0,0]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,10],[0,0]]]}}`,
+	}
+
+	// the second feature is degenerate and written as a Null shape; on
+	// the equator a degree is a * 1° (in radians) wide and
+	// a * ln(tan(45.5°)) high in web mercator
+
+	tests := []struct {
+		label      string
+		projection string
+		area       float64
+		perimeter  float64
+	}{
+		{"geographic", "", 12363.712, 443.770919},
+		{"web mercator", "EPSG:3857", 12392.658, 445.289267},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(root, strings.Replace(test.label, " ", "_", -1)+".shp")
+
+		opts := NewDefaultWriterOptions()
+		opts.NullShapes = true
+		opts.Computed = []string{COMPUTED_AREA, COMPUTED_PERIMETER}
+
+		if test.projection != "" {
+
+			proj, err := projection.NewProjection(test.projection)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts.ShapeOptions.Projection = proj
+		}
+
+		wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range features {
+
+			_, err = wr.AddFeature(testFeature(t, body))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr, err := shp.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := make(map[string]int)
+
+		for i, f := range rdr.Fields() {
+			fields[f.String()] = i
+		}
+
+		for field, expected := range map[string]float64{AREA_FIELD: test.area, PERIMETER_FIELD: test.perimeter} {
+
+			idx, ok := fields[field]
+
+			if !ok {
+				t.Errorf("%s: missing %s field", test.label, field)
+				continue
+			}
+
+			v, err := strconv.ParseFloat(strings.TrimSpace(rdr.ReadAttribute(0, idx)), 64)
+
+			if err != nil || !valueEquals(v, expected, 1e-5) {
+				t.Errorf("%s: expected %s to be %f but got '%s'", test.label, field, expected, rdr.ReadAttribute(0, idx))
+			}
+
+			null := strings.TrimSpace(rdr.ReadAttribute(1, idx))
+
+			if null != "" {
+				t.Errorf("%s: expected %s to be null for a Null shape but got '%s'", test.label, field, null)
+			}
+		}
+
+		rdr.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package shapefile
+
+import (
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"strings"
+)
+
+// ConcordancesSchema writes one (string) column for each of a list of
+// concordance namespaces in wof:concordances, for example "wd:id" (Wikidata)
+// or "gn:id" (GeoNames). A namespace on its own, like "wd", is shorthand for
+// its "id" concordance. Columns are named after their namespace, for example
+// WD_ID or GN_ID, when the writer maps field names (see also DBFFieldName and
+// mapFieldNames). Concordances are written as strings since some of them
+// aren't numbers and others have leading zeros.
+
+type ConcordancesSchema struct {
+	concordances []string
+}
+
+func NewConcordancesSchema(concordances []string) Schema {
+
+	s := ConcordancesSchema{
+		concordances: make([]string, 0),
+	}
+
+	seen := make(map[string]bool)
+
+	for _, c := range concordances {
+
+		c = strings.TrimSpace(c)
+
+		if c == "" {
+			continue
+		}
+
+		if !strings.Contains(c, ":") {
+			c = c + ":id"
+		}
+
+		if seen[c] {
+			continue
+		}
+
+		seen[c] = true
+		s.concordances = append(s.concordances, c)
+	}
+
+	return &s
+}
+
+func (s *ConcordancesSchema) Fields() []SchemaField {
+
+	fields := make([]SchemaField, len(s.concordances))
+
+	for i, c := range s.concordances {
+
+		fields[i] = SchemaField{
+			Property: "wof:concordances." + c,
+			Type:     FIELD_STRING,
+			Size:     64,
+		}
+	}
+
+	return fields
+}
+
+func (s *ConcordancesSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	concordances, err := whosonfirst.Concordances(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, len(s.concordances))
+
+	for i, c := range s.concordances {
+
+		value, ok := concordances[c]
+
+		if ok && value != "" {
+			row[i] = value
+		}
+	}
+
+	return row, nil
+}
@@ -0,0 +1,45 @@
+package shapefile
+
+import (
+	"testing"
+)
+
+func TestConcordancesFieldNames(t *testing.T) {
+
+	concordances := NewConcordancesSchema([]string{"wd", "gn:id", "wd:id", "gp:id"})
+
+	// a property that is named the same as one of the concordances, for
+	// example from an inferred schema
+
+	fields := append(concordances.Fields(), SchemaField{Property: "wd:id", Type: FIELD_STRING, Size: 64})
+
+	fields, err := mapFieldNames(fields, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"WD_ID",
+		"GN_ID",
+		"GP_ID",
+		"WD_ID_1",
+	}
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields but got %d", len(expected), len(fields))
+	}
+
+	for i, name := range expected {
+
+		if fields[i].Name != name {
+			t.Errorf("field %d: expected %s but got %s", i, name, fields[i].Name)
+		}
+	}
+
+	_, err = dbfFields(fields)
+
+	if err != nil {
+		t.Error(err)
+	}
+}
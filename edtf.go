@@ -0,0 +1,364 @@
+package shapefile
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EDTFDate resolves edtf_str, an Extended Date/Time Format string, to a single
+// day. Dates with a year, month or day precision (for example "1984",
+// "1984-06" or "1984-06-01") resolve to the first day of that period and any
+// "?", "~" or "%" qualifiers are ignored. An unspecified month or day (like
+// "1984-XX") is treated as if it had been left out. Intervals, sets, seasons,
+// years with unspecified digits (like "198X") and the "uuuu" placeholder used
+// by Who's On First for unknown dates can not be resolved, in which case the
+// boolean flag is false (see also ParseEDTFRange). See also:
+// https://www.loc.gov/standards/datetime/
+
+func EDTFDate(edtf_str string) (time.Time, bool) {
+
+	lower, _, precision, ok := parseEDTFDay(strings.TrimSpace(edtf_str))
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	switch precision {
+	case EDTF_DAY, EDTF_MONTH, EDTF_YEAR:
+		return lower, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// The precisions of an EDTFRange, from the finest to the coarsest. "unknown"
+// and "open" are used when neither bound of a range is known.
+
+const (
+	EDTF_DAY        = "day"
+	EDTF_MONTH      = "month"
+	EDTF_SEASON     = "season"
+	EDTF_YEAR       = "year"
+	EDTF_DECADE     = "decade"
+	EDTF_CENTURY    = "century"
+	EDTF_MILLENNIUM = "millennium"
+	EDTF_UNKNOWN    = "unknown"
+	EDTF_OPEN       = "open"
+)
+
+var edtf_precisions = []string{
+	EDTF_DAY,
+	EDTF_MONTH,
+	EDTF_SEASON,
+	EDTF_YEAR,
+	EDTF_DECADE,
+	EDTF_CENTURY,
+	EDTF_MILLENNIUM,
+}
+
+// EDTFRange is the range of days an EDTF string may refer to. Lower is the
+// first day and Upper the last day of the range, unless the bound is unknown
+// (for example "uuuu" or "1990/") or open (for example ".." or "1990/..") in
+// which case it is the zero time. Precision is the precision of the date, or
+// of the coarsest date in an interval or a set.
+
+type EDTFRange struct {
+	Lower        time.Time
+	Upper        time.Time
+	Precision    string
+	LowerUnknown bool
+	LowerOpen    bool
+	UpperUnknown bool
+	UpperOpen    bool
+}
+
+// ParseEDTFRange resolves edtf_str to a range of days. In addition to the
+// dates resolved by EDTFDate it handles dates with unspecified digits (like
+// "198X" or "1984-XX"), seasons (like "1984-21"), intervals (like "1990/1995",
+// "1990/.." or "/1995"), sets (like "[1667,1668]" or "{1984..1986}") and the
+// "uuuu" and "open" placeholders used by Who's On First. Years before 0 or
+// after 9999 can not be resolved, in which case the boolean flag is false.
+
+func ParseEDTFRange(edtf_str string) (*EDTFRange, bool) {
+
+	edtf_str = strings.TrimSpace(edtf_str)
+
+	switch edtf_str {
+	case "", "uuuu", "XXXX", "unknown":
+		r := EDTFRange{Precision: EDTF_UNKNOWN, LowerUnknown: true, UpperUnknown: true}
+		return &r, true
+	case "..", "open":
+		r := EDTFRange{Precision: EDTF_OPEN, LowerOpen: true, UpperOpen: true}
+		return &r, true
+	}
+
+	if strings.HasPrefix(edtf_str, "[") || strings.HasPrefix(edtf_str, "{") {
+		return parseEDTFSet(edtf_str)
+	}
+
+	parts := strings.Split(edtf_str, "/")
+
+	if len(parts) > 2 {
+		return nil, false
+	}
+
+	if len(parts) == 1 {
+
+		lower, upper, precision, ok := parseEDTFDay(edtf_str)
+
+		if !ok {
+			return nil, false
+		}
+
+		r := EDTFRange{Lower: lower, Upper: upper, Precision: precision}
+		return &r, true
+	}
+
+	r := EDTFRange{}
+	precisions := make([]string, 0)
+
+	switch parts[0] {
+	case "", "uuuu", "unknown":
+		r.LowerUnknown = true
+	case "..":
+		r.LowerOpen = true
+	default:
+
+		lower, _, precision, ok := parseEDTFDay(parts[0])
+
+		if !ok {
+			return nil, false
+		}
+
+		r.Lower = lower
+		precisions = append(precisions, precision)
+	}
+
+	switch parts[1] {
+	case "", "uuuu", "unknown":
+		r.UpperUnknown = true
+	case "..":
+		r.UpperOpen = true
+	default:
+
+		_, upper, precision, ok := parseEDTFDay(parts[1])
+
+		if !ok {
+			return nil, false
+		}
+
+		r.Upper = upper
+		precisions = append(precisions, precision)
+	}
+
+	r.Precision = coarsestEDTFPrecision(precisions, r.LowerUnknown || r.UpperUnknown)
+	return &r, true
+}
+
+// parseEDTFSet resolves a set of dates (or ranges of dates, like
+// "1984..1986") to the range from the earliest to the latest date.
+
+func parseEDTFSet(edtf_str string) (*EDTFRange, bool) {
+
+	edtf_str = strings.Trim(edtf_str, "[]{}")
+
+	if edtf_str == "" {
+		return nil, false
+	}
+
+	r := EDTFRange{}
+	precisions := make([]string, 0)
+
+	for _, member := range strings.Split(edtf_str, ",") {
+
+		member = strings.TrimSpace(member)
+		bounds := strings.SplitN(member, "..", 2)
+
+		if len(bounds) == 1 {
+			bounds = append(bounds, member)
+		}
+
+		for i, bound := range bounds {
+
+			if bound == "" {
+
+				if i == 0 {
+					r.LowerOpen = true
+				} else {
+					r.UpperOpen = true
+				}
+
+				continue
+			}
+
+			lower, upper, precision, ok := parseEDTFDay(bound)
+
+			if !ok {
+				return nil, false
+			}
+
+			if len(precisions) == 0 || lower.Before(r.Lower) {
+				r.Lower = lower
+			}
+
+			if len(precisions) == 0 || upper.After(r.Upper) {
+				r.Upper = upper
+			}
+
+			precisions = append(precisions, precision)
+		}
+	}
+
+	if r.LowerOpen {
+		r.Lower = time.Time{}
+	}
+
+	if r.UpperOpen {
+		r.Upper = time.Time{}
+	}
+
+	r.Precision = coarsestEDTFPrecision(precisions, false)
+	return &r, true
+}
+
+func coarsestEDTFPrecision(precisions []string, unknown bool) string {
+
+	if len(precisions) == 0 {
+
+		if unknown {
+			return EDTF_UNKNOWN
+		}
+
+		return EDTF_OPEN
+	}
+
+	coarsest := 0
+
+	for _, precision := range precisions {
+
+		for i, candidate := range edtf_precisions {
+
+			if candidate == precision && i > coarsest {
+				coarsest = i
+			}
+		}
+	}
+
+	return edtf_precisions[coarsest]
+}
+
+// parseEDTFDay resolves a single EDTF date, which may have unspecified digits
+// or be a season, to its first and last days and its precision.
+
+func parseEDTFDay(edtf_str string) (time.Time, time.Time, string, bool) {
+
+	var lower time.Time
+	var upper time.Time
+
+	edtf_str = strings.NewReplacer("?", "", "~", "", "%", "").Replace(edtf_str)
+	parts := strings.Split(edtf_str, "-")
+
+	if len(parts) > 3 || len(parts[0]) != 4 {
+		return lower, upper, "", false
+	}
+
+	// unspecified digits can only be at the end of the year, or replace the
+	// whole month or day
+
+	year := strings.TrimRight(parts[0], "X")
+	unspecified := len(parts[0]) - len(year)
+
+	if year == "" || strings.Trim(year, "0123456789") != "" {
+		return lower, upper, "", false
+	}
+
+	for _, part := range parts[1:] {
+
+		if len(part) != 2 || (part != "XX" && strings.Trim(part, "0123456789") != "") {
+			return lower, upper, "", false
+		}
+	}
+
+	y, _ := strconv.Atoi(year)
+
+	for i := 0; i < unspecified; i++ {
+		y = y * 10
+	}
+
+	month := "XX"
+	day := "XX"
+
+	if len(parts) > 1 {
+		month = parts[1]
+	}
+
+	if len(parts) > 2 {
+		day = parts[2]
+	}
+
+	if unspecified > 0 && (month != "XX" || day != "XX") {
+		return lower, upper, "", false
+	}
+
+	if month == "XX" {
+
+		if day != "XX" {
+			return lower, upper, "", false
+		}
+
+		span := 1
+
+		for i := 0; i < unspecified; i++ {
+			span = span * 10
+		}
+
+		lower = time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+		upper = time.Date(y+span, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+
+		precision := edtf_precisions[3+unspecified]
+		return lower, upper, precision, true
+	}
+
+	m, _ := strconv.Atoi(month)
+
+	// seasons (northern hemisphere): 21 spring, 22 summer, 23 autumn and
+	// 24 winter
+
+	if m >= 21 && m <= 24 {
+
+		if day != "XX" {
+			return lower, upper, "", false
+		}
+
+		start := time.Month(3 + ((m - 21) * 3))
+
+		lower = time.Date(y, start, 1, 0, 0, 0, 0, time.UTC)
+		upper = lower.AddDate(0, 3, 0).AddDate(0, 0, -1)
+
+		return lower, upper, EDTF_SEASON, true
+	}
+
+	if m < 1 || m > 12 {
+		return lower, upper, "", false
+	}
+
+	if day == "XX" {
+
+		lower = time.Date(y, time.Month(m), 1, 0, 0, 0, 0, time.UTC)
+		upper = lower.AddDate(0, 1, -1)
+
+		return lower, upper, EDTF_MONTH, true
+	}
+
+	d, _ := strconv.Atoi(day)
+	lower = time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+
+	// time.Date normalizes things like "1984-02-31"
+
+	if lower.Day() != d || int(lower.Month()) != m {
+		return time.Time{}, time.Time{}, "", false
+	}
+
+	return lower, lower, EDTF_DAY, true
+}
@@ -0,0 +1,168 @@
+package shapefile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEDTFDate(t *testing.T) {
+
+	tests := map[string]string{
+		"1984":        "1984-01-01",
+		"1984-06":     "1984-06-01",
+		"1984-06-11":  "1984-06-11",
+		"1984-06-11~": "1984-06-11",
+		"1984?":       "1984-01-01",
+		"1984-06%":    "1984-06-01",
+		" 2004-06 ":   "2004-06-01",
+		"1984-XX":     "1984-01-01",
+		"1984-06-XX":  "1984-06-01",
+		"2000-02-29":  "2000-02-29",
+	}
+
+	for edtf_str, expected := range tests {
+
+		d, ok := EDTFDate(edtf_str)
+
+		if !ok {
+			t.Errorf("failed to resolve '%s'", edtf_str)
+			continue
+		}
+
+		if d.Format("2006-01-02") != expected {
+			t.Errorf("expected '%s' to resolve to %s but got %s", edtf_str, expected, d.Format("2006-01-02"))
+		}
+	}
+
+	invalid := []string{
+		"",
+		"uuuu",
+		"open",
+		"..",
+		"198X",
+		"19XX",
+		"1984-21",
+		"1984-02-31",
+		"1900-02-29",
+		"1984-13",
+		"1984-00",
+		"1984-06-1",
+		"84",
+		"1984/1990",
+		"[1984,1985]",
+		"{1984..1986}",
+		"1984-XX-01",
+		"-0500",
+		"1984-06-01T12:00:00",
+	}
+
+	for _, edtf_str := range invalid {
+
+		_, ok := EDTFDate(edtf_str)
+
+		if ok {
+			t.Errorf("expected '%s' not to resolve", edtf_str)
+		}
+	}
+}
+
+func TestParseEDTFRange(t *testing.T) {
+
+	type expected struct {
+		lower     string
+		upper     string
+		precision string
+	}
+
+	tests := map[string]expected{
+		"1984-06-11":      {"1984-06-11", "1984-06-11", EDTF_DAY},
+		"1984-06~":        {"1984-06-01", "1984-06-30", EDTF_MONTH},
+		"1984-02":         {"1984-02-01", "1984-02-29", EDTF_MONTH},
+		"1984":            {"1984-01-01", "1984-12-31", EDTF_YEAR},
+		"1984-XX":         {"1984-01-01", "1984-12-31", EDTF_YEAR},
+		"1984-06-XX":      {"1984-06-01", "1984-06-30", EDTF_MONTH},
+		"198X":            {"1980-01-01", "1989-12-31", EDTF_DECADE},
+		"19XX":            {"1900-01-01", "1999-12-31", EDTF_CENTURY},
+		"1XXX":            {"1000-01-01", "1999-12-31", EDTF_MILLENNIUM},
+		"1984-21":         {"1984-03-01", "1984-05-31", EDTF_SEASON},
+		"1984-22":         {"1984-06-01", "1984-08-31", EDTF_SEASON},
+		"1984-23":         {"1984-09-01", "1984-11-30", EDTF_SEASON},
+		"1984-24":         {"1984-12-01", "1985-02-28", EDTF_SEASON},
+		"1990/2000-03":    {"1990-01-01", "2000-03-31", EDTF_YEAR},
+		"1990-06-01/1995": {"1990-06-01", "1995-12-31", EDTF_YEAR},
+		"1990/..":         {"1990-01-01", "", EDTF_YEAR},
+		"../1995-06":      {"", "1995-06-30", EDTF_MONTH},
+		"1990/":           {"1990-01-01", "", EDTF_YEAR},
+		"/1995":           {"", "1995-12-31", EDTF_YEAR},
+		"uuuu/1995":       {"", "1995-12-31", EDTF_YEAR},
+		"[1667,1668]":     {"1667-01-01", "1668-12-31", EDTF_YEAR},
+		"{1984..1986}":    {"1984-01-01", "1986-12-31", EDTF_YEAR},
+		"[1760-01,1760]":  {"1760-01-01", "1760-12-31", EDTF_YEAR},
+		"[..1760-12-03]":  {"", "1760-12-03", EDTF_DAY},
+		"[1760-12..]":     {"1760-12-01", "", EDTF_MONTH},
+		"uuuu":            {"", "", EDTF_UNKNOWN},
+		"":                {"", "", EDTF_UNKNOWN},
+		"..":              {"", "", EDTF_OPEN},
+		"open":            {"", "", EDTF_OPEN},
+		"/":               {"", "", EDTF_UNKNOWN},
+		"../..":           {"", "", EDTF_OPEN},
+	}
+
+	format := func(d time.Time) string {
+
+		if d.IsZero() {
+			return ""
+		}
+
+		return d.Format("2006-01-02")
+	}
+
+	for edtf_str, e := range tests {
+
+		r, ok := ParseEDTFRange(edtf_str)
+
+		if !ok {
+			t.Errorf("failed to resolve '%s'", edtf_str)
+			continue
+		}
+
+		if format(r.Lower) != e.lower || format(r.Upper) != e.upper || r.Precision != e.precision {
+			t.Errorf("expected '%s' to resolve to %s, %s (%s) but got %s, %s (%s)", edtf_str, e.lower, e.upper, e.precision, format(r.Lower), format(r.Upper), r.Precision)
+		}
+	}
+
+	r, _ := ParseEDTFRange("1990/..")
+
+	if r.LowerOpen || r.LowerUnknown || !r.UpperOpen || r.UpperUnknown {
+		t.Errorf("expected '1990/..' to only have an open upper bound, %v", r)
+	}
+
+	r, _ = ParseEDTFRange("/1995")
+
+	if !r.LowerUnknown || r.LowerOpen || r.UpperUnknown || r.UpperOpen {
+		t.Errorf("expected '/1995' to only have an unknown lower bound, %v", r)
+	}
+
+	invalid := []string{
+		"1984-02-31",
+		"1984-02-30/1990",
+		"1990/1984-04-31",
+		"[1984,1984-02-31]",
+		"1984-25",
+		"1984-21-01",
+		"198X-06",
+		"1984-13",
+		"1990/1995/2000",
+		"[]",
+		"abcd",
+	}
+
+	for _, edtf_str := range invalid {
+
+		_, ok := ParseEDTFRange(edtf_str)
+
+		if ok {
+			t.Errorf("expected '%s' not to resolve", edtf_str)
+		}
+	}
+}
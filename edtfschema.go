@@ -0,0 +1,151 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"strings"
+	"time"
+)
+
+// EDTFSentinels are the dates written for the bounds of an EDTF range that
+// are unknown (for example "uuuu") or open (for example ".."). A zero time
+// means the bound is left empty.
+
+type EDTFSentinels struct {
+	UnknownLower time.Time
+	UnknownUpper time.Time
+	OpenLower    time.Time
+	OpenUpper    time.Time
+}
+
+// ParseEDTFSentinel parses a pair of sentinel dates expressed as
+// "YYYY-MM-DD,YYYY-MM-DD" (the lower and upper bound) or as a single date used
+// for both bounds. An empty string (or bound) is the zero time.
+
+func ParseEDTFSentinel(str_sentinel string) (time.Time, time.Time, error) {
+
+	var bounds [2]time.Time
+
+	parts := strings.Split(str_sentinel, ",")
+
+	if len(parts) > 2 {
+		msg := fmt.Sprintf("Invalid sentinel '%s', expected 'YYYY-MM-DD' or 'YYYY-MM-DD,YYYY-MM-DD'", str_sentinel)
+		return bounds[0], bounds[1], errors.New(msg)
+	}
+
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+
+	for i, part := range parts {
+
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		t, err := time.Parse("2006-01-02", part)
+
+		if err != nil {
+			msg := fmt.Sprintf("Invalid sentinel date '%s', %s", part, err)
+			return bounds[0], bounds[1], errors.New(msg)
+		}
+
+		bounds[i] = t
+	}
+
+	return bounds[0], bounds[1], nil
+}
+
+// EDTFSchema resolves a feature's edtf:inception and edtf:cessation properties
+// (see also ParseEDTFRange) in to columns for their lower bound (INC_LOWER,
+// CES_LOWER) and upper bound (INC_UPPER, CES_UPPER), written as dates, and
+// their precision (INC_PREC, CES_PREC), for example "day", "year" or
+// "unknown". Bounds that are unknown or open are written using Sentinels and
+// values that can't be resolved are left empty.
+
+type EDTFSchema struct {
+	Sentinels EDTFSentinels
+}
+
+func NewEDTFSchema(sentinels EDTFSentinels) Schema {
+
+	s := EDTFSchema{
+		Sentinels: sentinels,
+	}
+
+	return &s
+}
+
+func (s *EDTFSchema) Fields() []SchemaField {
+
+	fields := make([]SchemaField, 0)
+
+	for _, prefix := range []string{"INC", "CES"} {
+
+		property := "edtf:inception"
+
+		if prefix == "CES" {
+			property = "edtf:cessation"
+		}
+
+		fields = append(fields,
+			SchemaField{Name: prefix + "_LOWER", Property: property + ".lower", Type: FIELD_DATE},
+			SchemaField{Name: prefix + "_UPPER", Property: property + ".upper", Type: FIELD_DATE},
+			SchemaField{Name: prefix + "_PREC", Property: property + ".precision", Type: FIELD_STRING, Size: 10},
+		)
+	}
+
+	return fields
+}
+
+func (s *EDTFSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	row := make([]interface{}, 0)
+
+	for _, edtf_str := range []string{whosonfirst.Inception(f), whosonfirst.Cessation(f)} {
+
+		r, ok := ParseEDTFRange(edtf_str)
+
+		if !ok {
+			row = append(row, nil, nil, nil)
+			continue
+		}
+
+		var lower interface{} = r.Lower
+		var upper interface{} = r.Upper
+
+		switch {
+		case r.LowerUnknown:
+			lower = sentinelValue(s.Sentinels.UnknownLower)
+		case r.LowerOpen:
+			lower = sentinelValue(s.Sentinels.OpenLower)
+		}
+
+		switch {
+		case r.UpperUnknown:
+			upper = sentinelValue(s.Sentinels.UnknownUpper)
+		case r.UpperOpen:
+			upper = sentinelValue(s.Sentinels.OpenUpper)
+		}
+
+		row = append(row, lower, upper, r.Precision)
+	}
+
+	return row, nil
+}
+
+// sentinelValue returns t or nil if t is the zero time (meaning the bound is
+// left empty) or can't be written as a DBF date.
+
+func sentinelValue(t time.Time) interface{} {
+
+	if t.IsZero() || t.Year() < 0 || t.Year() > 9999 {
+		return nil
+	}
+
+	return t
+}
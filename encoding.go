@@ -0,0 +1,432 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The character encodings that text attributes can be written in. "utf-8" is
+// the default. "iso-8859-1" (Latin-1) and "cp1252" (Windows-1252) are legacy
+// encodings for older tools that don't read the .cpg file. Characters that
+// can't be represented in a legacy encoding are transliterated, for example
+// "Ł" becomes "L", or replaced with "?" (see also Writer.Transliterated and
+// Writer.Replaced).
+
+const (
+	ENCODING_UTF8   = "utf-8"
+	ENCODING_LATIN1 = "iso-8859-1"
+	ENCODING_CP1252 = "cp1252"
+)
+
+func Encodings() []string {
+
+	return []string{
+		ENCODING_CP1252,
+		ENCODING_LATIN1,
+		ENCODING_UTF8,
+	}
+}
+
+func IsValidEncoding(test string) bool {
+
+	valid := false
+
+	for _, encoding := range Encodings() {
+
+		if encoding == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The character used in place of characters that can't be represented in the
+// writer's encoding and have no transliteration.
+
+const ENCODING_REPLACEMENT = '?'
+
+// dbfEncoding describes how an encoding is recorded, as the contents of the
+// .cpg file and the language driver ID (byte 29 of the DBF header), and how
+// runes are encoded. encode is nil for UTF-8.
+
+type dbfEncoding struct {
+	code_page       string
+	language_driver byte
+	encode          func(r rune) (byte, bool)
+}
+
+var dbf_encodings = map[string]dbfEncoding{
+	ENCODING_UTF8: dbfEncoding{
+		code_page:       "UTF-8",
+		language_driver: 0x00,
+	},
+	ENCODING_LATIN1: dbfEncoding{
+		code_page:       "88591",
+		language_driver: 0x57,
+		encode:          encodeLatin1,
+	},
+	ENCODING_CP1252: dbfEncoding{
+		code_page:       "1252",
+		language_driver: 0x03,
+		encode:          encodeCP1252,
+	},
+}
+
+func encodeLatin1(r rune) (byte, bool) {
+
+	if r < 0x100 {
+		return byte(r), true
+	}
+
+	return 0, false
+}
+
+// The characters that Windows-1252 assigns to bytes 0x80 - 0x9F. All other
+// bytes are the same as Latin-1.
+
+var cp1252_extras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+func encodeCP1252(r rune) (byte, bool) {
+
+	if r < 0x80 || (r >= 0xA0 && r < 0x100) {
+		return byte(r), true
+	}
+
+	b, ok := cp1252_extras[r]
+	return b, ok
+}
+
+// Transliterations for characters that aren't part of Latin-1 or
+// Windows-1252: Latin letters with diacritics (other than those in Latin-1)
+// and common punctuation.
+
+var transliterations = map[rune]string{
+	'Ā': "A", 'ā': "a", 'Ă': "A", 'ă': "a", 'Ą': "A", 'ą': "a", 'Ć': "C", 'ć': "c",
+	'Ĉ': "C", 'ĉ': "c", 'Ċ': "C", 'ċ': "c", 'Č': "C", 'č': "c", 'Ď': "D", 'ď': "d",
+	'Đ': "D", 'đ': "d", 'Ē': "E", 'ē': "e", 'Ĕ': "E", 'ĕ': "e", 'Ė': "E", 'ė': "e",
+	'Ę': "E", 'ę': "e", 'Ě': "E", 'ě': "e", 'Ĝ': "G", 'ĝ': "g", 'Ğ': "G", 'ğ': "g",
+	'Ġ': "G", 'ġ': "g", 'Ģ': "G", 'ģ': "g", 'Ĥ': "H", 'ĥ': "h", 'Ħ': "H", 'ħ': "h",
+	'Ĩ': "I", 'ĩ': "i", 'Ī': "I", 'ī': "i", 'Ĭ': "I", 'ĭ': "i", 'Į': "I", 'į': "i",
+	'İ': "I", 'ı': "i", 'Ĳ': "IJ", 'ĳ': "ij", 'Ĵ': "J", 'ĵ': "j", 'Ķ': "K", 'ķ': "k",
+	'ĸ': "k", 'Ĺ': "L", 'ĺ': "l", 'Ļ': "L", 'ļ': "l", 'Ľ': "L", 'ľ': "l", 'Ł': "L",
+	'ł': "l", 'Ń': "N", 'ń': "n", 'Ņ': "N", 'ņ': "n", 'Ň': "N", 'ň': "n", 'Ŋ': "N",
+	'ŋ': "n", 'Ō': "O", 'ō': "o", 'Ŏ': "O", 'ŏ': "o", 'Ő': "O", 'ő': "o", 'Œ': "OE",
+	'œ': "oe", 'Ŕ': "R", 'ŕ': "r", 'Ŗ': "R", 'ŗ': "r", 'Ř': "R", 'ř': "r", 'Ś': "S",
+	'ś': "s", 'Ŝ': "S", 'ŝ': "s", 'Ş': "S", 'ş': "s", 'Š': "S", 'š': "s", 'Ţ': "T",
+	'ţ': "t", 'Ť': "T", 'ť': "t", 'Ŧ': "T", 'ŧ': "t", 'Ũ': "U", 'ũ': "u", 'Ū': "U",
+	'ū': "u", 'Ŭ': "U", 'ŭ': "u", 'Ů': "U", 'ů': "u", 'Ű': "U", 'ű': "u", 'Ų': "U",
+	'ų': "u", 'Ŵ': "W", 'ŵ': "w", 'Ŷ': "Y", 'ŷ': "y", 'Ÿ': "Y", 'Ź': "Z", 'ź': "z",
+	'Ż': "Z", 'ż': "z", 'Ž': "Z", 'ž': "z", 'ſ': "s", 'ƀ': "b", 'Ɖ': "D", 'ƒ': "f",
+	'Ɨ': "I", 'Ơ': "O", 'ơ': "o", 'Ư': "U", 'ư': "u", 'Ƶ': "Z", 'ƶ': "z", 'Ǆ': "DZ",
+	'ǅ': "Dz", 'ǆ': "dz", 'Ǉ': "LJ", 'ǈ': "Lj", 'ǉ': "lj", 'Ǌ': "NJ", 'ǋ': "Nj", 'ǌ': "nj",
+	'Ǎ': "A", 'ǎ': "a", 'Ǐ': "I", 'ǐ': "i", 'Ǒ': "O", 'ǒ': "o", 'Ǔ': "U", 'ǔ': "u",
+	'Ǖ': "U", 'ǖ': "u", 'Ǘ': "U", 'ǘ': "u", 'Ǚ': "U", 'ǚ': "u", 'Ǜ': "U", 'ǜ': "u",
+	'Ǟ': "A", 'ǟ': "a", 'Ǡ': "A", 'ǡ': "a", 'Ǣ': "Æ", 'ǣ': "æ", 'Ǥ': "G", 'ǥ': "g",
+	'Ǧ': "G", 'ǧ': "g", 'Ǩ': "K", 'ǩ': "k", 'Ǫ': "O", 'ǫ': "o", 'Ǭ': "O", 'ǭ': "o",
+	'ǰ': "j", 'Ǳ': "DZ", 'ǲ': "Dz", 'ǳ': "dz", 'Ǵ': "G", 'ǵ': "g", 'Ǹ': "N", 'ǹ': "n",
+	'Ǻ': "A", 'ǻ': "a", 'Ǽ': "Æ", 'ǽ': "æ", 'Ǿ': "Ø", 'ǿ': "ø", 'Ȁ': "A", 'ȁ': "a",
+	'Ȃ': "A", 'ȃ': "a", 'Ȅ': "E", 'ȅ': "e", 'Ȇ': "E", 'ȇ': "e", 'Ȉ': "I", 'ȉ': "i",
+	'Ȋ': "I", 'ȋ': "i", 'Ȍ': "O", 'ȍ': "o", 'Ȏ': "O", 'ȏ': "o", 'Ȑ': "R", 'ȑ': "r",
+	'Ȓ': "R", 'ȓ': "r", 'Ȕ': "U", 'ȕ': "u", 'Ȗ': "U", 'ȗ': "u", 'Ș': "S", 'ș': "s",
+	'Ț': "T", 'ț': "t", 'Ȟ': "H", 'ȟ': "h", 'Ȧ': "A", 'ȧ': "a", 'Ȩ': "E", 'ȩ': "e",
+	'Ȫ': "O", 'ȫ': "o", 'Ȭ': "O", 'ȭ': "o", 'Ȯ': "O", 'ȯ': "o", 'Ȱ': "O", 'ȱ': "o",
+	'Ȳ': "Y", 'ȳ': "y", 'Ƀ': "B", 'Ɇ': "E", 'ɇ': "e", 'Ɍ': "R", 'ɍ': "r", 'Ɏ': "Y",
+	'ɏ': "y", 'Ḁ': "A", 'ḁ': "a", 'Ḃ': "B", 'ḃ': "b", 'Ḅ': "B", 'ḅ': "b", 'Ḇ': "B",
+	'ḇ': "b", 'Ḉ': "C", 'ḉ': "c", 'Ḋ': "D", 'ḋ': "d", 'Ḍ': "D", 'ḍ': "d", 'Ḏ': "D",
+	'ḏ': "d", 'Ḑ': "D", 'ḑ': "d", 'Ḓ': "D", 'ḓ': "d", 'Ḕ': "E", 'ḕ': "e", 'Ḗ': "E",
+	'ḗ': "e", 'Ḙ': "E", 'ḙ': "e", 'Ḛ': "E", 'ḛ': "e", 'Ḝ': "E", 'ḝ': "e", 'Ḟ': "F",
+	'ḟ': "f", 'Ḡ': "G", 'ḡ': "g", 'Ḣ': "H", 'ḣ': "h", 'Ḥ': "H", 'ḥ': "h", 'Ḧ': "H",
+	'ḧ': "h", 'Ḩ': "H", 'ḩ': "h", 'Ḫ': "H", 'ḫ': "h", 'Ḭ': "I", 'ḭ': "i", 'Ḯ': "I",
+	'ḯ': "i", 'Ḱ': "K", 'ḱ': "k", 'Ḳ': "K", 'ḳ': "k", 'Ḵ': "K", 'ḵ': "k", 'Ḷ': "L",
+	'ḷ': "l", 'Ḹ': "L", 'ḹ': "l", 'Ḻ': "L", 'ḻ': "l", 'Ḽ': "L", 'ḽ': "l", 'Ḿ': "M",
+	'ḿ': "m", 'Ṁ': "M", 'ṁ': "m", 'Ṃ': "M", 'ṃ': "m", 'Ṅ': "N", 'ṅ': "n", 'Ṇ': "N",
+	'ṇ': "n", 'Ṉ': "N", 'ṉ': "n", 'Ṋ': "N", 'ṋ': "n", 'Ṍ': "O", 'ṍ': "o", 'Ṏ': "O",
+	'ṏ': "o", 'Ṑ': "O", 'ṑ': "o", 'Ṓ': "O", 'ṓ': "o", 'Ṕ': "P", 'ṕ': "p", 'Ṗ': "P",
+	'ṗ': "p", 'Ṙ': "R", 'ṙ': "r", 'Ṛ': "R", 'ṛ': "r", 'Ṝ': "R", 'ṝ': "r", 'Ṟ': "R",
+	'ṟ': "r", 'Ṡ': "S", 'ṡ': "s", 'Ṣ': "S", 'ṣ': "s", 'Ṥ': "S", 'ṥ': "s", 'Ṧ': "S",
+	'ṧ': "s", 'Ṩ': "S", 'ṩ': "s", 'Ṫ': "T", 'ṫ': "t", 'Ṭ': "T", 'ṭ': "t", 'Ṯ': "T",
+	'ṯ': "t", 'Ṱ': "T", 'ṱ': "t", 'Ṳ': "U", 'ṳ': "u", 'Ṵ': "U", 'ṵ': "u", 'Ṷ': "U",
+	'ṷ': "u", 'Ṹ': "U", 'ṹ': "u", 'Ṻ': "U", 'ṻ': "u", 'Ṽ': "V", 'ṽ': "v", 'Ṿ': "V",
+	'ṿ': "v", 'Ẁ': "W", 'ẁ': "w", 'Ẃ': "W", 'ẃ': "w", 'Ẅ': "W", 'ẅ': "w", 'Ẇ': "W",
+	'ẇ': "w", 'Ẉ': "W", 'ẉ': "w", 'Ẋ': "X", 'ẋ': "x", 'Ẍ': "X", 'ẍ': "x", 'Ẏ': "Y",
+	'ẏ': "y", 'Ẑ': "Z", 'ẑ': "z", 'Ẓ': "Z", 'ẓ': "z", 'Ẕ': "Z", 'ẕ': "z", 'ẖ': "h",
+	'ẗ': "t", 'ẘ': "w", 'ẙ': "y", 'ẛ': "s", 'Ạ': "A", 'ạ': "a", 'Ả': "A", 'ả': "a",
+	'Ấ': "A", 'ấ': "a", 'Ầ': "A", 'ầ': "a", 'Ẩ': "A", 'ẩ': "a", 'Ẫ': "A", 'ẫ': "a",
+	'Ậ': "A", 'ậ': "a", 'Ắ': "A", 'ắ': "a", 'Ằ': "A", 'ằ': "a", 'Ẳ': "A", 'ẳ': "a",
+	'Ẵ': "A", 'ẵ': "a", 'Ặ': "A", 'ặ': "a", 'Ẹ': "E", 'ẹ': "e", 'Ẻ': "E", 'ẻ': "e",
+	'Ẽ': "E", 'ẽ': "e", 'Ế': "E", 'ế': "e", 'Ề': "E", 'ề': "e", 'Ể': "E", 'ể': "e",
+	'Ễ': "E", 'ễ': "e", 'Ệ': "E", 'ệ': "e", 'Ỉ': "I", 'ỉ': "i", 'Ị': "I", 'ị': "i",
+	'Ọ': "O", 'ọ': "o", 'Ỏ': "O", 'ỏ': "o", 'Ố': "O", 'ố': "o", 'Ồ': "O", 'ồ': "o",
+	'Ổ': "O", 'ổ': "o", 'Ỗ': "O", 'ỗ': "o", 'Ộ': "O", 'ộ': "o", 'Ớ': "O", 'ớ': "o",
+	'Ờ': "O", 'ờ': "o", 'Ở': "O", 'ở': "o", 'Ỡ': "O", 'ỡ': "o", 'Ợ': "O", 'ợ': "o",
+	'Ụ': "U", 'ụ': "u", 'Ủ': "U", 'ủ': "u", 'Ứ': "U", 'ứ': "u", 'Ừ': "U", 'ừ': "u",
+	'Ử': "U", 'ử': "u", 'Ữ': "U", 'ữ': "u", 'Ự': "U", 'ự': "u", 'Ỳ': "Y", 'ỳ': "y",
+	'Ỵ': "Y", 'ỵ': "y", 'Ỷ': "Y", 'ỷ': "y", 'Ỹ': "Y", 'ỹ': "y",
+
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'", '“': "\"", '”': "\"", '„': "\"",
+	'‟': "\"", '″': "\"", '‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-",
+	'…': "...", '•': "*", '€': "EUR", '™': "TM", '‹': "<", '›': ">", 'ˆ': "^", '˜': "~",
+	'\u2002': " ", '\u2003': " ", '\u2009': " ", '\u202f': " ",
+}
+
+// textReport records how a value was changed by encodeText.
+
+type textReport struct {
+	Transliterated bool
+	Replaced       bool
+	Truncated      bool
+}
+
+// encodeText encodes str, a UTF-8 string, using enc and truncates the result
+// to at most size bytes without splitting a character (or a transliteration).
+// go-shp writes strings as is and drops (rather than truncates) values that
+// are wider than their field.
+
+func encodeText(str string, enc dbfEncoding, size int) (string, textReport) {
+
+	report := textReport{}
+	buf := make([]byte, 0, len(str))
+
+	for i, w := 0, 0; i < len(str); i += w {
+
+		r, rune_width := utf8.DecodeRuneInString(str[i:])
+		w = rune_width
+
+		var chunk []byte
+
+		switch {
+
+		case r == utf8.RuneError && w == 1:
+
+			chunk = []byte{ENCODING_REPLACEMENT}
+			report.Replaced = true
+
+		case enc.encode == nil:
+
+			chunk = []byte(str[i : i+w])
+
+		default:
+
+			b, ok := enc.encode(r)
+
+			if ok {
+				chunk = []byte{b}
+				break
+			}
+
+			// combining marks are dropped, so "é" becomes "e"
+
+			if unicode.Is(unicode.Mn, r) {
+				report.Transliterated = true
+				continue
+			}
+
+			chunk, ok = transliterate(r, enc)
+
+			if ok {
+				report.Transliterated = true
+				break
+			}
+
+			chunk = []byte{ENCODING_REPLACEMENT}
+			report.Replaced = true
+		}
+
+		if len(buf)+len(chunk) > size {
+			report.Truncated = true
+			break
+		}
+
+		buf = append(buf, chunk...)
+	}
+
+	return string(buf), report
+}
+
+func transliterate(r rune, enc dbfEncoding) ([]byte, bool) {
+
+	str, ok := transliterations[r]
+
+	if !ok {
+		return nil, false
+	}
+
+	chunk := make([]byte, 0, len(str))
+
+	for _, tr := range str {
+
+		b, ok := enc.encode(tr)
+
+		if !ok {
+			return nil, false
+		}
+
+		chunk = append(chunk, b)
+	}
+
+	return chunk, true
+}
+
+// writeAttribute writes value to field idx of record i. Text values are
+// encoded using the writer's encoding and truncated to the width of the
+// field, in which case the full value is kept for the writer's overflow table
+// (see also flushOverflow).
+
+func (wr *Writer) writeAttribute(i int, idx int, value interface{}) {
+
+	str_value, ok := value.(string)
+
+	if ok && wr.fields[idx].Type == FIELD_STRING {
+
+		encoded, report := encodeText(str_value, wr.encoding, int(wr.fields[idx].Size))
+		name := wr.fields[idx].Name
+
+		if report.Transliterated {
+			wr.transliterated += 1
+			wr.Logger.Debug("Transliterated %s for record %d, '%s'", name, i, str_value)
+		}
+
+		if report.Replaced {
+			wr.replaced += 1
+			wr.Logger.Debug("Replaced characters in %s for record %d, '%s'", name, i, str_value)
+		}
+
+		if report.Truncated {
+			wr.truncated += 1
+
+			if wr.overflow != nil {
+				wr.pending = append(wr.pending, overflowValue{Field: name, Value: str_value})
+			}
+
+			wr.Logger.Debug("Truncated %s for record %d to %d bytes", name, i, wr.fields[idx].Size)
+		}
+
+		// go-shp only writes as many bytes as there are in the value,
+		// leaving the rest of the field as NUL bytes, so pad it with
+		// spaces the way the DBF spec expects
+
+		if len(encoded) < int(wr.fields[idx].Size) {
+			encoded += strings.Repeat(" ", int(wr.fields[idx].Size)-len(encoded))
+		}
+
+		value = encoded
+	}
+
+	err := wr.shapewriter.WriteAttribute(i, idx, value)
+
+	if err != nil {
+		wr.Logger.Warning("Failed to write %s for record %d because %s", wr.fields[idx].Name, i, err)
+	}
+}
+
+// Transliterated returns the number of text values with characters that were
+// transliterated because they can't be represented in the writer's encoding.
+
+func (wr *Writer) Transliterated() int64 {
+
+	transliterated := wr.transliterated
+
+	for _, child := range wr.writers {
+		transliterated += child.transliterated
+	}
+
+	return transliterated
+}
+
+// Replaced returns the number of text values with characters that were
+// replaced with ENCODING_REPLACEMENT because they can't be represented in the
+// writer's encoding and have no transliteration.
+
+func (wr *Writer) Replaced() int64 {
+
+	replaced := wr.replaced
+
+	for _, child := range wr.writers {
+		replaced += child.replaced
+	}
+
+	return replaced
+}
+
+// Truncated returns the number of text values that were truncated to fit the
+// width of their field.
+
+func (wr *Writer) Truncated() int64 {
+
+	truncated := wr.truncated
+
+	for _, child := range wr.writers {
+		truncated += child.truncated
+	}
+
+	return truncated
+}
+
+// WriteCodePageFile writes a .cpg file naming the encoding of the DBF file's
+// text attributes.
+
+func (wr *Writer) WriteCodePageFile() error {
+
+	cpg_path := strings.Replace(wr.path, ".shp", ".cpg", -1)
+
+	fh, err := os.OpenFile(cpg_path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fh.Write([]byte(wr.encoding.code_page))
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
+
+// patchLanguageDriver sets the language driver ID (byte 29 of the header) of
+// the DBF file, which go-shp always leaves as 0, to the one for the writer's
+// encoding. This needs to happen after the shapewriter has been closed.
+
+func (wr *Writer) patchLanguageDriver() error {
+
+	if wr.encoding.language_driver == 0x00 {
+		return nil
+	}
+
+	dbf_path := strings.Replace(wr.path, ".shp", ".dbf", -1)
+
+	fh, err := os.OpenFile(dbf_path, os.O_RDWR, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fh.Seek(29, io.SeekStart)
+
+	if err == nil {
+		err = binary.Write(fh, binary.LittleEndian, wr.encoding.language_driver)
+	}
+
+	if err != nil {
+		fh.Close()
+		msg := fmt.Sprintf("Failed to set language driver for %s because %s", dbf_path, err)
+		return errors.New(msg)
+	}
+
+	return fh.Close()
+}
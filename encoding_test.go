@@ -0,0 +1,154 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEncodeText(t *testing.T) {
+
+	tests := []struct {
+		label          string
+		value          string
+		encoding       string
+		size           int
+		expected       string
+		transliterated bool
+		replaced       bool
+		truncated      bool
+	}{
+		{"utf-8", "Montréal", ENCODING_UTF8, 64, "Montréal", false, false, false},
+		{"utf-8 truncated", "Montréal", ENCODING_UTF8, 5, "Montr", false, false, true},
+		{"utf-8 truncated mid-rune", "Montréal", ENCODING_UTF8, 6, "Montr", false, false, true},
+		{"utf-8 truncated multibyte", "日本語", ENCODING_UTF8, 7, "日本", false, false, true},
+		{"utf-8 invalid", "a\xffb", ENCODING_UTF8, 64, "a?b", false, true, false},
+		{"iso-8859-1", "Montréal", ENCODING_LATIN1, 64, "Montr\xe9al", false, false, false},
+		{"iso-8859-1 truncated", "Montréal", ENCODING_LATIN1, 6, "Montr\xe9", false, false, true},
+		{"iso-8859-1 transliterated", "Łódź", ENCODING_LATIN1, 64, "L\xf3dz", true, false, false},
+		{"iso-8859-1 combining mark", "Montréal", ENCODING_LATIN1, 64, "Montreal", true, false, false},
+		{"iso-8859-1 euro", "€5", ENCODING_LATIN1, 64, "EUR5", true, false, false},
+		{"iso-8859-1 replaced", "東京 Tokyo", ENCODING_LATIN1, 64, "?? Tokyo", false, true, false},
+		{"iso-8859-1 truncated transliteration", "Œuvre", ENCODING_LATIN1, 1, "", true, false, true},
+		{"cp1252", "€5 “quoted”", ENCODING_CP1252, 64, "\x805 \x93quoted\x94", false, false, false},
+		{"cp1252 transliterated", "Şanlıurfa", ENCODING_CP1252, 64, "Sanliurfa", true, false, false},
+		{"cp1252 replaced", "Москва", ENCODING_CP1252, 64, "??????", false, true, false},
+	}
+
+	for _, test := range tests {
+
+		encoded, report := encodeText(test.value, dbf_encodings[test.encoding], test.size)
+
+		if encoded != test.expected {
+			t.Errorf("%s: expected '%q' but got '%q'", test.label, test.expected, encoded)
+		}
+
+		if len(encoded) > test.size {
+			t.Errorf("%s: expected at most %d bytes but got %d", test.label, test.size, len(encoded))
+		}
+
+		if test.encoding == ENCODING_UTF8 && !utf8.ValidString(encoded) {
+			t.Errorf("%s: '%q' is not valid UTF-8", test.label, encoded)
+		}
+
+		if report.Transliterated != test.transliterated || report.Replaced != test.replaced || report.Truncated != test.truncated {
+			t.Errorf("%s: unexpected report %+v", test.label, report)
+		}
+	}
+}
+
+func TestWriterEncoding(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "encoding")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		encoding        string
+		code_page       string
+		language_driver byte
+		name            string
+	}{
+		{ENCODING_UTF8, "UTF-8", 0x00, "Łódź"},
+		{ENCODING_LATIN1, "88591", 0x57, "L\xf3dz"},
+		{ENCODING_CP1252, "1252", 0x03, "L\xf3dz"},
+	}
+
+	body := `{"type":"Feature","properties":{"wof:id":1,"wof:name":"Łódź","wof:placetype":"locality","wof:repo":"whosonfirst-data","wof:parent_id":-1,"wof:hierarchy":[],"geom:latitude":51.77,"geom:longitude":19.45,"geom:bbox":"19.45,51.77,19.45,51.77"},"geometry":{"type":"Point","coordinates":[19.45,51.77]}}`
+
+	for _, test := range tests {
+
+		path := filepath.Join(root, test.encoding+".shp")
+
+		opts := NewDefaultWriterOptions()
+		opts.Encoding = test.encoding
+
+		wr, err := NewWriterWithOptions(path, shp.POINT, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := feature.NewWOFFeature([]byte(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = wr.AddFeature(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cpg, err := ioutil.ReadFile(strings.TrimSuffix(path, ".shp") + ".cpg")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(cpg) != test.code_page {
+			t.Errorf("%s: expected a code page of '%s' but got '%s'", test.encoding, test.code_page, cpg)
+		}
+
+		dbf, err := ioutil.ReadFile(strings.TrimSuffix(path, ".shp") + ".dbf")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dbf[29] != test.language_driver {
+			t.Errorf("%s: expected a language driver of 0x%02x but got 0x%02x", test.encoding, test.language_driver, dbf[29])
+		}
+
+		rdr, err := shp.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr.Next()
+		name := strings.TrimSpace(rdr.ReadAttribute(0, 1))
+
+		rdr.Close()
+
+		if name != test.name {
+			t.Errorf("%s: expected a name of '%q' but got '%q'", test.encoding, test.name, name)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package shapefile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Formats for the sidecar file that maps each DBF field back to the property
+// it was derived from. The file is written alongside the shapefile with a
+// ".fields.csv" or ".fields.json" extension.
+
+const (
+	FIELD_MAP_CSV  = "csv"
+	FIELD_MAP_JSON = "json"
+	FIELD_MAP_NONE = "none"
+)
+
+func FieldMapFormats() []string {
+
+	return []string{
+		FIELD_MAP_CSV,
+		FIELD_MAP_JSON,
+		FIELD_MAP_NONE,
+	}
+}
+
+func IsValidFieldMapFormat(test string) bool {
+
+	valid := false
+
+	for _, format := range FieldMapFormats() {
+
+		if format == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The prefixes of properties that DBFFieldName names after their key rather
+// than their full path, which would otherwise all truncate to the same name.
+
+var nested_field_prefixes = []string{
+	"wof:concordances.",
+	"wof:hierarchy.",
+}
+
+// DBFFieldName derives a DBF field name from a property path, for example
+// "wof:parent_id" becomes "WOF_PARENT" and "name:eng_x_preferred" becomes
+// "NAME_ENG_X". Characters other than ASCII letters and digits are replaced
+// with underscores and the result is truncated to 10 characters. Properties
+// nested in one of nested_field_prefixes are named after their key, so
+// "wof:concordances.wd:id" becomes "WD_ID" and "wof:hierarchy.borough_id"
+// becomes "BOROUGH_ID". The name is not guaranteed to be unique, see also:
+// SchemaField.Property.
+
+func DBFFieldName(property string) string {
+
+	property = strings.TrimPrefix(property, "properties.")
+
+	for _, prefix := range nested_field_prefixes {
+		property = strings.TrimPrefix(property, prefix)
+	}
+
+	var b strings.Builder
+
+	for _, r := range strings.ToUpper(property) {
+
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			continue
+		}
+
+		if !strings.HasSuffix(b.String(), "_") {
+			b.WriteRune('_')
+		}
+	}
+
+	name := strings.Trim(b.String(), "_")
+
+	if name == "" {
+		name = "FIELD"
+	}
+
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "F" + name
+	}
+
+	return truncateFieldName(name, 10)
+}
+
+func truncateFieldName(name string, length int) string {
+
+	if len(name) <= length {
+		return name
+	}
+
+	return strings.TrimRight(name[0:length], "_")
+}
+
+// mapFieldNames returns a copy of fields with overrides applied and with a
+// unique name derived from the property of each field that doesn't already
+// have a name. Overrides are keyed by property or, for fields without one, by
+// name. Names that collide are given a numeric suffix, for example
+// "NAME_ENG_1".
+
+func mapFieldNames(fields []SchemaField, overrides map[string]string) ([]SchemaField, error) {
+
+	mapped := make([]SchemaField, len(fields))
+	used := make(map[string]bool)
+
+	for i, field := range fields {
+
+		key := field.Property
+
+		if key == "" {
+			key = field.Name
+		}
+
+		name, ok := overrides[key]
+
+		if ok {
+			field.Name = name
+		}
+
+		if field.Name != "" {
+			used[strings.ToUpper(field.Name)] = true
+		}
+
+		mapped[i] = field
+	}
+
+	for i, field := range mapped {
+
+		if field.Name != "" {
+			continue
+		}
+
+		if field.Property == "" {
+			msg := fmt.Sprintf("Field %d has neither a name nor a property", i)
+			return nil, errors.New(msg)
+		}
+
+		mapped[i].Name = uniqueFieldName(DBFFieldName(field.Property), used)
+	}
+
+	return mapped, nil
+}
+
+// uniqueFieldName returns base, or base with a numeric suffix if base is
+// already in used, and adds it to used.
+
+func uniqueFieldName(base string, used map[string]bool) string {
+
+	name := base
+
+	for n := 1; used[name]; n++ {
+		suffix := "_" + strconv.Itoa(n)
+		name = truncateFieldName(base, 10-len(suffix)) + suffix
+	}
+
+	used[name] = true
+	return name
+}
+
+type fieldMapping struct {
+	Name      string `json:"name"`
+	Property  string `json:"property"`
+	Type      string `json:"type"`
+	Size      uint8  `json:"size"`
+	Precision uint8  `json:"precision"`
+}
+
+// WriteFieldMap writes a sidecar file, in the writer's field map format, that
+// lists the name, source property, type, size and precision of each DBF
+// field.
+
+func (wr *Writer) WriteFieldMap() error {
+
+	format := wr.options.FieldMap
+
+	if format == FIELD_MAP_NONE || format == "" {
+		return nil
+	}
+
+	if !IsValidFieldMapFormat(format) {
+		return errors.New("Invalid field map format")
+	}
+
+	mappings := make([]fieldMapping, len(wr.fields))
+
+	for i, field := range wr.fields {
+
+		size := field.Size
+
+		switch field.Type {
+		case FIELD_DATE:
+			size = 8
+		case FIELD_LOGICAL:
+			size = 1
+		}
+
+		mappings[i] = fieldMapping{
+			Name:      field.Name,
+			Property:  field.Property,
+			Type:      string(field.Type),
+			Size:      size,
+			Precision: field.Precision,
+		}
+	}
+
+	map_path := strings.Replace(wr.path, ".shp", ".fields."+format, -1)
+
+	fh, err := os.OpenFile(map_path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if format == FIELD_MAP_JSON {
+
+		enc := json.NewEncoder(fh)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(mappings)
+
+	} else {
+
+		csv_wr := csv.NewWriter(fh)
+		csv_wr.Write([]string{"name", "property", "type", "size", "precision"})
+
+		for _, m := range mappings {
+
+			row := []string{
+				m.Name,
+				m.Property,
+				m.Type,
+				strconv.Itoa(int(m.Size)),
+				strconv.Itoa(int(m.Precision)),
+			}
+
+			csv_wr.Write(row)
+		}
+
+		csv_wr.Flush()
+		err = csv_wr.Error()
+	}
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
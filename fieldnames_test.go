@@ -0,0 +1,217 @@
+package shapefile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/jonas-p/go-shp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDBFFieldName(t *testing.T) {
+
+	tests := map[string]string{
+		"wof:parent_id":              "WOF_PARENT",
+		"name:eng_x_preferred":       "NAME_ENG_X",
+		"properties.wof:name":        "WOF_NAME",
+		"geom:area":                  "GEOM_AREA",
+		"src:geom":                   "SRC_GEOM",
+		"lbl:latitude":               "LBL_LATITU",
+		"mz:is_current":              "MZ_IS_CURR",
+		"123abc":                     "F123ABC",
+		"::":                         "FIELD",
+		"wof:hierarchy.borough_id":   "BOROUGH_ID",
+		"wof:concordances.gn:id":     "GN_ID",
+		"name:fra_x_variant.0":       "NAME_FRA_X",
+		"wof:name_translated_really": "WOF_NAME_T",
+	}
+
+	for property, expected := range tests {
+
+		name := DBFFieldName(property)
+
+		if name != expected {
+			t.Errorf("expected %s to be named %s but got %s", property, expected, name)
+		}
+	}
+}
+
+func TestUniqueFieldName(t *testing.T) {
+
+	used := map[string]bool{
+		"NAME_ENG_X": true,
+	}
+
+	tests := []struct {
+		base     string
+		expected string
+	}{
+		{"NAME_ENG_X", "NAME_ENG_1"},
+		{"NAME_ENG_X", "NAME_ENG_2"},
+		{"NAME_FRA_X", "NAME_FRA_X"},
+		{"ID", "ID"},
+		{"ID", "ID_1"},
+	}
+
+	for _, test := range tests {
+
+		name := uniqueFieldName(test.base, used)
+
+		if name != test.expected {
+			t.Errorf("expected %s to be named %s but got %s", test.base, test.expected, name)
+		}
+	}
+}
+
+func TestMapFieldNames(t *testing.T) {
+
+	fields := []SchemaField{
+		SchemaField{Property: "name:eng_x_preferred", Type: FIELD_STRING, Size: 8},
+		SchemaField{Name: "NAME_ENG_X", Type: FIELD_STRING, Size: 8},
+		SchemaField{Property: "name:eng_x_variant", Type: FIELD_STRING, Size: 8},
+		SchemaField{Name: "ID", Property: "wof:id", Type: FIELD_NUMBER, Size: 19},
+		SchemaField{Property: "wof:parent_id", Type: FIELD_NUMBER, Size: 19},
+	}
+
+	overrides := map[string]string{
+		"wof:parent_id": "PARENT_ID",
+	}
+
+	mapped, err := mapFieldNames(fields, overrides)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"NAME_ENG_1",
+		"NAME_ENG_X",
+		"NAME_ENG_2",
+		"ID",
+		"PARENT_ID",
+	}
+
+	for i, field := range mapped {
+
+		if field.Name != expected[i] {
+			t.Errorf("field %d: expected %s but got %s", i, expected[i], field.Name)
+		}
+	}
+
+	if fields[0].Name != "" {
+		t.Error("expected the original fields to be left unchanged")
+	}
+
+	_, err = mapFieldNames([]SchemaField{SchemaField{Type: FIELD_STRING, Size: 1}}, nil)
+
+	if err == nil {
+		t.Error("expected a field without a name or property to be rejected")
+	}
+}
+
+func TestWriteFieldMap(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "fieldmap")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	sf := &SchemaFile{
+		Fields: []SchemaFileField{
+			{Path: "properties.name:eng_x_preferred", Type: "string", Size: 32},
+			{Path: "properties.name:eng_x_variant", Type: "string", Size: 32},
+			{Path: "properties.wof:parent_id", Type: "number", Size: 19},
+			{Path: "properties.geom:area", Type: "float", Size: 19, Precision: 10},
+		},
+	}
+
+	file_schema, err := NewFileSchemaFromSchemaFile(sf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"name", "property", "type", "size", "precision"},
+		{"ID", "wof:id", "N", "19", "0"},
+		{"NAME", "wof:name", "C", "64", "0"},
+		{"PLACETYPE", "wof:placetype", "C", "64", "0"},
+		{"INCEPTION", "edtf:inception", "D", "8", "0"},
+		{"CESSATION", "edtf:cessation", "D", "8", "0"},
+		{"NAME_ENG_X", "name:eng_x_preferred", "C", "32", "0"},
+		{"NAME_ENG_1", "name:eng_x_variant", "C", "32", "0"},
+		{"PARENT", "wof:parent_id", "N", "19", "0"},
+		{"GEOM_AREA", "geom:area", "F", "19", "10"},
+	}
+
+	for _, format := range []string{FIELD_MAP_CSV, FIELD_MAP_JSON} {
+
+		path := filepath.Join(root, format+".shp")
+
+		opts := NewDefaultWriterOptions()
+		opts.Schema = NewMultiSchema(NewDefaultSchema(), file_schema)
+		opts.FieldNames = map[string]string{"wof:parent_id": "PARENT"}
+		opts.FieldMap = format
+
+		wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fh, err := os.Open(strings.TrimSuffix(path, ".shp") + ".fields." + format)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows := make([][]string, 0)
+
+		if format == FIELD_MAP_CSV {
+
+			rows, err = csv.NewReader(fh).ReadAll()
+
+		} else {
+
+			var mappings []fieldMapping
+			err = json.NewDecoder(fh).Decode(&mappings)
+
+			rows = append(rows, expected[0])
+
+			for _, m := range mappings {
+				rows = append(rows, []string{m.Name, m.Property, m.Type, strconv.Itoa(int(m.Size)), strconv.Itoa(int(m.Precision))})
+			}
+		}
+
+		fh.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) != len(expected) {
+			t.Errorf("%s: expected %d rows but got %v", format, len(expected), rows)
+			continue
+		}
+
+		for i, row := range rows {
+
+			if strings.Join(row, ",") != strings.Join(expected[i], ",") {
+				t.Errorf("%s: expected row %d to be %v but got %v", format, i, expected[i], row)
+			}
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"math"
+)
+
+// newPolygon returns a shp.Polygon record for rings, which are assumed
+// to already be closed and oriented according to the ESRI spec.
+
+func newPolygon(rings [][]shp.Point) *shp.Polygon {
+
+	// shp.Polygon is just a shp.PolyLine so let go-shp do the work of
+	// calculating part offsets and the bounding box
+
+	pl := shp.NewPolyLine(rings)
+	poly := shp.Polygon(*pl)
+
+	return &poly
+}
+
+// closeRing ensures that the last point in pts is the same as the first.
+
+func closeRing(pts []shp.Point) []shp.Point {
+
+	if len(pts) == 0 {
+		return pts
+	}
+
+	first := pts[0]
+	last := pts[len(pts)-1]
+
+	if first.X != last.X || first.Y != last.Y {
+		pts = append(pts, first)
+	}
+
+	return pts
+}
+
+// ringArea returns the signed area of a closed ring using the shoelace
+// formula. Counter-clockwise rings are positive, clockwise rings negative.
+
+func ringArea(pts []shp.Point) float64 {
+
+	area := 0.0
+
+	for i := 0; i < len(pts)-1; i++ {
+		area += (pts[i].X * pts[i+1].Y) - (pts[i+1].X * pts[i].Y)
+	}
+
+	return area / 2.0
+}
+
+func isClockwise(pts []shp.Point) bool {
+	return ringArea(pts) < 0.0
+}
+
+// orientRing returns pts wound clockwise (if clockwise is true) or
+// counter-clockwise, reversing a copy of the ring as necessary.
+
+func orientRing(pts []shp.Point, clockwise bool) []shp.Point {
+
+	if isClockwise(pts) == clockwise {
+		return pts
+	}
+
+	return reverseRing(pts)
+}
+
+func reverseRing(pts []shp.Point) []shp.Point {
+
+	count := len(pts)
+	reversed := make([]shp.Point, count)
+
+	for i, pt := range pts {
+		reversed[count-1-i] = pt
+	}
+
+	return reversed
+}
+
+// linesForGeometry returns one list of points for every line or ring in
+// the GeoJSON geometry g. Point geometries can not be represented as lines
+// and will trigger an error.
+
+func linesForGeometry(g gjson.Result) ([][]shp.Point, error) {
+
+	t := g.Get("type").String()
+
+	if t == "GeometryCollection" {
+
+		lines := make([][]shp.Point, 0)
+
+		for _, child := range g.Get("geometries").Array() {
+
+			child_lines, err := linesForGeometry(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			lines = append(lines, child_lines...)
+		}
+
+		return lines, nil
+	}
+
+	coords := g.Get("coordinates")
+
+	if !coords.Exists() {
+		return nil, errors.New("Missing coordinates")
+	}
+
+	lines := make([][]shp.Point, 0)
+
+	switch t {
+
+	case "LineString":
+
+		pts, err := pointsForPositions(coords)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, pts)
+
+	case "MultiLineString", "Polygon":
+
+		for _, c := range coords.Array() {
+
+			pts, err := pointsForPositions(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			lines = append(lines, pts)
+		}
+
+	case "MultiPolygon":
+
+		for _, poly := range coords.Array() {
+
+			for _, c := range poly.Array() {
+
+				pts, err := pointsForPositions(c)
+
+				if err != nil {
+					return nil, err
+				}
+
+				lines = append(lines, pts)
+			}
+		}
+
+	default:
+		msg := fmt.Sprintf("Geometry type '%s' can not be represented as lines", t)
+		return nil, errors.New(msg)
+	}
+
+	return lines, nil
+}
+
+// pointsForPositions returns a list of points for a GeoJSON array of
+// positions, or an error if any of the positions are invalid.
+
+func pointsForPositions(r gjson.Result) ([]shp.Point, error) {
+
+	if !r.IsArray() {
+		return nil, errors.New("Invalid coordinates, expected a list of positions")
+	}
+
+	positions := r.Array()
+	pts := make([]shp.Point, len(positions))
+
+	for i, p := range positions {
+
+		pt, err := pointForPosition(p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pts[i] = pt
+	}
+
+	return pts, nil
+}
+
+// pointForPosition returns a point for a GeoJSON position ([lon, lat, ...])
+// or an error if the position is not a list of at least two numbers or they
+// are not a valid longitude and latitude.
+
+func pointForPosition(r gjson.Result) (shp.Point, error) {
+
+	var pt shp.Point
+
+	if !r.IsArray() {
+		return pt, errors.New("Invalid position, expected a list of numbers")
+	}
+
+	coords := r.Array()
+
+	if len(coords) < 2 {
+		return pt, errors.New("Invalid position, expected at least two coordinates")
+	}
+
+	if coords[0].Type != gjson.Number || coords[1].Type != gjson.Number {
+		return pt, errors.New("Invalid position, coordinates must be numbers")
+	}
+
+	pt.X = coords[0].Float()
+	pt.Y = coords[1].Float()
+
+	if math.IsNaN(pt.X) || math.IsNaN(pt.Y) || math.IsInf(pt.X, 0) || math.IsInf(pt.Y, 0) {
+		return pt, errors.New("Invalid position, coordinates must be finite numbers")
+	}
+
+	if pt.X < -180.0 || pt.X > 180.0 || pt.Y < -90.0 || pt.Y > 90.0 {
+		return pt, errors.New("Invalid position, coordinates are out of range")
+	}
+
+	return pt, nil
+}
+
+// pointsForGeometry returns every vertex in the GeoJSON geometry g. The
+// closing vertex of polygon rings is omitted since it is always a copy of
+// the first vertex.
+
+func pointsForGeometry(g gjson.Result) ([]shp.Point, error) {
+
+	t := g.Get("type").String()
+
+	if t == "GeometryCollection" {
+
+		points := make([]shp.Point, 0)
+
+		for _, child := range g.Get("geometries").Array() {
+
+			child_points, err := pointsForGeometry(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			points = append(points, child_points...)
+		}
+
+		return points, nil
+	}
+
+	coords := g.Get("coordinates")
+
+	if !coords.Exists() {
+		return nil, errors.New("Missing coordinates")
+	}
+
+	switch t {
+
+	case "Point":
+
+		pt, err := pointForPosition(coords)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []shp.Point{pt}, nil
+
+	case "MultiPoint", "LineString":
+
+		return pointsForPositions(coords)
+
+	case "MultiLineString", "Polygon", "MultiPolygon":
+
+		lines, err := linesForGeometry(g)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points := make([]shp.Point, 0)
+
+		for _, pts := range lines {
+
+			if t != "MultiLineString" {
+				pts = openRing(pts)
+			}
+
+			points = append(points, pts...)
+		}
+
+		return points, nil
+
+	default:
+		msg := fmt.Sprintf("Invalid geometry type '%s'", t)
+		return nil, errors.New(msg)
+	}
+}
+
+// distinctPoints returns each unique point in pts once, preserving the
+// order in which they were first encountered.
+
+func distinctPoints(pts []shp.Point) []shp.Point {
+
+	seen := make(map[shp.Point]bool)
+	distinct := make([]shp.Point, 0)
+
+	for _, pt := range pts {
+
+		if seen[pt] {
+			continue
+		}
+
+		seen[pt] = true
+		distinct = append(distinct, pt)
+	}
+
+	return distinct
+}
+
+// openRing returns pts without its closing vertex, if present.
+
+func openRing(pts []shp.Point) []shp.Point {
+
+	count := len(pts)
+
+	if count > 1 && pts[0] == pts[count-1] {
+		return pts[0 : count-1]
+	}
+
+	return pts
+}
+
+// polygonsForGeometry returns the list of polygons, each of which is a list
+// of rings with the exterior ring first, in the GeoJSON geometry g.
+
+func polygonsForGeometry(g gjson.Result) ([][][]shp.Point, error) {
+
+	t := g.Get("type").String()
+
+	if t == "GeometryCollection" {
+
+		polys := make([][][]shp.Point, 0)
+
+		for _, child := range g.Get("geometries").Array() {
+
+			child_polys, err := polygonsForGeometry(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			polys = append(polys, child_polys...)
+		}
+
+		return polys, nil
+	}
+
+	coords := g.Get("coordinates")
+
+	if !coords.Exists() {
+		return nil, errors.New("Missing coordinates")
+	}
+
+	polys := make([][][]shp.Point, 0)
+
+	switch t {
+
+	case "Polygon":
+
+		rings, err := ringsForPositions(coords)
+
+		if err != nil {
+			return nil, err
+		}
+
+		polys = append(polys, rings)
+
+	case "MultiPolygon":
+
+		for _, c := range coords.Array() {
+
+			rings, err := ringsForPositions(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			polys = append(polys, rings)
+		}
+
+	default:
+		msg := fmt.Sprintf("Geometry type '%s' can not be represented as polygons", t)
+		return nil, errors.New(msg)
+	}
+
+	return polys, nil
+}
+
+func ringsForPositions(r gjson.Result) ([][]shp.Point, error) {
+
+	if !r.IsArray() {
+		return nil, errors.New("Invalid coordinates, expected a list of rings")
+	}
+
+	rings := make([][]shp.Point, 0)
+
+	for _, c := range r.Array() {
+
+		pts, err := pointsForPositions(c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rings = append(rings, pts)
+	}
+
+	if len(rings) == 0 {
+		return nil, errors.New("Invalid polygon, no rings")
+	}
+
+	return rings, nil
+}
@@ -0,0 +1,39 @@
+package shapefile
+
+import (
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestPointForPosition(t *testing.T) {
+
+	tests := []struct {
+		position string
+		ok       bool
+	}{
+		{`[-73.5,45.5]`, true},
+		{`[-180,-90,100]`, true},
+		{`[180,90]`, true},
+		{`[0]`, false},
+		{`["0","0"]`, false},
+		{`0`, false},
+		{`[180.5,0]`, false},
+		{`[0,90.5]`, false},
+		{`[1e400,0]`, false},
+		{`[0,-1e400]`, false},
+		{`[NaN,0]`, false},
+	}
+
+	for _, test := range tests {
+
+		_, err := pointForPosition(gjson.Parse(test.position))
+
+		if test.ok && err != nil {
+			t.Errorf("%s: %s", test.position, err)
+		}
+
+		if !test.ok && err == nil {
+			t.Errorf("expected %s to fail", test.position)
+		}
+	}
+}
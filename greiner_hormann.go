@@ -0,0 +1,494 @@
+package shapefile
+
+// Greiner, G. and Hormann, K. 1998. "Efficient clipping of arbitrary polygons"
+// https://www.inf.usi.ch/hormann/papers/Greiner.1998.ECO.pdf
+
+import (
+	"github.com/jonas-p/go-shp"
+	"math"
+)
+
+const (
+	gh_intersection = iota
+	gh_difference
+)
+
+// the tolerance used to detect degenerate intersections (where a vertex of
+// one ring lies on, or very near, an edge of the other ring)
+
+const gh_epsilon = 1e-12
+
+// rings narrower than this are considered to be artifacts of nudging
+// degenerate rings (see clipRings)
+
+const gh_sliver_width = 1e-9
+
+// the angle (in radians) between the directions that degenerate rings are
+// nudged in on successive attempts (see clipRings)
+
+const gh_nudge_angle = 2.399963
+
+type ghNode struct {
+	pt        shp.Point
+	next      *ghNode
+	prev      *ghNode
+	neighbour *ghNode
+	intersect bool
+	entry     bool
+	visited   bool
+	alpha     float64
+}
+
+func newGHList(ring []shp.Point) *ghNode {
+
+	ring = openRing(ring)
+
+	var first *ghNode
+	var last *ghNode
+
+	for _, pt := range ring {
+
+		n := &ghNode{pt: pt}
+
+		if first == nil {
+			first = n
+		} else {
+			last.next = n
+			n.prev = last
+		}
+
+		last = n
+	}
+
+	last.next = first
+	first.prev = last
+
+	return first
+}
+
+func (n *ghNode) nextVertex() *ghNode {
+
+	c := n
+
+	for c.intersect {
+		c = c.next
+	}
+
+	return c
+}
+
+// insertBetween inserts the intersection node i between the (non-intersection)
+// nodes a and b, sorted by alpha
+
+func (i *ghNode) insertBetween(a *ghNode, b *ghNode) {
+
+	c := a
+
+	for c.next != b && c.next.alpha < i.alpha {
+		c = c.next
+	}
+
+	i.next = c.next
+	i.prev = c
+	c.next.prev = i
+	c.next = i
+}
+
+// clipRings returns the result of clipping the subject ring by the clip ring
+// using op (gh_intersection or gh_difference). The second value is false if
+// the rings do not intersect at all in which case the caller is expected to
+// resolve containment itself. If the rings are still degenerate after being
+// nudged (see below) the error is ErrDegenerateClip.
+
+func clipRings(subject []shp.Point, clip []shp.Point, op int) ([][]shp.Point, bool, error) {
+
+	// degenerate cases are handled by nudging the subject ring by an
+	// infinitesimal amount, in a different direction each time so that
+	// vertices on a clip edge parallel to the nudge don't stay on it, and
+	// trying again. Any nudged vertices that survive are snapped back to
+	// their original position afterwards and any slivers left over from
+	// edges that were shared by both rings are discarded.
+
+	current := subject
+	snap := make(map[shp.Point]shp.Point)
+
+	var rings [][]shp.Point
+	var intersected bool
+	var degenerate bool
+
+	for attempt := 0; attempt <= 5; attempt++ {
+
+		rings, intersected, degenerate = clipRingsOnce(current, clip, op)
+
+		if !degenerate {
+			break
+		}
+
+		offset := 1e-10 * float64(attempt+1)
+		dy, dx := math.Sincos(gh_nudge_angle * float64(attempt+1))
+
+		current = make([]shp.Point, len(subject))
+
+		for i, pt := range subject {
+			nudged := shp.Point{X: pt.X + (offset * dx), Y: pt.Y + (offset * dy)}
+			current[i] = nudged
+			snap[nudged] = pt
+		}
+	}
+
+	if degenerate {
+		return nil, false, ErrDegenerateClip
+	}
+
+	if !intersected {
+		return rings, false, nil
+	}
+
+	cleaned := make([][]shp.Point, 0)
+
+	for _, ring := range rings {
+
+		for i, pt := range ring {
+
+			orig, ok := snap[pt]
+
+			if ok {
+				ring[i] = orig
+			}
+		}
+
+		ring = closeRing(dedupePoints(openRing(ring)))
+
+		if len(ring) < 4 || isSliver(ring) {
+			continue
+		}
+
+		cleaned = append(cleaned, ring)
+	}
+
+	return cleaned, true, nil
+}
+
+// isSliver returns true if the average width of ring (its area divided by
+// its perimeter) is less than gh_sliver_width.
+
+func isSliver(ring []shp.Point) bool {
+
+	perimeter := ringPerimeter(ring)
+
+	if perimeter == 0.0 {
+		return true
+	}
+
+	return math.Abs(ringArea(ring))/perimeter < gh_sliver_width
+}
+
+func ringPerimeter(ring []shp.Point) float64 {
+
+	perimeter := 0.0
+
+	for i := 1; i < len(ring); i++ {
+		perimeter += math.Hypot(ring[i].X-ring[i-1].X, ring[i].Y-ring[i-1].Y)
+	}
+
+	return perimeter
+}
+
+func clipRingsOnce(subject []shp.Point, clip []shp.Point, op int) ([][]shp.Point, bool, bool) {
+
+	if len(openRing(subject)) < 3 || len(openRing(clip)) < 3 {
+		return nil, false, false
+	}
+
+	s_first := newGHList(subject)
+	c_first := newGHList(clip)
+
+	// phase one: find and insert all the intersections
+
+	count := 0
+
+	s := s_first
+
+	for {
+
+		s_next := s.next.nextVertex()
+		c := c_first
+
+		for {
+
+			c_next := c.next.nextVertex()
+
+			a, b, ok, degenerate := segmentIntersection(s.pt, s_next.pt, c.pt, c_next.pt)
+
+			if degenerate {
+				return nil, false, true
+			}
+
+			if ok {
+
+				// intersections are measured along the clip edge
+				// (which is never nudged) and snapped to either
+				// end of it if they are close enough. Vertical and
+				// horizontal clip edges (bounding boxes, the
+				// antimeridian) are handled explicitly to avoid
+				// rounding errors along long edges.
+
+				pt := shp.Point{
+					X: c.pt.X + b*(c_next.pt.X-c.pt.X),
+					Y: c.pt.Y + b*(c_next.pt.Y-c.pt.Y),
+				}
+
+				if c.pt.X == c_next.pt.X {
+					pt = shp.Point{X: c.pt.X, Y: s.pt.Y + a*(s_next.pt.Y-s.pt.Y)}
+				} else if c.pt.Y == c_next.pt.Y {
+					pt = shp.Point{X: s.pt.X + a*(s_next.pt.X-s.pt.X), Y: c.pt.Y}
+				}
+
+				if math.Hypot(pt.X-c.pt.X, pt.Y-c.pt.Y) < gh_sliver_width {
+					pt = c.pt
+				} else if math.Hypot(pt.X-c_next.pt.X, pt.Y-c_next.pt.Y) < gh_sliver_width {
+					pt = c_next.pt
+				}
+
+				i1 := &ghNode{pt: pt, intersect: true, alpha: a}
+				i2 := &ghNode{pt: pt, intersect: true, alpha: b}
+
+				i1.neighbour = i2
+				i2.neighbour = i1
+
+				i1.insertBetween(s, s_next)
+				i2.insertBetween(c, c_next)
+
+				count += 1
+			}
+
+			c = c_next
+
+			if c == c_first {
+				break
+			}
+		}
+
+		s = s_next
+
+		if s == s_first {
+			break
+		}
+	}
+
+	if count == 0 {
+		return nil, false, false
+	}
+
+	// phase two: mark intersections as entry or exit points
+
+	s_forwards := true
+	c_forwards := true
+
+	if op == gh_difference {
+		s_forwards = false
+	}
+
+	if pointInRing(s_first.pt, clip) {
+		s_forwards = !s_forwards
+	}
+
+	if pointInRing(c_first.pt, subject) {
+		c_forwards = !c_forwards
+	}
+
+	for n := s_first; ; {
+
+		if n.intersect {
+			n.entry = s_forwards
+			s_forwards = !s_forwards
+		}
+
+		n = n.next
+
+		if n == s_first {
+			break
+		}
+	}
+
+	for n := c_first; ; {
+
+		if n.intersect {
+			n.entry = c_forwards
+			c_forwards = !c_forwards
+		}
+
+		n = n.next
+
+		if n == c_first {
+			break
+		}
+	}
+
+	// phase three: walk the lists to build the resultant rings
+
+	rings := make([][]shp.Point, 0)
+
+	for {
+
+		var start *ghNode
+
+		for n := s_first; ; {
+
+			if n.intersect && !n.visited {
+				start = n
+				break
+			}
+
+			n = n.next
+
+			if n == s_first {
+				break
+			}
+		}
+
+		if start == nil {
+			break
+		}
+
+		ring := make([]shp.Point, 0)
+		current := start
+
+		for {
+
+			current.visited = true
+			current.neighbour.visited = true
+
+			ring = append(ring, current.pt)
+
+			if current.entry {
+
+				for {
+					current = current.next
+					ring = append(ring, current.pt)
+
+					if current.intersect {
+						break
+					}
+				}
+
+			} else {
+
+				for {
+					current = current.prev
+					ring = append(ring, current.pt)
+
+					if current.intersect {
+						break
+					}
+				}
+			}
+
+			current.visited = true
+			current = current.neighbour
+
+			if current.visited {
+				break
+			}
+		}
+
+		ring = closeRing(dedupePoints(ring))
+
+		if len(ring) >= 4 {
+			rings = append(rings, ring)
+		}
+	}
+
+	return rings, true, false
+}
+
+// segmentIntersection returns the (relative) positions along p1,p2 and q1,q2
+// where the two segments intersect. The fourth value is true if the segments
+// touch at one of their end points or overlap.
+
+func segmentIntersection(p1 shp.Point, p2 shp.Point, q1 shp.Point, q2 shp.Point) (float64, float64, bool, bool) {
+
+	rx := p2.X - p1.X
+	ry := p2.Y - p1.Y
+	sx := q2.X - q1.X
+	sy := q2.Y - q1.Y
+
+	d := rx*sy - ry*sx
+
+	qpx := q1.X - p1.X
+	qpy := q1.Y - p1.Y
+
+	if math.Abs(d) < gh_epsilon {
+
+		// parallel, check for collinear overlap
+
+		if math.Abs(qpx*ry-qpy*rx) < gh_epsilon {
+
+			rr := rx*rx + ry*ry
+
+			if rr == 0.0 {
+				return 0.0, 0.0, false, false
+			}
+
+			t0 := (qpx*rx + qpy*ry) / rr
+			t1 := t0 + (sx*rx+sy*ry)/rr
+
+			if math.Max(t0, t1) >= 0.0 && math.Min(t0, t1) <= 1.0 {
+				return 0.0, 0.0, false, true
+			}
+		}
+
+		return 0.0, 0.0, false, false
+	}
+
+	a := (qpx*sy - qpy*sx) / d
+	b := (qpx*ry - qpy*rx) / d
+
+	if a < -gh_epsilon || a > 1.0+gh_epsilon || b < -gh_epsilon || b > 1.0+gh_epsilon {
+		return 0.0, 0.0, false, false
+	}
+
+	if a < gh_epsilon || a > 1.0-gh_epsilon || b < gh_epsilon || b > 1.0-gh_epsilon {
+		return 0.0, 0.0, false, true
+	}
+
+	return a, b, true, false
+}
+
+// pointInRing returns true if pt is inside ring using the even-odd rule
+
+func pointInRing(pt shp.Point, ring []shp.Point) bool {
+
+	inside := false
+	count := len(ring)
+
+	for i, j := 0, count-1; i < count; j, i = i, i+1 {
+
+		a := ring[i]
+		b := ring[j]
+
+		if (a.Y > pt.Y) != (b.Y > pt.Y) && pt.X < (b.X-a.X)*(pt.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// dedupePoints removes consecutive duplicate points from pts
+
+func dedupePoints(pts []shp.Point) []shp.Point {
+
+	deduped := make([]shp.Point, 0)
+
+	for i, pt := range pts {
+
+		if i > 0 && pt == pts[i-1] {
+			continue
+		}
+
+		deduped = append(deduped, pt)
+	}
+
+	return deduped
+}
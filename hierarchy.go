@@ -0,0 +1,316 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"sort"
+	"strings"
+)
+
+// The name of the DBF field used to record the number of hierarchies a feature
+// has.
+
+const HIERARCHY_COUNT_FIELD = "HIER_COUNT"
+
+// Strategies for choosing which of a feature's hierarchies to flatten. "first"
+// uses the first hierarchy in wof:hierarchy. "parent" uses the first hierarchy
+// that contains the feature's wof:parent_id, or the first hierarchy if none
+// of them do.
+
+const (
+	HIERARCHY_FIRST  = "first"
+	HIERARCHY_PARENT = "parent"
+)
+
+func HierarchyStrategies() []string {
+
+	return []string{
+		HIERARCHY_FIRST,
+		HIERARCHY_PARENT,
+	}
+}
+
+func IsValidHierarchyStrategy(test string) bool {
+
+	valid := false
+
+	for _, strategy := range HierarchyStrategies() {
+
+		if strategy == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The order of hierarchy columns, from the coarsest placetype to the finest.
+// Placetypes that aren't listed here follow, sorted by name.
+
+var hierarchy_placetypes = []string{
+	"planet",
+	"continent",
+	"ocean",
+	"marinearea",
+	"empire",
+	"country",
+	"dependency",
+	"disputed",
+	"macroregion",
+	"region",
+	"macrocounty",
+	"county",
+	"localadmin",
+	"metroarea",
+	"locality",
+	"borough",
+	"macrohood",
+	"neighbourhood",
+	"microhood",
+	"campus",
+	"postalcode",
+	"timezone",
+	"building",
+	"address",
+	"venue",
+}
+
+// HierarchySchema flattens one of a feature's hierarchies (wof:hierarchy) in to
+// an integer column for each placetype, for example COUNTRY_ID or REGION_ID,
+// followed by a HIER_COUNT column with the number of hierarchies the feature
+// has. Which hierarchy is flattened is determined by Strategy. Columns are
+// named after their placetype, abbreviated if necessary, so the locality_id
+// column is LOCALIT_ID (see also hierarchyFieldName).
+//
+// If no placetypes are given then a column is added for each placetype found
+// by ExpandFromFeature (see also ExpandableSchema).
+
+type HierarchySchema struct {
+	Strategy   string
+	placetypes []string
+	expand     bool
+	seen       map[string]bool
+}
+
+func NewHierarchySchema(placetypes []string, strategy string) (*HierarchySchema, error) {
+
+	if !IsValidHierarchyStrategy(strategy) {
+		msg := fmt.Sprintf("Invalid hierarchy strategy '%s'", strategy)
+		return nil, errors.New(msg)
+	}
+
+	s := HierarchySchema{
+		Strategy:   strategy,
+		placetypes: make([]string, 0),
+		expand:     len(placetypes) == 0,
+		seen:       make(map[string]bool),
+	}
+
+	for _, pt := range placetypes {
+
+		pt = strings.TrimSuffix(strings.TrimSpace(pt), "_id")
+
+		if pt == "" || s.seen[pt] {
+			continue
+		}
+
+		s.seen[pt] = true
+		s.placetypes = append(s.placetypes, pt)
+	}
+
+	s.sortPlacetypes()
+
+	return &s, nil
+}
+
+func (s *HierarchySchema) NeedsExpanding() bool {
+	return s.expand
+}
+
+// ExpandFromFeature adds a column for each placetype in f's hierarchies that
+// isn't already a column.
+
+func (s *HierarchySchema) ExpandFromFeature(f geojson.Feature) {
+
+	if !s.expand {
+		return
+	}
+
+	added := false
+
+	for _, h := range whosonfirst.Hierarchies(f) {
+
+		for k, _ := range h {
+
+			pt := strings.TrimSuffix(k, "_id")
+
+			if s.seen[pt] {
+				continue
+			}
+
+			s.seen[pt] = true
+			s.placetypes = append(s.placetypes, pt)
+			added = true
+		}
+	}
+
+	if added {
+		s.sortPlacetypes()
+	}
+}
+
+func (s *HierarchySchema) sortPlacetypes() {
+
+	rank := func(pt string) int {
+
+		for i, candidate := range hierarchy_placetypes {
+
+			if candidate == pt {
+				return i
+			}
+		}
+
+		return len(hierarchy_placetypes)
+	}
+
+	sort.SliceStable(s.placetypes, func(i, j int) bool {
+
+		ri := rank(s.placetypes[i])
+		rj := rank(s.placetypes[j])
+
+		if ri != rj {
+			return ri < rj
+		}
+
+		return s.placetypes[i] < s.placetypes[j]
+	})
+}
+
+func (s *HierarchySchema) Fields() []SchemaField {
+
+	fields := make([]SchemaField, 0)
+
+	for _, pt := range s.placetypes {
+
+		field := SchemaField{
+			Name:     hierarchyFieldName(pt),
+			Property: "wof:hierarchy." + pt + "_id",
+			Type:     FIELD_NUMBER,
+			Size:     19,
+		}
+
+		fields = append(fields, field)
+	}
+
+	count := SchemaField{
+		Name:     HIERARCHY_COUNT_FIELD,
+		Property: "wof:hierarchy",
+		Type:     FIELD_NUMBER,
+		Size:     4,
+	}
+
+	fields = append(fields, count)
+
+	return fields
+}
+
+func (s *HierarchySchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	hierarchies := whosonfirst.Hierarchies(f)
+
+	row := make([]interface{}, len(s.placetypes)+1)
+
+	if len(hierarchies) > 0 {
+
+		h := hierarchies[0]
+
+		if s.Strategy == HIERARCHY_PARENT {
+
+			parent_id := whosonfirst.ParentId(f)
+
+			for _, candidate := range hierarchies {
+
+				if hierarchyContains(candidate, parent_id) {
+					h = candidate
+					break
+				}
+			}
+		}
+
+		for i, pt := range s.placetypes {
+
+			id, ok := h[pt+"_id"]
+
+			if ok {
+				row[i] = id
+			}
+		}
+	}
+
+	row[len(s.placetypes)] = len(hierarchies)
+
+	return row, nil
+}
+
+func hierarchyContains(h map[string]int64, id int64) bool {
+
+	for _, candidate := range h {
+
+		if candidate == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Abbreviated field names for placetypes that are too long to be followed by
+// "_ID" in a DBF field name. These are mostly the placetype truncated to seven
+// characters but are listed explicitly so that placetypes which share a
+// prefix, like macrocounty and macrocountry, don't end up with the same name.
+
+var hierarchy_field_names = map[string]string{
+	"building":      "BUILDIN_ID",
+	"constituency":  "CONSTIT_ID",
+	"continent":     "CONTINE_ID",
+	"dependency":    "DEPENDE_ID",
+	"intersection":  "INTERSE_ID",
+	"localadmin":    "LOCALAD_ID",
+	"locality":      "LOCALIT_ID",
+	"macrocountry":  "MCNTRY_ID",
+	"macrocounty":   "MACROCO_ID",
+	"macrohood":     "MACROHO_ID",
+	"macroregion":   "MACRORE_ID",
+	"marinearea":    "MARINEA_ID",
+	"metroarea":     "METROAR_ID",
+	"microhood":     "MICROHO_ID",
+	"neighbourhood": "NEIGHBO_ID",
+	"postalcode":    "POSTALC_ID",
+	"timezone":      "TIMEZON_ID",
+}
+
+// hierarchyFieldName returns the DBF field name for pt, for example
+// "COUNTRY_ID" or "LOCALIT_ID" for "locality" (see hierarchy_field_names). It
+// returns an empty string for other placetypes whose names are too long, in
+// which case the name is assigned by mapFieldNames along with those of any
+// other unnamed fields.
+
+func hierarchyFieldName(pt string) string {
+
+	name, ok := hierarchy_field_names[pt]
+
+	if ok {
+		return name
+	}
+
+	name = strings.ToUpper(pt) + "_ID"
+
+	if len(name) > 10 || DBFFieldName(name) != name {
+		return ""
+	}
+
+	return name
+}
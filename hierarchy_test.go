@@ -0,0 +1,65 @@
+package shapefile
+
+import (
+	"testing"
+)
+
+func TestHierarchyFieldNames(t *testing.T) {
+
+	placetypes := []string{
+		"country",
+		"macrocounty",
+		"macrocountry",
+		"locality",
+		"neighbourhood",
+		"superneighbourhood",
+		"superneighbourhoodish",
+	}
+
+	s, err := NewHierarchySchema(placetypes, HIERARCHY_FIRST)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := mapFieldNames(s.Fields(), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"wof:hierarchy.country_id":               "COUNTRY_ID",
+		"wof:hierarchy.macrocounty_id":           "MACROCO_ID",
+		"wof:hierarchy.macrocountry_id":          "MCNTRY_ID",
+		"wof:hierarchy.locality_id":              "LOCALIT_ID",
+		"wof:hierarchy.neighbourhood_id":         "NEIGHBO_ID",
+		"wof:hierarchy.superneighbourhood_id":    "SUPERNEIGH",
+		"wof:hierarchy.superneighbourhoodish_id": "SUPERNEI_1",
+		"wof:hierarchy":                          HIERARCHY_COUNT_FIELD,
+	}
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields but got %d", len(expected), len(fields))
+	}
+
+	for _, field := range fields {
+
+		name, ok := expected[field.Property]
+
+		if !ok {
+			t.Errorf("unexpected field for %s", field.Property)
+			continue
+		}
+
+		if field.Name != name {
+			t.Errorf("expected %s to be named %s but got %s", field.Property, name, field.Name)
+		}
+	}
+
+	_, err = dbfFields(fields)
+
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,441 @@
+package shapefile
+
+import (
+	"errors"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The names of the fields the writer may add after the schema's fields, which
+// aren't used for inferred fields.
+
+var reserved_field_names = []string{
+	POINT_SOURCE_FIELD,
+	CLIPPED_FIELD,
+	REPAIRS_FIELD,
+	NULL_REASON_FIELD,
+	TRUNCATED_FIELD,
+	OVERFLOW_FIELD,
+	AREA_FIELD,
+	PERIMETER_FIELD,
+	BBOX_MINX_FIELD,
+	BBOX_MINY_FIELD,
+	BBOX_MAXX_FIELD,
+	BBOX_MAXY_FIELD,
+	VERTICES_FIELD,
+}
+
+// PropertyStats records what was seen for a single property in a sample of
+// features. Count is the number of features where the property has a value
+// (other than null or an empty string) and MaxLength is the length, in bytes,
+// of the longest of those values as it would be written to a text field.
+// Lists count as the length of their elements joined by commas.
+
+type PropertyStats struct {
+	Property  string
+	Count     int
+	MaxLength int
+	bools     int
+	integers  int
+	floats    int
+	dates     int
+	lists     int
+	digits    int
+	decimals  int
+}
+
+// Type returns the name of the schema file type (see also SchemaFileField)
+// that can hold every value seen for the property. Values of mixed types are
+// strings.
+
+func (st *PropertyStats) Type() string {
+
+	switch st.Count {
+	case 0:
+		return "string"
+	case st.bools:
+		return "logical"
+	case st.integers:
+		return "number"
+	case st.integers + st.floats:
+		return "float"
+	case st.dates:
+		return "date"
+	default:
+		return "string"
+	}
+}
+
+func (st *PropertyStats) add(rsp gjson.Result) {
+
+	str_value := rsp.String()
+
+	switch rsp.Type {
+
+	case gjson.True, gjson.False:
+
+		st.bools += 1
+
+	case gjson.Number:
+
+		raw := rsp.Raw
+		int_part := raw
+
+		if strings.ContainsAny(raw, "eE") {
+			// don't try to size exponents, just assume the worst
+			st.floats += 1
+			st.digits = 19
+			st.decimals = 8
+			break
+		}
+
+		if strings.Contains(raw, ".") {
+
+			parts := strings.SplitN(raw, ".", 2)
+			int_part = parts[0]
+
+			st.floats += 1
+			st.decimals = maxInt(st.decimals, len(strings.TrimRight(parts[1], "0")))
+
+		} else {
+			st.integers += 1
+		}
+
+		st.digits = maxInt(st.digits, len(int_part))
+		str_value = raw
+
+	case gjson.String:
+
+		if str_value == "" {
+			return
+		}
+
+		// only full dates since, say, "2019" is just as likely to be a
+		// string as it is a year
+
+		_, ok := EDTFDate(str_value)
+
+		if ok && len(strings.TrimRight(str_value, "?~%")) == 10 {
+			st.dates += 1
+		}
+
+	case gjson.JSON:
+
+		if rsp.IsArray() {
+
+			values := make([]string, 0)
+
+			for _, v := range rsp.Array() {
+				values = append(values, v.String())
+			}
+
+			if len(values) == 0 {
+				return
+			}
+
+			st.lists += 1
+			str_value = strings.Join(values, ",")
+		}
+
+	default:
+		return
+	}
+
+	st.Count += 1
+	st.MaxLength = maxInt(st.MaxLength, len(str_value))
+}
+
+// schemaFileField returns the field for the property, named name, that can
+// hold every value seen.
+
+func (st *PropertyStats) schemaFileField(name string) SchemaFileField {
+
+	field := SchemaFileField{
+		Path: "properties." + escapePath(st.Property),
+		Name: name,
+		Type: st.Type(),
+	}
+
+	switch field.Type {
+
+	case "number":
+
+		field.Size = uint8(clampInt(st.digits, 1, 19))
+
+	case "float":
+
+		// the integer digits (and sign) always fit, at the expense of
+		// decimals if necessary
+
+		digits := clampInt(st.digits, 1, 17)
+		decimals := clampInt(st.decimals, 1, 18-digits)
+
+		field.Size = uint8(digits + 1 + decimals)
+		field.Precision = uint8(decimals)
+
+	case "string":
+
+		field.Size = uint8(clampInt(st.MaxLength, 1, 254))
+
+		if st.lists > 0 {
+			field.Transform = TRANSFORM_JOIN
+		}
+	}
+
+	return field
+}
+
+// InferredSchema is a schema whose fields are inferred from the (top-level)
+// properties of a sample of features. A field is added for each property with
+// the narrowest type, and size, that can hold every value seen for it, sorted
+// by property so that the schema is the same however (concurrently) features
+// are sampled. Features are sampled with ExpandFromFeature (see also
+// ExpandableSchema); if Sample is greater than 0 only the first Sample
+// features are used. Properties that have a value in
+// fewer than MinFill (0.0 - 1.0) of the features sampled are left out. Since
+// features that weren't sampled may have wider values the writer writes NULL,
+// with a warning, for any value that doesn't fit its field.
+
+type InferredSchema struct {
+	Sample  int
+	MinFill float64
+	stats   map[string]*PropertyStats
+	sampled int
+	schema  Schema
+	mu      *sync.Mutex
+}
+
+func NewInferredSchema(sample int, min_fill float64) (*InferredSchema, error) {
+
+	if sample < 0 {
+		return nil, errors.New("Invalid sample size, must be 0 or more")
+	}
+
+	if min_fill < 0.0 || min_fill > 1.0 {
+		return nil, errors.New("Invalid minimum fill rate, must be between 0.0 and 1.0")
+	}
+
+	s := InferredSchema{
+		Sample:  sample,
+		MinFill: min_fill,
+		stats:   make(map[string]*PropertyStats),
+		mu:      new(sync.Mutex),
+	}
+
+	return &s, nil
+}
+
+// NeedsExpanding returns true until Sample features have been sampled (or
+// always if Sample is 0).
+
+func (s *InferredSchema) NeedsExpanding() bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Sample == 0 || s.sampled < s.Sample
+}
+
+// ExpandFromFeature adds f's properties to the sample.
+
+func (s *InferredSchema) ExpandFromFeature(f geojson.Feature) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Sample > 0 && s.sampled >= s.Sample {
+		return
+	}
+
+	s.sampled += 1
+	s.schema = nil
+
+	props := gjson.GetBytes(f.Bytes(), "properties")
+
+	props.ForEach(func(k gjson.Result, v gjson.Result) bool {
+
+		property := k.String()
+		st, ok := s.stats[property]
+
+		if !ok {
+			st = &PropertyStats{Property: property}
+			s.stats[property] = st
+		}
+
+		st.add(v)
+		return true
+	})
+}
+
+// Sampled returns the number of features that have been sampled.
+
+func (s *InferredSchema) Sampled() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sampled
+}
+
+// Stats returns what was seen for each property, sorted by property.
+
+func (s *InferredSchema) Stats() []PropertyStats {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	properties := s.sortedProperties()
+	stats := make([]PropertyStats, len(properties))
+
+	for i, property := range properties {
+		stats[i] = *s.stats[property]
+	}
+
+	return stats
+}
+
+func (s *InferredSchema) sortedProperties() []string {
+
+	properties := make([]string, 0, len(s.stats))
+
+	for property := range s.stats {
+		properties = append(properties, property)
+	}
+
+	sort.Strings(properties)
+	return properties
+}
+
+// SchemaFile returns the fields inferred so far as a schema file, which may be
+// saved (see also WriteSchemaFile), edited and used in place of the inferred
+// schema (see also NewFileSchema). Fields are named after their property (see
+// also DBFFieldName).
+
+func (s *InferredSchema) SchemaFile() *SchemaFile {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.schemaFile()
+}
+
+func (s *InferredSchema) schemaFile() *SchemaFile {
+
+	sf := SchemaFile{
+		Fields: make([]SchemaFileField, 0),
+	}
+
+	used := make(map[string]bool)
+
+	for _, name := range reserved_field_names {
+		used[name] = true
+	}
+
+	for _, property := range s.sortedProperties() {
+
+		st := s.stats[property]
+
+		if st.Count == 0 || float64(st.Count)/float64(s.sampled) < s.MinFill {
+			continue
+		}
+
+		name := uniqueFieldName(DBFFieldName(property), used)
+		sf.Fields = append(sf.Fields, st.schemaFileField(name))
+	}
+
+	return &sf
+}
+
+func (s *InferredSchema) fileSchema() (Schema, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.schema != nil {
+		return s.schema, nil
+	}
+
+	sf := s.schemaFile()
+
+	if len(sf.Fields) == 0 {
+		return nil, errors.New("No fields have been inferred")
+	}
+
+	schema, err := NewFileSchemaFromSchemaFile(sf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.schema = schema
+	return schema, nil
+}
+
+// Fields returns the fields inferred from the features sampled so far, or no
+// fields if nothing has been sampled.
+
+func (s *InferredSchema) Fields() []SchemaField {
+
+	schema, err := s.fileSchema()
+
+	if err != nil {
+		return []SchemaField{}
+	}
+
+	return schema.Fields()
+}
+
+func (s *InferredSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	schema, err := s.fileSchema()
+
+	if err != nil {
+		return []interface{}{}, nil
+	}
+
+	return schema.Row(f)
+}
+
+// escapePath escapes the characters in property that have a special meaning
+// in a gjson path.
+
+func escapePath(property string) string {
+
+	var b strings.Builder
+
+	for _, r := range property {
+
+		if strings.ContainsRune(`\.*?|#@!`, r) {
+			b.WriteRune('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func maxInt(a int, b int) int {
+
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func clampInt(v int, min int, max int) int {
+
+	if v < min {
+		return min
+	}
+
+	if v > max {
+		return max
+	}
+
+	return v
+}
@@ -0,0 +1,202 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInferredSchema(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		props    []string
+		min_fill float64
+		expected []SchemaFileField
+	}{
+		{
+			"number",
+			[]string{`{"population":999}`, `{"population":-12345}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.population", Name: "POPULATION", Type: "number", Size: 6},
+			},
+		},
+		{
+			"float",
+			[]string{`{"area":12.5}`, `{"area":3.1250}`, `{"area":7}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.area", Name: "AREA", Type: "float", Size: 6, Precision: 3},
+			},
+		},
+		{
+			"logical",
+			[]string{`{"current":true}`, `{"current":false}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.current", Name: "CURRENT", Type: "logical"},
+			},
+		},
+		{
+			"date",
+			[]string{`{"inception":"1642-05-17"}`, `{"inception":"1984-06-01"}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.inception", Name: "INCEPTION", Type: "date"},
+			},
+		},
+		{
+			"mixed",
+			[]string{`{"code":42}`, `{"code":"XY-1234"}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.code", Name: "CODE", Type: "string", Size: 7},
+			},
+		},
+		{
+			"list",
+			[]string{`{"tags":["a","bc"]}`, `{"tags":["def"]}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.tags", Name: "TAGS", Type: "string", Size: 4, Transform: TRANSFORM_JOIN},
+			},
+		},
+		{
+			"sorted",
+			[]string{`{"zoom":1,"name":"a"}`, `{"name":"bb","alpha":true}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.alpha", Name: "ALPHA", Type: "logical"},
+				{Path: "properties.name", Name: "NAME", Type: "string", Size: 2},
+				{Path: "properties.zoom", Name: "ZOOM", Type: "number", Size: 1},
+			},
+		},
+		{
+			"min fill",
+			[]string{`{"name":"a","note":"x"}`, `{"name":"b"}`, `{"name":"c"}`},
+			0.5,
+			[]SchemaFileField{
+				{Path: "properties.name", Name: "NAME", Type: "string", Size: 1},
+			},
+		},
+		{
+			"empty",
+			[]string{`{"name":"a","note":""}`, `{"name":"b","note":null}`},
+			0.0,
+			[]SchemaFileField{
+				{Path: "properties.name", Name: "NAME", Type: "string", Size: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		s, err := NewInferredSchema(0, test.min_fill)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, props := range test.props {
+			f := testFeature(t, `{"type":"Feature","properties":`+props+`,"geometry":{"type":"Point","coordinates":[0,0]}}`)
+			s.ExpandFromFeature(f)
+		}
+
+		fields := s.SchemaFile().Fields
+
+		if len(fields) != len(test.expected) {
+			t.Errorf("%s: expected %d fields but got %d (%v)", test.label, len(test.expected), len(fields), fields)
+			continue
+		}
+
+		for i, field := range fields {
+
+			if field != test.expected[i] {
+				t.Errorf("%s: expected field %d to be %+v but got %+v", test.label, i, test.expected[i], field)
+			}
+		}
+	}
+}
+
+func TestWriterInferredTooWide(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "infer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	populations := []string{"999", "123456", "42"}
+	features := make([]string, len(populations))
+
+	for i, population := range populations {
+		features[i] = `{"type":"Feature","properties":{"population":` + population + `},"geometry":{"type":"Point","coordinates":[0,0]}}`
+	}
+
+	// only the first feature is sampled so POPULATION is 3 digits wide
+
+	s, err := NewInferredSchema(1, 0.0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range features {
+		s.ExpandFromFeature(testFeature(t, body))
+	}
+
+	path := filepath.Join(root, "infer.shp")
+
+	opts := NewDefaultWriterOptions()
+	opts.Schema = s
+
+	wr, err := NewWriterWithOptions(path, shp.POINT, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range features {
+
+		_, err = wr.AddFeature(testFeature(t, body))
+
+		if err != nil {
+			t.Fatalf("failed to add feature with a value wider than its field: %s", err)
+		}
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := shp.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdr.Close()
+
+	if int(rdr.AttributeCount()) != len(features) {
+		t.Fatalf("expected %d records but got %d", len(features), rdr.AttributeCount())
+	}
+
+	expected := []string{"999", "", "42"}
+
+	for i, value := range expected {
+
+		got := strings.TrimSpace(rdr.ReadAttribute(i, 0))
+
+		if got != value {
+			t.Errorf("record %d: expected '%s' but got '%s'", i, value, got)
+		}
+	}
+}
@@ -0,0 +1,745 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// https://www.esri.com/library/whitepapers/pdfs/shapefile.pdf (page 2)
+// "Any floating point number smaller than –10^38 is considered by a
+// shapefile reader to represent a 'no data' value" which only applies to M
+// values, there is no such value for Z (see also ShapeOptions.ZUnknown).
+
+const M_NODATA = -1.0e39
+
+var re_year *regexp.Regexp
+
+func init() {
+	re_year = regexp.MustCompile(`^(\-?\d{4})`)
+}
+
+// FeatureToShapeZ returns a Z shape (POINTZ, POLYLINEZ, POLYGONZ or
+// MULTIPOINTZ) for f. Z values are read from opts.ZProperty if it is
+// defined or the third coordinate of each position otherwise. M values
+// are read from opts.MProperty.
+
+func FeatureToShapeZ(f geojson.Feature, shapetype shp.ShapeType, opts *ShapeOptions) (shp.Shape, error) {
+
+	s, err := FeatureToShapeWithOptions(f, baseShapeType(shapetype), opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return shapeToZ(f, s, opts)
+}
+
+// shapeToZ returns the Z equivalent of the 2D shape s (derived from f).
+
+func shapeToZ(f geojson.Feature, s shp.Shape, opts *ShapeOptions) (shp.Shape, error) {
+
+	z_func, err := elevationFunc(f, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := measureForFeature(f, opts)
+
+	switch shape := s.(type) {
+
+	case *shp.Point:
+
+		pz := shp.PointZ{
+			X: shape.X,
+			Y: shape.Y,
+			Z: z_func(*shape),
+			M: m,
+		}
+
+		return &pz, nil
+
+	case *shp.MultiPoint:
+
+		z, z_range := elevations(shape.Points, z_func)
+		m_array, m_range := measures(shape.Points, m)
+
+		mz := shp.MultiPointZ{
+			Box:       shape.Box,
+			NumPoints: shape.NumPoints,
+			Points:    shape.Points,
+			ZRange:    z_range,
+			ZArray:    z,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &mz, nil
+
+	case *shp.PolyLine:
+
+		z, z_range := elevations(shape.Points, z_func)
+		m_array, m_range := measures(shape.Points, m)
+
+		plz := shp.PolyLineZ{
+			Box:       shape.Box,
+			NumParts:  shape.NumParts,
+			NumPoints: shape.NumPoints,
+			Parts:     shape.Parts,
+			Points:    shape.Points,
+			ZRange:    z_range,
+			ZArray:    z,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &plz, nil
+
+	case *shp.Polygon:
+
+		z, z_range := elevations(shape.Points, z_func)
+		m_array, m_range := measures(shape.Points, m)
+
+		polyz := shp.PolygonZ{
+			Box:       shape.Box,
+			NumParts:  shape.NumParts,
+			NumPoints: shape.NumPoints,
+			Parts:     shape.Parts,
+			Points:    shape.Points,
+			ZRange:    z_range,
+			ZArray:    z,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &polyz, nil
+
+	default:
+		return nil, errors.New("Unsupported shape type")
+	}
+}
+
+// FeatureToShapeM returns an M shape (POINTM, POLYLINEM, POLYGONM or
+// MULTIPOINTM) for f with M values read from opts.MProperty.
+
+func FeatureToShapeM(f geojson.Feature, shapetype shp.ShapeType, opts *ShapeOptions) (shp.Shape, error) {
+
+	s, err := FeatureToShapeWithOptions(f, baseShapeType(shapetype), opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return shapeToM(f, s, opts)
+}
+
+// shapeToM returns the M equivalent of the 2D shape s (derived from f).
+
+func shapeToM(f geojson.Feature, s shp.Shape, opts *ShapeOptions) (shp.Shape, error) {
+
+	m := measureForFeature(f, opts)
+
+	switch shape := s.(type) {
+
+	case *shp.Point:
+
+		pm := shp.PointM{
+			X: shape.X,
+			Y: shape.Y,
+			M: m,
+		}
+
+		return &pm, nil
+
+	case *shp.MultiPoint:
+
+		m_array, m_range := measures(shape.Points, m)
+
+		mm := shp.MultiPointM{
+			Box:       shape.Box,
+			NumPoints: shape.NumPoints,
+			Points:    shape.Points,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &mm, nil
+
+	case *shp.PolyLine:
+
+		m_array, m_range := measures(shape.Points, m)
+
+		plm := shp.PolyLineM{
+			Box:       shape.Box,
+			NumParts:  shape.NumParts,
+			NumPoints: shape.NumPoints,
+			Parts:     shape.Parts,
+			Points:    shape.Points,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &plm, nil
+
+	case *shp.Polygon:
+
+		// note that go-shp defines PolygonM as a PolyLineZ but only
+		// writes the M values so we don't bother with Z values here
+		m_array, m_range := measures(shape.Points, m)
+
+		polym := shp.PolygonM{
+			Box:       shape.Box,
+			NumParts:  shape.NumParts,
+			NumPoints: shape.NumPoints,
+			Parts:     shape.Parts,
+			Points:    shape.Points,
+			MRange:    m_range,
+			MArray:    m_array,
+		}
+
+		return &polym, nil
+
+	default:
+		return nil, errors.New("Unsupported shape type")
+	}
+}
+
+// baseShapeType returns the 2D shape type for a Z or M shape type.
+
+func baseShapeType(shapetype shp.ShapeType) shp.ShapeType {
+
+	switch shapetype {
+	case shp.POINTZ, shp.POINTM:
+		return shp.POINT
+	case shp.POLYLINEZ, shp.POLYLINEM:
+		return shp.POLYLINE
+	case shp.POLYGONZ, shp.POLYGONM:
+		return shp.POLYGON
+	case shp.MULTIPOINTZ, shp.MULTIPOINTM:
+		return shp.MULTIPOINT
+	default:
+		return shapetype
+	}
+}
+
+// elevationFunc returns a function for looking up the Z value of a point
+// in f. If opts.ZProperty is defined every point is assigned its value
+// otherwise Z values are looked up from the third coordinate of matching
+// positions in the feature's geometry (normalized and reprojected if
+// necessary). Points that fall on an edge between two such positions, for
+// example those added when a shape is clipped, split at the antimeridian or
+// densified, are assigned a value interpolated along that edge. Points that
+// can't be matched at all (for example centroids), or features that don't
+// have opts.ZProperty, are assigned opts.ZUnknown.
+
+func elevationFunc(f geojson.Feature, opts *ShapeOptions) (func(shp.Point) float64, error) {
+
+	if opts.ZProperty != "" {
+
+		z := opts.ZUnknown
+
+		rsp := gjson.GetBytes(f.Bytes(), "properties."+opts.ZProperty)
+
+		if rsp.Exists() {
+
+			v, ok := numericValue(rsp)
+
+			if !ok {
+				return nil, errors.New("Invalid Z property, expected a number")
+			}
+
+			z = v
+		}
+
+		z_func := func(pt shp.Point) float64 {
+			return z
+		}
+
+		return z_func, nil
+	}
+
+	lookup := make(map[shp.Point]float64)
+	edges := make([]elevationEdge, 0)
+
+	g := gjson.GetBytes(f.Bytes(), "geometry")
+
+	for _, child := range append([]gjson.Result{g}, g.Get("geometries").Array()...) {
+
+		// the points in a MultiPoint geometry are not connected
+
+		switch child.Get("type").String() {
+		case "Point", "MultiPoint":
+			collectElevations(child.Get("coordinates"), lookup, nil)
+		default:
+			collectElevations(child.Get("coordinates"), lookup, &edges)
+		}
+	}
+
+	// edges that cross the antimeridian are also recorded unwrapped on
+	// either side of it so that points added when they are split can be
+	// matched
+
+	for _, e := range edges {
+
+		if e.b.X-e.a.X > 180.0 {
+			edges = append(edges, elevationEdge{shp.Point{X: e.a.X + 360.0, Y: e.a.Y}, e.b, e.za, e.zb})
+			edges = append(edges, elevationEdge{e.a, shp.Point{X: e.b.X - 360.0, Y: e.b.Y}, e.za, e.zb})
+		} else if e.a.X-e.b.X > 180.0 {
+			edges = append(edges, elevationEdge{shp.Point{X: e.a.X - 360.0, Y: e.a.Y}, e.b, e.za, e.zb})
+			edges = append(edges, elevationEdge{e.a, shp.Point{X: e.b.X + 360.0, Y: e.b.Y}, e.za, e.zb})
+		}
+	}
+
+	if opts.Antimeridian == ANTIMERIDIAN_NORMALIZE {
+
+		for pt, z := range lookup {
+
+			if pt.X < 0.0 {
+				lookup[shp.Point{X: pt.X + 360.0, Y: pt.Y}] = z
+			}
+		}
+
+		for _, e := range edges {
+
+			if e.a.X < 0.0 || e.b.X < 0.0 {
+				edges = append(edges, elevationEdge{normalizeLongitude(e.a), normalizeLongitude(e.b), e.za, e.zb})
+			}
+		}
+	}
+
+	if opts.Projection != nil && !opts.Projection.IsGeographic() {
+
+		projected := make(map[shp.Point]float64)
+
+		for pt, z := range lookup {
+
+			p, err := projectPoint(pt, opts.Projection)
+
+			if err != nil {
+				continue
+			}
+
+			projected[p] = z
+		}
+
+		// edges are densified the same way ProjectShape does it so that
+		// the new vertices can be matched exactly
+
+		projected_edges := make([]elevationEdge, 0)
+
+		for _, e := range edges {
+
+			pts := []shp.Point{e.a, e.b}
+
+			if opts.Densify > 0.0 {
+				pts = densifyPoints(pts, opts.Densify)
+			}
+
+			var prev shp.Point
+			var prev_z float64
+
+			for i, pt := range pts {
+
+				z := e.interpolate(pt)
+
+				p, err := projectPoint(pt, opts.Projection)
+
+				if err != nil {
+					break
+				}
+
+				projected[p] = z
+
+				if i > 0 {
+					projected_edges = append(projected_edges, elevationEdge{prev, p, prev_z, z})
+				}
+
+				prev = p
+				prev_z = z
+			}
+		}
+
+		lookup = projected
+		edges = projected_edges
+	}
+
+	z_func := func(pt shp.Point) float64 {
+
+		z, ok := lookup[pt]
+
+		if ok {
+			return z
+		}
+
+		for _, e := range edges {
+
+			if e.contains(pt) {
+				return e.interpolate(pt)
+			}
+		}
+
+		return opts.ZUnknown
+	}
+
+	return z_func, nil
+}
+
+// elevationEdge is an edge between two positions that both have a Z value.
+
+type elevationEdge struct {
+	a  shp.Point
+	b  shp.Point
+	za float64
+	zb float64
+}
+
+// contains returns true if pt lies on the edge, allowing for the rounding
+// errors of points that have been calculated rather than copied.
+
+func (e elevationEdge) contains(pt shp.Point) bool {
+
+	dx := e.b.X - e.a.X
+	dy := e.b.Y - e.a.Y
+
+	length := math.Sqrt(dx*dx + dy*dy)
+
+	if length == 0.0 {
+		return false
+	}
+
+	scale := math.Max(math.Max(math.Abs(e.a.X), math.Abs(e.a.Y)), math.Max(math.Abs(e.b.X), math.Abs(e.b.Y)))
+	tolerance := 1.0e-9 * math.Max(scale, 1.0)
+
+	// the distance from pt to the line through a and b and then how far
+	// along the edge pt falls
+
+	distance := math.Abs((pt.X-e.a.X)*dy-(pt.Y-e.a.Y)*dx) / length
+
+	if distance > tolerance {
+		return false
+	}
+
+	along := ((pt.X-e.a.X)*dx + (pt.Y-e.a.Y)*dy) / length
+
+	return along >= -tolerance && along <= length+tolerance
+}
+
+// interpolate returns the Z value of pt, which is assumed to lie on the
+// edge, interpolated linearly between the ends of the edge.
+
+func (e elevationEdge) interpolate(pt shp.Point) float64 {
+
+	dx := e.b.X - e.a.X
+	dy := e.b.Y - e.a.Y
+
+	length2 := dx*dx + dy*dy
+
+	if length2 == 0.0 {
+		return e.za
+	}
+
+	t := ((pt.X-e.a.X)*dx + (pt.Y-e.a.Y)*dy) / length2
+	t = math.Max(0.0, math.Min(1.0, t))
+
+	return e.za + (e.zb-e.za)*t
+}
+
+func normalizeLongitude(pt shp.Point) shp.Point {
+
+	if pt.X < 0.0 {
+		pt.X += 360.0
+	}
+
+	return pt
+}
+
+// collectElevations walks the (nested) GeoJSON coordinates r and records the
+// third coordinate of each position that has one, along with the edges
+// between consecutive positions in a line or ring that both have one (unless
+// edges is nil).
+
+func collectElevations(r gjson.Result, lookup map[shp.Point]float64, edges *[]elevationEdge) {
+
+	if !r.IsArray() {
+		return
+	}
+
+	els := r.Array()
+
+	if len(els) == 0 {
+		return
+	}
+
+	if !els[0].IsArray() {
+
+		pt, z, ok := elevationForPosition(r)
+
+		if ok {
+			lookup[pt] = z
+		}
+
+		return
+	}
+
+	if els[0].Get("0").IsArray() {
+
+		for _, el := range els {
+			collectElevations(el, lookup, edges)
+		}
+
+		return
+	}
+
+	// a list of positions
+
+	var prev shp.Point
+	var prev_z float64
+	prev_ok := false
+
+	for _, el := range els {
+
+		pt, z, ok := elevationForPosition(el)
+
+		if ok {
+
+			lookup[pt] = z
+
+			if prev_ok && edges != nil {
+				*edges = append(*edges, elevationEdge{prev, pt, prev_z, z})
+			}
+		}
+
+		prev = pt
+		prev_z = z
+		prev_ok = ok
+	}
+}
+
+// elevationForPosition returns the point and third coordinate of the GeoJSON
+// position r and a boolean flag indicating whether both are valid.
+
+func elevationForPosition(r gjson.Result) (shp.Point, float64, bool) {
+
+	els := r.Array()
+
+	if len(els) < 3 || els[2].Type != gjson.Number {
+		return shp.Point{}, 0.0, false
+	}
+
+	pt, err := pointForPosition(r)
+
+	if err != nil {
+		return shp.Point{}, 0.0, false
+	}
+
+	return pt, els[2].Float(), true
+}
+
+// measureForFeature returns the M value for f or M_NODATA if opts.MProperty
+// is not defined or its value can not be parsed. Strings that start with a
+// (four digit) year, like EDTF or ISO-8601 dates, are measured by their year.
+
+func measureForFeature(f geojson.Feature, opts *ShapeOptions) float64 {
+
+	if opts.MProperty == "" {
+		return M_NODATA
+	}
+
+	rsp := gjson.GetBytes(f.Bytes(), "properties."+opts.MProperty)
+
+	if !rsp.Exists() {
+		return M_NODATA
+	}
+
+	m, ok := numericValue(rsp)
+
+	if !ok {
+		return M_NODATA
+	}
+
+	return m
+}
+
+func numericValue(rsp gjson.Result) (float64, bool) {
+
+	switch rsp.Type {
+
+	case gjson.Number:
+		return rsp.Float(), true
+
+	case gjson.String:
+
+		v, err := strconv.ParseFloat(rsp.String(), 64)
+
+		if err == nil {
+			return v, true
+		}
+
+		m := re_year.FindStringSubmatch(rsp.String())
+
+		if len(m) == 0 {
+			return 0.0, false
+		}
+
+		v, err = strconv.ParseFloat(m[1], 64)
+
+		if err != nil {
+			return 0.0, false
+		}
+
+		return v, true
+
+	default:
+		return 0.0, false
+	}
+}
+
+// elevations returns the Z value of each point in pts along with their
+// range.
+
+func elevations(pts []shp.Point, z_func func(shp.Point) float64) ([]float64, [2]float64) {
+
+	z := make([]float64, len(pts))
+	z_range := [2]float64{0.0, 0.0}
+	has_z := false
+
+	for i, pt := range pts {
+		z[i] = z_func(pt)
+		z_range, has_z = extendRange(z_range, has_z, z[i])
+	}
+
+	return z, z_range
+}
+
+// isNoData returns true if v is a shapefile "no data" (M) value.
+
+func isNoData(v float64) bool {
+	return v < -1.0e38
+}
+
+func measures(pts []shp.Point, m float64) ([]float64, [2]float64) {
+
+	m_array := make([]float64, len(pts))
+
+	for i := range pts {
+		m_array[i] = m
+	}
+
+	return m_array, [2]float64{m, m}
+}
+
+// extendMeasureRanges adds the Z and M values of s to the writer's Z and M
+// ranges. M values that are "no data" are ignored.
+
+func (wr *Writer) extendMeasureRanges(s shp.Shape) {
+
+	var z []float64
+	var m []float64
+
+	switch shape := s.(type) {
+	case *shp.PointZ:
+		z = []float64{shape.Z}
+		m = []float64{shape.M}
+	case *shp.PointM:
+		m = []float64{shape.M}
+	case *shp.MultiPointZ:
+		z = shape.ZArray
+		m = shape.MArray
+	case *shp.MultiPointM:
+		m = shape.MArray
+	case *shp.PolyLineZ:
+		z = shape.ZArray
+		m = shape.MArray
+	case *shp.PolyLineM:
+		m = shape.MArray
+	case *shp.PolygonZ:
+		z = shape.ZArray
+		m = shape.MArray
+	case *shp.PolygonM:
+		m = shape.MArray
+	default:
+		return
+	}
+
+	for _, v := range z {
+		wr.z_range, wr.has_z = extendRange(wr.z_range, wr.has_z, v)
+	}
+
+	for _, v := range m {
+
+		if isNoData(v) {
+			continue
+		}
+
+		wr.m_range, wr.has_m = extendRange(wr.m_range, wr.has_m, v)
+	}
+}
+
+func extendRange(r [2]float64, ok bool, v float64) ([2]float64, bool) {
+
+	if !ok || v < r[0] {
+		r[0] = v
+	}
+
+	if !ok || v > r[1] {
+		r[1] = v
+	}
+
+	return r, true
+}
+
+// patchMeasureRanges updates the Z and M ranges in the headers of the .shp
+// and .shx files, which go-shp always writes as 0.0, to the ranges of the
+// records that were written. This needs to happen after the shapewriter has
+// been closed.
+
+func (wr *Writer) patchMeasureRanges() error {
+
+	if !wr.has_z && !wr.has_m {
+		return nil
+	}
+
+	root := strings.TrimSuffix(wr.path, ".shp")
+
+	// the Z range (min, max) starts at byte 68 of both file headers,
+	// followed by the M range
+
+	ranges := []float64{wr.z_range[0], wr.z_range[1], wr.m_range[0], wr.m_range[1]}
+
+	for _, path := range []string{root + ".shp", root + ".shx"} {
+
+		fh, err := os.OpenFile(path, os.O_RDWR, 0644)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fh.Seek(68, io.SeekStart)
+
+		if err == nil {
+			err = binary.Write(fh, binary.LittleEndian, ranges)
+		}
+
+		if err != nil {
+			fh.Close()
+			return err
+		}
+
+		err = fh.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
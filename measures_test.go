@@ -0,0 +1,324 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShapeZFromCoordinates(t *testing.T) {
+
+	tests := []struct {
+		label        string
+		geometry     string
+		antimeridian string
+		z            []float64
+	}{
+		{
+			label:    "linestring",
+			geometry: `{"type":"LineString","coordinates":[[0,0,10],[1,0,20],[2,0]]}`,
+			z:        []float64{10, 20, 0},
+		},
+		{
+			// the points added at the antimeridian are half way along
+			// the edge that crosses it
+
+			label:        "split at antimeridian",
+			geometry:     `{"type":"LineString","coordinates":[[179,0,100],[-179,0,200]]}`,
+			antimeridian: ANTIMERIDIAN_SPLIT,
+			z:            []float64{100, 150, 150, 200},
+		},
+		{
+			label:        "normalized",
+			geometry:     `{"type":"LineString","coordinates":[[179,0,100],[-179,0,200]]}`,
+			antimeridian: ANTIMERIDIAN_NORMALIZE,
+			z:            []float64{100, 200},
+		},
+		{
+			label:    "multilinestring",
+			geometry: `{"type":"MultiLineString","coordinates":[[[0,0,-5],[0,1,5]]]}`,
+			z:        []float64{-5, 5},
+		},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+test.geometry+`}`)
+
+		opts := NewDefaultShapeOptions()
+
+		if test.antimeridian != "" {
+			opts.Antimeridian = test.antimeridian
+		}
+
+		s, err := FeatureToShapeWithOptions(f, shp.POLYLINEZ, opts)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		plz, ok := s.(*shp.PolyLineZ)
+
+		if !ok {
+			t.Errorf("%s: expected a POLYLINEZ shape but got %T", test.label, s)
+			continue
+		}
+
+		if len(plz.ZArray) != len(test.z) {
+			t.Errorf("%s: expected %d Z values but got %v", test.label, len(test.z), plz.ZArray)
+			continue
+		}
+
+		for i, z := range test.z {
+
+			if math.Abs(plz.ZArray[i]-z) > 1e-9 {
+				t.Errorf("%s: expected Z value %d to be %f but got %f", test.label, i, z, plz.ZArray[i])
+			}
+		}
+	}
+}
+
+func TestShapeZClipped(t *testing.T) {
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"LineString","coordinates":[[0,0,0],[10,0,100]]}}`)
+
+	clip, err := NewClipRegionFromBBox(-1, -1, 5, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewDefaultShapeOptions()
+	opts.Clip = clip
+
+	s, err := FeatureToShapeWithOptions(f, shp.POLYLINEZ, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plz := s.(*shp.PolyLineZ)
+
+	if len(plz.ZArray) != 2 || plz.ZArray[0] != 0 || math.Abs(plz.ZArray[1]-50) > 1e-9 {
+		t.Errorf("expected Z values of [0 50] but got %v", plz.ZArray)
+	}
+}
+
+func TestShapeZFromProperty(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		property string
+		unknown  float64
+		z        float64
+		ok       bool
+	}{
+		{"number", `"wof:elevation":123.5`, 0, 123.5, true},
+		{"string", `"wof:elevation":"42"`, 0, 42, true},
+		{"missing", `"wof:name":"foo"`, 0, 0, true},
+		{"missing with unknown value", `"wof:name":"foo"`, -9999, -9999, true},
+		{"invalid", `"wof:elevation":"high"`, 0, 0, false},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1,`+test.property+`},"geometry":{"type":"Polygon","coordinates":[[[0,0,1],[10,0,1],[10,10,1],[0,0,1]]]}}`)
+
+		opts := NewDefaultShapeOptions()
+		opts.ZProperty = "wof:elevation"
+		opts.ZUnknown = test.unknown
+
+		s, err := FeatureToShapeWithOptions(f, shp.POLYGONZ, opts)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Errorf("%s: expected an error", test.label)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		pz := s.(*shp.PolygonZ)
+
+		for i, z := range pz.ZArray {
+
+			if z != test.z {
+				t.Errorf("%s: expected Z value %d to be %f but got %f", test.label, i, test.z, z)
+			}
+		}
+	}
+}
+
+func TestShapeM(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		property string
+		m        float64
+	}{
+		{"number", `"wof:measure":12.5`, 12.5},
+		{"date", `"edtf:inception":"1950-04-01"`, 1950},
+		{"approximate year", `"edtf:inception":"1850~"`, 1850},
+		{"negative year", `"edtf:inception":"-0500"`, -500},
+		{"unknown", `"edtf:inception":"uuuu"`, M_NODATA},
+		{"missing", `"wof:name":"foo"`, M_NODATA},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1,`+test.property+`},"geometry":{"type":"Point","coordinates":[1,2]}}`)
+
+		opts := NewDefaultShapeOptions()
+		opts.MProperty = "edtf:inception"
+
+		if strings.HasPrefix(test.property, `"wof:measure"`) {
+			opts.MProperty = "wof:measure"
+		}
+
+		s, err := FeatureToShapeWithOptions(f, shp.POINTM, opts)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		pm := s.(*shp.PointM)
+
+		if pm.M != test.m {
+			t.Errorf("%s: expected an M value of %f but got %f", test.label, test.m, pm.M)
+		}
+	}
+}
+
+func TestWriterMeasureRanges(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "measures")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	// the third feature has neither a Z or an M value and should be
+	// left out of both ranges
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1,"edtf:inception":"1900"},"geometry":{"type":"Point","coordinates":[0,0,10]}}`,
+		`{"type":"Feature","properties":{"wof:id":2,"edtf:inception":"2004-10-01"},"geometry":{"type":"Point","coordinates":[1,1,250.5]}}`,
+		`{"type":"Feature","properties":{"wof:id":3},"geometry":{"type":"Point","coordinates":[2,2]}}`,
+	}
+
+	path := filepath.Join(root, "measures.shp")
+
+	opts := NewDefaultWriterOptions()
+	opts.ShapeOptions.MProperty = "edtf:inception"
+	opts.ShapeOptions.PointSources = []string{POINT_SOURCE_CENTROID}
+
+	wr, err := NewWriterWithOptions(path, shp.POINTZ, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range features {
+
+		_, err = wr.AddFeature(testFeature(t, body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the third feature has no elevation so the Z range starts at 0
+
+	expected := []float64{0, 250.5, 1900, 2004}
+
+	for _, ext := range []string{".shp", ".shx"} {
+
+		fh, err := os.Open(strings.TrimSuffix(path, ".shp") + ext)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ranges := make([]float64, 4)
+
+		_, err = fh.Seek(68, 0)
+
+		if err == nil {
+			err = binary.Read(fh, binary.LittleEndian, ranges)
+		}
+
+		fh.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, v := range expected {
+
+			if ranges[i] != v {
+				t.Errorf("%s: expected header ranges of %v but got %v", ext, expected, ranges)
+				break
+			}
+		}
+	}
+}
+
+func TestShapeZDensified(t *testing.T) {
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"LineString","coordinates":[[0,0,0],[1,1,100]]}}`)
+
+	proj, err := projection.NewProjection("EPSG:3857")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewDefaultShapeOptions()
+	opts.Projection = proj
+	opts.Densify = 0.25
+
+	s, err := FeatureToShapeWithOptions(f, shp.POLYLINEZ, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plz := s.(*shp.PolyLineZ)
+
+	// the edge is ~1.41 degrees long so it's split in to 6 parts
+
+	if len(plz.ZArray) != 7 {
+		t.Fatalf("expected 7 Z values but got %v", plz.ZArray)
+	}
+
+	for i, z := range plz.ZArray {
+
+		expected := float64(i) * 100.0 / 6.0
+
+		if math.Abs(z-expected) > 1e-9 {
+			t.Errorf("expected Z value %d to be %f but got %f", i, expected, z)
+		}
+	}
+}
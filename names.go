@@ -0,0 +1,241 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"github.com/whosonfirst/go-whosonfirst-names/tags"
+	"sort"
+	"strings"
+)
+
+// Fallback rules for name columns when none of a column's names are present.
+// "none" leaves the column empty and "default" uses the feature's (wof:name)
+// name.
+
+const (
+	NAME_FALLBACK_NONE    = "none"
+	NAME_FALLBACK_DEFAULT = "default"
+)
+
+func NameFallbacks() []string {
+
+	return []string{
+		NAME_FALLBACK_DEFAULT,
+		NAME_FALLBACK_NONE,
+	}
+}
+
+func IsValidNameFallback(test string) bool {
+
+	valid := false
+
+	for _, fallback := range NameFallbacks() {
+
+		if fallback == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The width of name columns. Longer names are truncated (see also
+// WriterOptions.Overflow) so that a wildcard that matches a lot of names
+// doesn't make records wider than a DBF file allows.
+
+const NAME_FIELD_SIZE = 64
+
+// NamesSchema writes one column for each of a list of (WOF) names, for example
+// "fra_x_preferred" (the "name:fra_x_preferred" property). A language on its
+// own, like "fra", is shorthand for its preferred name. A column may list
+// several names separated by "|", for example "fra_x_preferred|eng_x_preferred",
+// in which case the first name a feature has is used. If a feature has none
+// of a column's names then the Fallback rule is applied.
+//
+// A name may use "*" in place of the language, for example "*_x_preferred",
+// in which case a column is added for each matching name that is found by
+// ExpandFromFeature (see also ExpandableSchema).
+
+type NamesSchema struct {
+	Fallback  string
+	columns   [][]string
+	wildcards []string
+	expanded  []string
+	seen      map[string]bool
+}
+
+func NewNamesSchema(names []string, fallback string) (*NamesSchema, error) {
+
+	if !IsValidNameFallback(fallback) {
+		msg := fmt.Sprintf("Invalid name fallback '%s'", fallback)
+		return nil, errors.New(msg)
+	}
+
+	s := NamesSchema{
+		Fallback:  fallback,
+		columns:   make([][]string, 0),
+		wildcards: make([]string, 0),
+		expanded:  make([]string, 0),
+		seen:      make(map[string]bool),
+	}
+
+	for _, str_names := range names {
+
+		column := make([]string, 0)
+
+		for _, name := range strings.Split(str_names, "|") {
+
+			name = strings.TrimPrefix(strings.TrimSpace(name), "name:")
+
+			if !strings.Contains(name, "_") {
+				name = name + "_x_preferred"
+			}
+
+			if strings.HasPrefix(name, "*_") {
+
+				if strings.Contains(str_names, "|") {
+					msg := fmt.Sprintf("Invalid name '%s', wildcards can not be combined with other names", str_names)
+					return nil, errors.New(msg)
+				}
+
+				s.wildcards = append(s.wildcards, strings.TrimPrefix(name, "*"))
+				continue
+			}
+
+			_, err := tags.NewLangTag(name)
+
+			if err != nil {
+				msg := fmt.Sprintf("Invalid name '%s', %s", name, err)
+				return nil, errors.New(msg)
+			}
+
+			column = append(column, name)
+		}
+
+		if len(column) == 0 {
+			continue
+		}
+
+		s.columns = append(s.columns, column)
+		s.seen[column[0]] = true
+	}
+
+	return &s, nil
+}
+
+// NeedsExpanding returns true if any of the schema's names use a wildcard.
+
+func (s *NamesSchema) NeedsExpanding() bool {
+	return len(s.wildcards) > 0
+}
+
+// ExpandFromFeature adds a column for each of f's names that match one of the
+// schema's wildcards and that aren't already a column. Columns added this way
+// follow the schema's other columns, sorted by name.
+
+func (s *NamesSchema) ExpandFromFeature(f geojson.Feature) {
+
+	if !s.NeedsExpanding() {
+		return
+	}
+
+	for name := range whosonfirst.Names(f) {
+
+		if s.seen[name] {
+			continue
+		}
+
+		for _, suffix := range s.wildcards {
+
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+
+			_, err := tags.NewLangTag(name)
+
+			if err != nil {
+				continue
+			}
+
+			s.seen[name] = true
+			s.expanded = append(s.expanded, name)
+			break
+		}
+	}
+
+	sort.Strings(s.expanded)
+}
+
+func (s *NamesSchema) allColumns() [][]string {
+
+	columns := make([][]string, len(s.columns))
+	copy(columns, s.columns)
+
+	for _, name := range s.expanded {
+		columns = append(columns, []string{name})
+	}
+
+	return columns
+}
+
+// Fields returns a column for each name. Preferred names are written to a
+// column named after their language, for example "NAME_FRA". The columns for
+// other names are named after their property (see also DBFFieldName).
+
+func (s *NamesSchema) Fields() []SchemaField {
+
+	columns := s.allColumns()
+	fields := make([]SchemaField, len(columns))
+
+	for i, column := range columns {
+
+		field := SchemaField{
+			Property: "name:" + column[0],
+			Type:     FIELD_STRING,
+			Size:     NAME_FIELD_SIZE,
+		}
+
+		if strings.HasSuffix(column[0], "_x_preferred") {
+
+			name := "NAME_" + strings.ToUpper(strings.TrimSuffix(column[0], "_x_preferred"))
+
+			if len(name) <= 10 {
+				field.Name = name
+			}
+		}
+
+		fields[i] = field
+	}
+
+	return fields
+}
+
+func (s *NamesSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	columns := s.allColumns()
+	row := make([]interface{}, len(columns))
+
+	names := whosonfirst.Names(f)
+
+	for i, column := range columns {
+
+		for _, name := range column {
+
+			values, ok := names[name]
+
+			if ok && len(values) > 0 && values[0] != "" {
+				row[i] = values[0]
+				break
+			}
+		}
+
+		if row[i] == nil && s.Fallback == NAME_FALLBACK_DEFAULT {
+			row[i] = whosonfirst.Name(f)
+		}
+	}
+
+	return row, nil
+}
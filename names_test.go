@@ -0,0 +1,275 @@
+package shapefile
+
+import (
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewNamesSchema(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		names    []string
+		columns  [][]string
+		wildcard bool
+		ok       bool
+	}{
+		{"shorthand", []string{"fra"}, [][]string{{"fra_x_preferred"}}, false, true},
+		{"prefix", []string{"name:jpn_x_preferred"}, [][]string{{"jpn_x_preferred"}}, false, true},
+		{"fallbacks", []string{"fra|eng_x_variant"}, [][]string{{"fra_x_preferred", "eng_x_variant"}}, false, true},
+		{"wildcard", []string{"fra", "*_x_preferred"}, [][]string{{"fra_x_preferred"}}, true, true},
+		{"wildcard with fallbacks", []string{"*_x_preferred|eng"}, nil, false, false},
+		{"invalid", []string{"not a language_x_preferred"}, nil, false, false},
+	}
+
+	for _, test := range tests {
+
+		s, err := NewNamesSchema(test.names, NAME_FALLBACK_NONE)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Errorf("%s: expected an error", test.label)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		if fmt.Sprint(s.columns) != fmt.Sprint(test.columns) {
+			t.Errorf("%s: expected columns %v but got %v", test.label, test.columns, s.columns)
+		}
+
+		if s.NeedsExpanding() != test.wildcard {
+			t.Errorf("%s: expected NeedsExpanding to be %t", test.label, test.wildcard)
+		}
+	}
+
+	_, err := NewNamesSchema([]string{"fra"}, "sometimes")
+
+	if err == nil {
+		t.Error("expected an invalid fallback to fail")
+	}
+}
+
+func TestNamesSchemaExpand(t *testing.T) {
+
+	s, err := NewNamesSchema([]string{"fra", "*_x_preferred"}, NAME_FALLBACK_NONE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	features := []string{
+		`{"name:jpn_x_preferred":["東京"],"name:fra_x_preferred":["Tokyo"],"name:eng_x_variant":["Edo"]}`,
+		`{"name:deu_x_preferred":["Tokio"],"name:jpn_x_preferred":["東京"]}`,
+	}
+
+	for _, props := range features {
+		s.ExpandFromFeature(testFeature(t, `{"type":"Feature","properties":`+props+`,"geometry":{"type":"Point","coordinates":[0,0]}}`))
+	}
+
+	// explicit columns come first, followed by expanded columns sorted by
+	// name and without the names that are already a column
+
+	expected := []string{"name:fra_x_preferred", "name:deu_x_preferred", "name:jpn_x_preferred"}
+	fields := s.Fields()
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields but got %v", len(expected), fields)
+	}
+
+	for i, field := range fields {
+
+		if field.Property != expected[i] {
+			t.Errorf("field %d: expected %s but got %s", i, expected[i], field.Property)
+		}
+	}
+}
+
+func TestNamesSchemaFields(t *testing.T) {
+
+	s, err := NewNamesSchema([]string{"fra", "jpn_x_preferred|eng", "eng_x_variant"}, NAME_FALLBACK_NONE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// preferred names are named after their language (after the first
+	// name in the column) and other names by the writer, from their
+	// property
+
+	expected := []SchemaField{
+		{Name: "NAME_FRA", Property: "name:fra_x_preferred", Type: FIELD_STRING, Size: NAME_FIELD_SIZE},
+		{Name: "NAME_JPN", Property: "name:jpn_x_preferred", Type: FIELD_STRING, Size: NAME_FIELD_SIZE},
+		{Name: "", Property: "name:eng_x_variant", Type: FIELD_STRING, Size: NAME_FIELD_SIZE},
+	}
+
+	fields := s.Fields()
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields but got %v", len(expected), fields)
+	}
+
+	for i, field := range fields {
+
+		if field != expected[i] {
+			t.Errorf("field %d: expected %+v but got %+v", i, expected[i], field)
+		}
+	}
+
+	mapped, err := mapFieldNames(fields, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mapped[2].Name != "NAME_ENG_X" {
+		t.Errorf("expected the variant column to be named NAME_ENG_X but got %s", mapped[2].Name)
+	}
+}
+
+func TestNamesSchemaRow(t *testing.T) {
+
+	names := []string{"fra|eng", "jpn"}
+
+	tests := []struct {
+		label    string
+		fallback string
+		props    string
+		expected []interface{}
+	}{
+		{
+			"first name",
+			NAME_FALLBACK_NONE,
+			`"wof:name":"Tokyo","name:fra_x_preferred":["Tokyo (fr)"],"name:eng_x_preferred":["Tokyo (en)"],"name:jpn_x_preferred":["東京"]`,
+			[]interface{}{"Tokyo (fr)", "東京"},
+		},
+		{
+			"second name",
+			NAME_FALLBACK_NONE,
+			`"wof:name":"Tokyo","name:eng_x_preferred":["Tokyo (en)"]`,
+			[]interface{}{"Tokyo (en)", nil},
+		},
+		{
+			"empty name",
+			NAME_FALLBACK_NONE,
+			`"wof:name":"Tokyo","name:fra_x_preferred":[""],"name:eng_x_preferred":["Tokyo (en)"]`,
+			[]interface{}{"Tokyo (en)", nil},
+		},
+		{
+			"default fallback",
+			NAME_FALLBACK_DEFAULT,
+			`"wof:name":"Tokyo","name:jpn_x_preferred":["東京"]`,
+			[]interface{}{"Tokyo", "東京"},
+		},
+	}
+
+	for _, test := range tests {
+
+		s, err := NewNamesSchema(names, test.fallback)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row, err := s.Row(testFeature(t, `{"type":"Feature","properties":{`+test.props+`},"geometry":{"type":"Point","coordinates":[0,0]}}`))
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		for i, v := range row {
+
+			if v != test.expected[i] {
+				t.Errorf("%s: expected value %d to be %v but got %v", test.label, i, test.expected[i], v)
+			}
+		}
+	}
+}
+
+func TestWriterManyNames(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "names")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	// a country with 140 preferred names, which would make records wider
+	// than a DBF file allows if every column was 254 bytes wide
+
+	props := make([]string, 0)
+
+	for i := 0; i < 140; i++ {
+		lang := fmt.Sprintf("%c%c%c", 'a'+i/26/26%26, 'a'+i/26%26, 'a'+i%26)
+		props = append(props, fmt.Sprintf(`"name:%s_x_preferred":["%s"]`, lang, strings.Repeat("x", 100)))
+	}
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1,`+strings.Join(props, ",")+`},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,10],[10,10],[10,0],[0,0]]]}}`)
+
+	s, err := NewNamesSchema([]string{"*_x_preferred"}, NAME_FALLBACK_NONE)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.ExpandFromFeature(f)
+
+	if len(s.Fields()) != 140 {
+		t.Fatalf("expected 140 name columns but got %d", len(s.Fields()))
+	}
+
+	opts := NewDefaultWriterOptions()
+	opts.Schema = NewMultiSchema(NewDefaultSchema(), s)
+	opts.Overflow = OVERFLOW_CSV
+
+	path := filepath.Join(root, "names.shp")
+
+	wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = wr.AddFeature(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := shp.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdr.Close()
+
+	for rdr.Next() {
+
+		value := rdr.ReadAttribute(0, 5)
+
+		if value != strings.Repeat("x", NAME_FIELD_SIZE) {
+			t.Errorf("expected the first name to be truncated to %d bytes but got '%s'", NAME_FIELD_SIZE, value)
+		}
+	}
+}
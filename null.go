@@ -0,0 +1,133 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"io"
+	"os"
+	"strings"
+)
+
+// The name of the DBF field used to record why a feature's geometry was
+// rejected when WriterOptions.NullShapes is true.
+
+const NULL_REASON_FIELD = "NULL_WHY"
+
+func (wr *Writer) addNullFeature(f geojson.Feature, report *ShapeReport, reason error) (int32, error) {
+
+	row, err := wr.rowForFeature(f)
+
+	if err != nil {
+		return -1, err
+	}
+
+	s := shp.Null{}
+
+	idx := wr.shapewriter.Write(&s)
+	wr.count += 1
+
+	wr.nulls = append(wr.nulls, idx)
+
+	i := int(idx)
+	wr.writeAttributes(i, nil, row, report)
+
+	wr.writeAttribute(i, wr.null_idx, reason.Error())
+
+	err = wr.flushOverflow(i, f)
+
+	if err != nil {
+		return idx, err
+	}
+
+	return idx, nil
+}
+
+// patchNullShapes updates the shape type of every Null record written to the
+// .shp file. go-shp writes each record using the shape type of the file
+// (rather than the record) which would mean that readers try to parse the
+// (empty) Null records as, say, polygons. go-shp also includes the (0,0)
+// bounding box of Null records in the file's bounding box so the headers of
+// both the .shp and .shx files are updated to use the bounding box of the
+// other records. This needs to happen after the shapewriter has been closed.
+
+func (wr *Writer) patchNullShapes() error {
+
+	if len(wr.nulls) == 0 {
+		return nil
+	}
+
+	root := strings.TrimSuffix(wr.path, ".shp")
+
+	shx, err := os.OpenFile(root+".shx", os.O_RDWR, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer shx.Close()
+
+	fh, err := os.OpenFile(root+".shp", os.O_RDWR, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer fh.Close()
+
+	for _, idx := range wr.nulls {
+
+		// the .shx header is 100 bytes followed by an 8 byte (offset,
+		// length) pair for each record where the offset is measured
+		// in 16-bit words...
+
+		_, err := shx.Seek(100+(int64(idx)*8), io.SeekStart)
+
+		if err != nil {
+			return err
+		}
+
+		var offset int32
+
+		err = binary.Read(shx, binary.BigEndian, &offset)
+
+		if err != nil {
+			return err
+		}
+
+		// ...and each record in the .shp file starts with an 8 byte
+		// header (record number, content length) followed by the
+		// shape type
+
+		_, err = fh.Seek((int64(offset)*2)+8, io.SeekStart)
+
+		if err != nil {
+			return err
+		}
+
+		err = binary.Write(fh, binary.LittleEndian, int32(shp.NULL))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the bounding box starts at byte 36 of both file headers
+
+	for _, w := range []*os.File{fh, shx} {
+
+		_, err := w.Seek(36, io.SeekStart)
+
+		if err != nil {
+			return err
+		}
+
+		err = binary.Write(w, binary.LittleEndian, wr.bbox)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
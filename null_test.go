@@ -0,0 +1,110 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterNullShapes(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "shapefile")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,10],[0,0]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Polygon","coordinates":[[[10,10],[10,20],[20,20],[20,10],[10,10]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":3},"geometry":{"type":"Polygon","coordinates":[[[30,30],[30,40],[30,30]]]}}`,
+	}
+
+	path := filepath.Join(root, "nulls.shp")
+
+	opts := NewDefaultWriterOptions()
+	opts.NullShapes = true
+
+	wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range features {
+
+		f, err := feature.NewGeoJSONFeature([]byte(body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = wr.AddFeature(f)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := shp.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdr.Close()
+
+	expected_bbox := shp.Box{MinX: 10, MinY: 10, MaxX: 20, MaxY: 20}
+
+	if !boxEquals(rdr.BBox(), expected_bbox) {
+		t.Errorf("expected a file bounding box of %v but got %v", expected_bbox, rdr.BBox())
+	}
+
+	why_idx := -1
+
+	for i, f := range rdr.Fields() {
+
+		if f.String() == NULL_REASON_FIELD {
+			why_idx = i
+		}
+	}
+
+	if why_idx == -1 {
+		t.Fatalf("missing %s field", NULL_REASON_FIELD)
+	}
+
+	expected_null := []bool{true, false, true}
+
+	for rdr.Next() {
+
+		i, s := rdr.Shape()
+
+		_, is_null := s.(*shp.Null)
+
+		if is_null != expected_null[i] {
+			t.Errorf("record %d: expected null to be %t but got %T", i, expected_null[i], s)
+		}
+
+		why := strings.TrimSpace(rdr.ReadAttribute(i, why_idx))
+
+		if is_null && why == "" {
+			t.Errorf("record %d: expected a reason for the null shape", i)
+		}
+
+		if !is_null && why != "" {
+			t.Errorf("record %d: expected no reason but got '%s'", i, why)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Formats for the table that text values are written to, in full, when they
+// are too wide for their field. "csv" writes a ".overflow.csv" file with an
+// (id, record, field, value) row for each truncated value. "dbt" writes a
+// dBASE III memo (.dbt) file and adds an OVERFLOW memo field pointing to a
+// block that holds the record's full values. Either way the names of the
+// fields that were truncated are listed in the record's TRUNCATED field.
+
+const (
+	OVERFLOW_NONE = "none"
+	OVERFLOW_CSV  = "csv"
+	OVERFLOW_DBT  = "dbt"
+)
+
+func OverflowFormats() []string {
+
+	return []string{
+		OVERFLOW_CSV,
+		OVERFLOW_DBT,
+		OVERFLOW_NONE,
+	}
+}
+
+func IsValidOverflowFormat(test string) bool {
+
+	valid := false
+
+	for _, format := range OverflowFormats() {
+
+		if format == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The names of the DBF fields used to list the fields that were truncated and,
+// for the "dbt" format, to point to the memo block holding their full values.
+
+const (
+	TRUNCATED_FIELD = "TRUNCATED"
+	OVERFLOW_FIELD  = "OVERFLOW"
+)
+
+// The size of a block in a dBASE III memo file. The first block is the file's
+// header and each memo ends with two 0x1A bytes.
+
+const dbt_block_size = 512
+
+type overflowValue struct {
+	Field string
+	Value string
+}
+
+// overflowMemo is the contents of a memo block, encoded as JSON. Non-ASCII
+// characters are escaped so that memos are the same whatever the encoding of
+// the DBF file.
+
+type overflowMemo struct {
+	Id     int64             `json:"id"`
+	Record int               `json:"record"`
+	Values map[string]string `json:"values"`
+}
+
+type overflowTable struct {
+	format string
+	path   string
+	fh     *os.File
+	csv_wr *csv.Writer
+	blocks uint32
+}
+
+func newOverflowTable(shp_path string, format string) (*overflowTable, error) {
+
+	var path string
+
+	switch format {
+	case OVERFLOW_CSV:
+		path = strings.Replace(shp_path, ".shp", ".overflow.csv", -1)
+	case OVERFLOW_DBT:
+		path = strings.Replace(shp_path, ".shp", ".dbt", -1)
+	default:
+		return nil, errors.New("Invalid overflow format")
+	}
+
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := overflowTable{
+		format: format,
+		path:   path,
+		fh:     fh,
+	}
+
+	if format == OVERFLOW_CSV {
+		t.csv_wr = csv.NewWriter(fh)
+		err = t.csv_wr.Write([]string{"id", "record", "field", "value"})
+	} else {
+		t.blocks = 1
+		_, err = fh.Write(make([]byte, dbt_block_size))
+	}
+
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Write adds the full values of record's truncated fields to the table. For
+// the "dbt" format it returns the number of the memo block they were written
+// to, otherwise -1.
+
+func (t *overflowTable) Write(id int64, record int, values []overflowValue) (int, error) {
+
+	if t.format == OVERFLOW_CSV {
+
+		str_id := strconv.FormatInt(id, 10)
+		str_record := strconv.Itoa(record)
+
+		for _, v := range values {
+			t.csv_wr.Write([]string{str_id, str_record, v.Field, v.Value})
+		}
+
+		return -1, t.csv_wr.Error()
+	}
+
+	memo := overflowMemo{
+		Id:     id,
+		Record: record,
+		Values: make(map[string]string),
+	}
+
+	for _, v := range values {
+		memo.Values[v.Field] = v.Value
+	}
+
+	enc_memo, err := json.Marshal(memo)
+
+	if err != nil {
+		return -1, err
+	}
+
+	body := []byte(escapeNonASCII(string(enc_memo)))
+	body = append(body, 0x1A, 0x1A)
+
+	if len(body)%dbt_block_size != 0 {
+		padding := dbt_block_size - (len(body) % dbt_block_size)
+		body = append(body, make([]byte, padding)...)
+	}
+
+	_, err = t.fh.Write(body)
+
+	if err != nil {
+		return -1, err
+	}
+
+	block := t.blocks
+	t.blocks += uint32(len(body) / dbt_block_size)
+
+	return int(block), nil
+}
+
+// Close flushes the table and, for the "dbt" format, records the next free
+// block in the memo file's header.
+
+func (t *overflowTable) Close() error {
+
+	var err error
+
+	if t.format == OVERFLOW_CSV {
+
+		t.csv_wr.Flush()
+		err = t.csv_wr.Error()
+
+	} else {
+
+		_, err = t.fh.Seek(0, io.SeekStart)
+
+		if err == nil {
+			err = binary.Write(t.fh, binary.LittleEndian, t.blocks)
+		}
+	}
+
+	if err != nil {
+		t.fh.Close()
+		msg := fmt.Sprintf("Failed to write %s because %s", t.path, err)
+		return errors.New(msg)
+	}
+
+	return t.fh.Close()
+}
+
+// escapeNonASCII replaces the non-ASCII characters in enc_json, an encoded
+// JSON document, with \u escape sequences.
+
+func escapeNonASCII(enc_json string) string {
+
+	var b strings.Builder
+
+	for _, r := range enc_json {
+
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+
+		if r > 0xFFFF {
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&b, "\\u%04x\\u%04x", r1, r2)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\\u%04x", r)
+	}
+
+	return b.String()
+}
+
+// flushOverflow writes the full values of the text fields of record i that
+// were truncated to the writer's overflow table and flags the record. This
+// needs to happen after all of the record's attributes have been written.
+
+func (wr *Writer) flushOverflow(i int, f geojson.Feature) error {
+
+	if wr.overflow == nil || len(wr.pending) == 0 {
+		return nil
+	}
+
+	values := wr.pending
+	wr.pending = make([]overflowValue, 0)
+
+	names := make([]string, len(values))
+
+	for idx, v := range values {
+		names[idx] = v.Field
+	}
+
+	sort.Strings(names)
+
+	// field names are ASCII so there's no need to encode them
+
+	str_names := strings.Join(names, ",")
+
+	if len(str_names) > int(wr.fields[wr.truncated_idx].Size) {
+		str_names = str_names[0:wr.fields[wr.truncated_idx].Size]
+	}
+
+	wr.writeAttribute(i, wr.truncated_idx, str_names)
+
+	block, err := wr.overflow.Write(whosonfirst.Id(f), i, values)
+
+	if err != nil {
+		msg := fmt.Sprintf("Failed to write overflow for %s because %s", f.Id(), err)
+		return errors.New(msg)
+	}
+
+	if wr.overflow_idx != -1 {
+		wr.writeAttribute(i, wr.overflow_idx, fmt.Sprintf("%10d", block))
+	}
+
+	return nil
+}
+
+// closeOverflow closes the writer's overflow table and, for the "dbt" format,
+// sets the version byte of the DBF file to 0x83 (dBASE III with memo) which
+// readers use to decide whether to open the memo file. This needs to happen
+// after the shapewriter has been closed.
+
+func (wr *Writer) closeOverflow() error {
+
+	if wr.overflow == nil {
+		return nil
+	}
+
+	err := wr.overflow.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if wr.overflow.format != OVERFLOW_DBT {
+		return nil
+	}
+
+	dbf_path := strings.Replace(wr.path, ".shp", ".dbf", -1)
+
+	fh, err := os.OpenFile(dbf_path, os.O_RDWR, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fh.Write([]byte{0x83})
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	return fh.Close()
+}
@@ -0,0 +1,186 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriterOverflow(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "overflow")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	long_name := strings.Repeat("Llanfairpwllgwyngyll ", 5)
+
+	names := []string{long_name, "Short"}
+	features := make([]string, len(names))
+
+	for i, name := range names {
+		features[i] = `{"type":"Feature","properties":{"wof:id":` + strconv.Itoa(i+1) + `,"wof:name":"` + name + `","wof:placetype":"locality","wof:repo":"whosonfirst-data","wof:parent_id":-1,"wof:hierarchy":[],"geom:latitude":0,"geom:longitude":0,"geom:bbox":"0,0,0,0"},"geometry":{"type":"Point","coordinates":[0,0]}}`
+	}
+
+	for _, format := range []string{OVERFLOW_CSV, OVERFLOW_DBT} {
+
+		path := filepath.Join(root, format+".shp")
+		path_root := strings.TrimSuffix(path, ".shp")
+
+		opts := NewDefaultWriterOptions()
+		opts.Overflow = format
+
+		wr, err := NewWriterWithOptions(path, shp.POINT, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range features {
+
+			f, err := feature.NewWOFFeature([]byte(body))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = wr.AddFeature(f)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the sidecar
+
+		switch format {
+
+		case OVERFLOW_CSV:
+
+			body, err := ioutil.ReadFile(path_root + ".overflow.csv")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := "id,record,field,value\n1,0,NAME," + long_name + "\n"
+
+			if string(body) != expected {
+				t.Errorf("%s: expected overflow table '%s' but got '%s'", format, expected, body)
+			}
+
+		case OVERFLOW_DBT:
+
+			body, err := ioutil.ReadFile(path_root + ".dbt")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(body) != 2*dbt_block_size {
+				t.Fatalf("%s: expected a memo file of %d bytes but got %d", format, 2*dbt_block_size, len(body))
+			}
+
+			next := binary.LittleEndian.Uint32(body[0:4])
+
+			if next != 2 {
+				t.Errorf("%s: expected the next free block to be 2 but got %d", format, next)
+			}
+
+			expected := `{"id":1,"record":0,"values":{"NAME":"` + long_name + `"}}` + "\x1a\x1a"
+			memo := body[dbt_block_size : dbt_block_size+len(expected)]
+
+			if string(memo) != expected {
+				t.Errorf("%s: expected memo '%s' but got '%s'", format, expected, memo)
+			}
+
+			if len(bytes.Trim(body[dbt_block_size+len(expected):], "\x00")) != 0 {
+				t.Errorf("%s: expected the memo block to be padded with NUL bytes", format)
+			}
+		}
+
+		// the DBF version byte
+
+		dbf, err := ioutil.ReadFile(path_root + ".dbf")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version := byte(0x03)
+
+		if format == OVERFLOW_DBT {
+			version = 0x83
+		}
+
+		if dbf[0] != version {
+			t.Errorf("%s: expected a DBF version of 0x%02x but got 0x%02x", format, version, dbf[0])
+		}
+
+		// the TRUNCATED and OVERFLOW cells, which ReadAttribute trims
+		// spaces (but not NUL bytes) from
+
+		rdr, err := shp.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fields := make(map[string]int)
+
+		for i, f := range rdr.Fields() {
+			fields[f.String()] = i
+		}
+
+		expected_truncated := []string{"NAME", ""}
+		expected_overflow := []string{"1", ""}
+
+		for i := 0; i < len(names); i++ {
+
+			truncated := rdr.ReadAttribute(i, fields[TRUNCATED_FIELD])
+
+			if truncated != expected_truncated[i] {
+				t.Errorf("%s: expected record %d to have TRUNCATED '%q' but got '%q'", format, i, expected_truncated[i], truncated)
+			}
+
+			idx, ok := fields[OVERFLOW_FIELD]
+
+			if format != OVERFLOW_DBT {
+
+				if ok {
+					t.Errorf("%s: unexpected %s field", format, OVERFLOW_FIELD)
+				}
+
+				continue
+			}
+
+			if !ok {
+				t.Fatalf("%s: missing %s field", format, OVERFLOW_FIELD)
+			}
+
+			overflow := rdr.ReadAttribute(i, idx)
+
+			if overflow != expected_overflow[i] {
+				t.Errorf("%s: expected record %d to have OVERFLOW '%q' but got '%q'", format, i, expected_overflow[i], overflow)
+			}
+		}
+
+		rdr.Close()
+	}
+}
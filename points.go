@@ -0,0 +1,421 @@
+package shapefile
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"math"
+	"strings"
+)
+
+// The name of the DBF field used to record the source of POINT shapes.
+
+const POINT_SOURCE_FIELD = "PT_SOURCE"
+
+// Point sources that are computed from a feature's geometry rather than read
+// from its properties. "centroid" is the area-weighted (mathematical) centroid
+// of a feature's polygons, which may fall outside of them. "pia" is the pole
+// of inaccessibility of a feature's largest polygon, which is guaranteed to
+// fall inside it. "nullisland" is always 0,0 and is mostly useful as the last
+// item in a list of sources.
+
+const (
+	POINT_SOURCE_CENTROID   = "centroid"
+	POINT_SOURCE_PIA        = "pia"
+	POINT_SOURCE_NULLISLAND = "nullisland"
+)
+
+// DefaultPointSources returns the list of point sources that mirrors the
+// behaviour of whosonfirst.Centroid.
+
+func DefaultPointSources() []string {
+
+	return []string{
+		"lbl",
+		"reversegeo",
+		"geom",
+		POINT_SOURCE_NULLISLAND,
+	}
+}
+
+// PointForFeature returns a point for f, and the name of the source it was
+// derived from, using the first source in sources that can be resolved. Any
+// source that is not a computed source (see above) is treated as a property
+// prefix such that "lbl" (or "lbl:") is resolved using the "lbl:latitude" and
+// "lbl:longitude" properties, both of which must be numbers.
+
+func PointForFeature(f geojson.Feature, sources []string) (shp.Point, string, error) {
+
+	for _, source := range sources {
+
+		source = strings.TrimSuffix(source, ":")
+
+		var pt shp.Point
+		var err error
+
+		switch source {
+		case POINT_SOURCE_CENTROID:
+			pt, err = centroidForFeature(f)
+		case POINT_SOURCE_PIA:
+			pt, err = poleOfInaccessibilityForFeature(f)
+		case POINT_SOURCE_NULLISLAND:
+			pt = shp.Point{X: 0.0, Y: 0.0}
+		default:
+			pt, err = pointForPropertyPrefix(f, source)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		return pt, source, nil
+	}
+
+	msg := fmt.Sprintf("Unable to derive a point from any of the following sources: %s", strings.Join(sources, ","))
+	return shp.Point{}, "", errors.New(msg)
+}
+
+func pointForPropertyPrefix(f geojson.Feature, prefix string) (shp.Point, error) {
+
+	lat := gjson.GetBytes(f.Bytes(), fmt.Sprintf("properties.%s:latitude", prefix))
+	lon := gjson.GetBytes(f.Bytes(), fmt.Sprintf("properties.%s:longitude", prefix))
+
+	if !lat.Exists() || !lon.Exists() {
+		msg := fmt.Sprintf("Missing %s:latitude or %s:longitude properties", prefix, prefix)
+		return shp.Point{}, errors.New(msg)
+	}
+
+	if lat.Type != gjson.Number || lon.Type != gjson.Number {
+		msg := fmt.Sprintf("Invalid %s:latitude or %s:longitude properties, expected numbers", prefix, prefix)
+		return shp.Point{}, errors.New(msg)
+	}
+
+	return shp.Point{X: lon.Float(), Y: lat.Float()}, nil
+}
+
+// centroidForFeature returns the area-weighted centroid of the polygons in f
+// or the mean of its vertices for geometries without any area.
+
+func centroidForFeature(f geojson.Feature) (shp.Point, error) {
+
+	g := gjson.GetBytes(f.Bytes(), "geometry")
+
+	polys, err := polygonsForGeometry(g)
+
+	if err == nil && len(polys) > 0 {
+
+		pt, ok := polygonsCentroid(polys)
+
+		if ok {
+			return pt, nil
+		}
+	}
+
+	pts, err := pointsForGeometry(g)
+
+	if err != nil {
+		return shp.Point{}, err
+	}
+
+	if len(pts) == 0 {
+		return shp.Point{}, errors.New("Geometry has no vertices")
+	}
+
+	x := 0.0
+	y := 0.0
+
+	for _, pt := range pts {
+		x += pt.X
+		y += pt.Y
+	}
+
+	count := float64(len(pts))
+	return shp.Point{X: x / count, Y: y / count}, nil
+}
+
+func polygonsCentroid(polys [][][]shp.Point) (shp.Point, bool) {
+
+	total_area := 0.0
+	total_x := 0.0
+	total_y := 0.0
+
+	for _, rings := range polys {
+
+		for i, ring := range rings {
+
+			ring = closeRing(ring)
+
+			a := ringArea(ring)
+
+			if a == 0.0 {
+				continue
+			}
+
+			cx := 0.0
+			cy := 0.0
+
+			for j := 0; j < len(ring)-1; j++ {
+				cross := (ring[j].X * ring[j+1].Y) - (ring[j+1].X * ring[j].Y)
+				cx += (ring[j].X + ring[j+1].X) * cross
+				cy += (ring[j].Y + ring[j+1].Y) * cross
+			}
+
+			cx = cx / (6.0 * a)
+			cy = cy / (6.0 * a)
+
+			// exterior rings add area, interior rings (holes) subtract it
+
+			w := math.Abs(a)
+
+			if i > 0 {
+				w = -w
+			}
+
+			total_area += w
+			total_x += cx * w
+			total_y += cy * w
+		}
+	}
+
+	if total_area == 0.0 {
+		return shp.Point{}, false
+	}
+
+	return shp.Point{X: total_x / total_area, Y: total_y / total_area}, true
+}
+
+// poleOfInaccessibilityForFeature returns the pole of inaccessibility (the
+// point inside a polygon that is furthest from its edges) for the largest
+// polygon in f. This is a port of https://github.com/mapbox/polylabel
+
+func poleOfInaccessibilityForFeature(f geojson.Feature) (shp.Point, error) {
+
+	g := gjson.GetBytes(f.Bytes(), "geometry")
+
+	polys, err := polygonsForGeometry(g)
+
+	if err != nil {
+		return shp.Point{}, err
+	}
+
+	var largest [][]shp.Point
+	largest_area := 0.0
+
+	for _, rings := range polys {
+
+		a := polygonArea(rings)
+
+		if largest == nil || a > largest_area {
+			largest = rings
+			largest_area = a
+		}
+	}
+
+	if largest == nil {
+		return shp.Point{}, errors.New("Geometry has no polygons")
+	}
+
+	return poleOfInaccessibility(largest), nil
+}
+
+// polygonArea returns the (unsigned) area of the exterior ring of a polygon
+// minus the area of its holes.
+
+func polygonArea(rings [][]shp.Point) float64 {
+
+	area := 0.0
+
+	for i, ring := range rings {
+
+		a := math.Abs(ringArea(closeRing(ring)))
+
+		if i == 0 {
+			area += a
+		} else {
+			area -= a
+		}
+	}
+
+	return area
+}
+
+type piaCell struct {
+	x   float64
+	y   float64
+	h   float64
+	d   float64
+	max float64
+}
+
+func newPIACell(x float64, y float64, h float64, rings [][]shp.Point) *piaCell {
+
+	d := pointToPolygonDistance(x, y, rings)
+
+	c := piaCell{
+		x:   x,
+		y:   y,
+		h:   h,
+		d:   d,
+		max: d + (h * math.Sqrt2),
+	}
+
+	return &c
+}
+
+type piaQueue []*piaCell
+
+func (q piaQueue) Len() int {
+	return len(q)
+}
+
+func (q piaQueue) Less(i, j int) bool {
+	return q[i].max > q[j].max
+}
+
+func (q piaQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *piaQueue) Push(x interface{}) {
+	*q = append(*q, x.(*piaCell))
+}
+
+func (q *piaQueue) Pop() interface{} {
+	old := *q
+	count := len(old)
+	c := old[count-1]
+	*q = old[0 : count-1]
+	return c
+}
+
+func poleOfInaccessibility(rings [][]shp.Point) shp.Point {
+
+	box := shp.BBoxFromPoints(rings[0])
+
+	width := box.MaxX - box.MinX
+	height := box.MaxY - box.MinY
+
+	cell_size := math.Min(width, height)
+
+	if cell_size == 0.0 {
+		return shp.Point{X: box.MinX, Y: box.MinY}
+	}
+
+	// one thousandth of the longest side of the bounding box works out
+	// to be roughly 1km for a country-sized polygon and a few meters for
+	// a neighbourhood which is good enough for labeling
+
+	precision := math.Max(width, height) / 1000.0
+
+	h := cell_size / 2.0
+
+	q := make(piaQueue, 0)
+
+	for x := box.MinX; x < box.MaxX; x += cell_size {
+		for y := box.MinY; y < box.MaxY; y += cell_size {
+			heap.Push(&q, newPIACell(x+h, y+h, h, rings))
+		}
+	}
+
+	best := newPIACell(box.MinX+(width/2.0), box.MinY+(height/2.0), 0.0, rings)
+
+	c, ok := polygonsCentroid([][][]shp.Point{rings})
+
+	if ok {
+
+		centroid := newPIACell(c.X, c.Y, 0.0, rings)
+
+		if centroid.d > best.d {
+			best = centroid
+		}
+	}
+
+	for q.Len() > 0 {
+
+		cell := heap.Pop(&q).(*piaCell)
+
+		if cell.d > best.d {
+			best = cell
+		}
+
+		if cell.max-best.d <= precision {
+			continue
+		}
+
+		h = cell.h / 2.0
+
+		heap.Push(&q, newPIACell(cell.x-h, cell.y-h, h, rings))
+		heap.Push(&q, newPIACell(cell.x+h, cell.y-h, h, rings))
+		heap.Push(&q, newPIACell(cell.x-h, cell.y+h, h, rings))
+		heap.Push(&q, newPIACell(cell.x+h, cell.y+h, h, rings))
+	}
+
+	return shp.Point{X: best.x, Y: best.y}
+}
+
+// pointToPolygonDistance returns the distance from x,y to the nearest edge of
+// the polygon described by rings. The distance is negative if the point is
+// outside the polygon.
+
+func pointToPolygonDistance(x float64, y float64, rings [][]shp.Point) float64 {
+
+	inside := false
+	min_dist := math.Inf(1)
+
+	for _, ring := range rings {
+
+		count := len(ring)
+
+		for i, j := 0, count-1; i < count; j, i = i, i+1 {
+
+			a := ring[i]
+			b := ring[j]
+
+			if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+				inside = !inside
+			}
+
+			min_dist = math.Min(min_dist, segmentDistanceSquared(x, y, a, b))
+		}
+	}
+
+	d := math.Sqrt(min_dist)
+
+	if !inside {
+		d = -d
+	}
+
+	return d
+}
+
+// segmentDistanceSquared returns the squared distance from x,y to the
+// segment a,b.
+
+func segmentDistanceSquared(x float64, y float64, a shp.Point, b shp.Point) float64 {
+
+	px := a.X
+	py := a.Y
+	dx := b.X - px
+	dy := b.Y - py
+
+	if dx != 0.0 || dy != 0.0 {
+
+		t := ((x-px)*dx + (y-py)*dy) / (dx*dx + dy*dy)
+
+		if t > 1.0 {
+			px = b.X
+			py = b.Y
+		} else if t > 0.0 {
+			px += dx * t
+			py += dy * t
+		}
+	}
+
+	dx = x - px
+	dy = y - py
+
+	return dx*dx + dy*dy
+}
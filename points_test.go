@@ -0,0 +1,198 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPointForFeature(t *testing.T) {
+
+	geom := `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]]]}`
+
+	tests := []struct {
+		label      string
+		properties string
+		sources    []string
+		point      shp.Point
+		source     string
+	}{
+		{
+			label:      "first source",
+			properties: `"lbl:latitude":1,"lbl:longitude":2,"geom:latitude":3,"geom:longitude":4`,
+			sources:    DefaultPointSources(),
+			point:      shp.Point{X: 2, Y: 1},
+			source:     "lbl",
+		},
+		{
+			label:      "missing longitude",
+			properties: `"lbl:latitude":1,"geom:latitude":3,"geom:longitude":4`,
+			sources:    DefaultPointSources(),
+			point:      shp.Point{X: 4, Y: 3},
+			source:     "geom",
+		},
+		{
+			label:      "string coordinates",
+			properties: `"lbl:latitude":"1","lbl:longitude":"2","reversegeo:latitude":5,"reversegeo:longitude":6`,
+			sources:    DefaultPointSources(),
+			point:      shp.Point{X: 6, Y: 5},
+			source:     "reversegeo",
+		},
+		{
+			label:      "null coordinates",
+			properties: `"lbl:latitude":null,"lbl:longitude":null`,
+			sources:    DefaultPointSources(),
+			point:      shp.Point{X: 0, Y: 0},
+			source:     POINT_SOURCE_NULLISLAND,
+		},
+		{
+			label:      "trailing colon",
+			properties: `"mps:latitude":7,"mps:longitude":8`,
+			sources:    []string{"lbl:", "mps:"},
+			point:      shp.Point{X: 8, Y: 7},
+			source:     "mps",
+		},
+		{
+			label:      "centroid",
+			properties: `"lbl:latitude":"1","lbl:longitude":"2"`,
+			sources:    []string{"lbl", POINT_SOURCE_CENTROID},
+			point:      shp.Point{X: 5, Y: 5},
+			source:     POINT_SOURCE_CENTROID,
+		},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1,`+test.properties+`},"geometry":`+geom+`}`)
+
+		pt, source, err := PointForFeature(f, test.sources)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		if pt != test.point || source != test.source {
+			t.Errorf("%s: expected %v from %s but got %v from %s", test.label, test.point, test.source, pt, source)
+		}
+	}
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+geom+`}`)
+
+	_, _, err := PointForFeature(f, []string{"lbl", "reversegeo"})
+
+	if err == nil {
+		t.Error("expected a feature with none of the sources to fail")
+	}
+}
+
+func TestPointForFeaturePIA(t *testing.T) {
+
+	// a "C" shaped polygon whose centroid falls in the gap between its arms
+
+	ring := testRing(0, 0, 0, 10, 10, 10, 10, 8, 2, 8, 2, 2, 10, 2, 10, 0, 0, 0)
+	geom := `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,2],[2,2],[2,8],[10,8],[10,10],[0,10],[0,0]]]}`
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+geom+`}`)
+
+	centroid, _, err := PointForFeature(f, []string{POINT_SOURCE_CENTROID})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pointToPolygonDistance(centroid.X, centroid.Y, [][]shp.Point{ring}) >= 0 {
+		t.Fatalf("expected the centroid %v to fall outside the polygon", centroid)
+	}
+
+	pia, source, err := PointForFeature(f, []string{POINT_SOURCE_PIA})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source != POINT_SOURCE_PIA {
+		t.Errorf("expected a source of %s but got %s", POINT_SOURCE_PIA, source)
+	}
+
+	if pointToPolygonDistance(pia.X, pia.Y, [][]shp.Point{ring}) <= 0 {
+		t.Errorf("expected the pole of inaccessibility %v to fall inside the polygon", pia)
+	}
+}
+
+func TestWriterPointSource(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "points")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1,"lbl:latitude":1,"lbl:longitude":2},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+		`{"type":"Feature","properties":{"wof:id":2,"geom:latitude":3,"geom:longitude":4},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+		`{"type":"Feature","properties":{"wof:id":3},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+	}
+
+	expected := []string{"lbl", "geom", POINT_SOURCE_NULLISLAND}
+
+	path := filepath.Join(root, "points.shp")
+
+	wr, err := NewWriter(path, shp.POINT)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range features {
+
+		_, err = wr.AddFeature(testFeature(t, body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := shp.Open(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdr.Close()
+
+	source_idx := -1
+
+	for i, f := range rdr.Fields() {
+
+		if f.String() == POINT_SOURCE_FIELD {
+			source_idx = i
+		}
+	}
+
+	if source_idx == -1 {
+		t.Fatalf("missing %s field", POINT_SOURCE_FIELD)
+	}
+
+	for rdr.Next() {
+
+		i, _ := rdr.Shape()
+
+		source := strings.TrimSpace(rdr.ReadAttribute(i, source_idx))
+
+		if source != expected[i] {
+			t.Errorf("record %d: expected a point source of %s but got %s", i, expected[i], source)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package projection
+
+import (
+	"errors"
+	"math"
+)
+
+type Ellipsoid struct {
+	A float64 // semi-major axis
+	F float64 // flattening
+}
+
+func (e Ellipsoid) EccentricitySquared() float64 {
+	return (2.0 * e.F) - (e.F * e.F)
+}
+
+var WGS84 = Ellipsoid{A: 6378137.0, F: 1.0 / 298.257223563}
+var GRS80 = Ellipsoid{A: 6378137.0, F: 1.0 / 298.257222101}
+var AIRY_1830 = Ellipsoid{A: 6377563.396, F: 1.0 / 299.3249646}
+
+// HelmertParameters are the parameters for a seven-parameter (position vector)
+// Helmert transformation. Translations are in metres, rotations in arc-seconds
+// and scale in parts per million.
+
+type HelmertParameters struct {
+	TX float64
+	TY float64
+	TZ float64
+	RX float64
+	RY float64
+	RZ float64
+	S  float64
+}
+
+// https://www.ordnancesurvey.co.uk/documents/resources/guide-coordinate-systems-great-britain.pdf
+
+var WGS84_TO_OSGB36 = HelmertParameters{
+	TX: -446.448,
+	TY: 125.157,
+	TZ: -542.060,
+	RX: -0.1502,
+	RY: -0.2470,
+	RZ: -0.8421,
+	S:  20.4894,
+}
+
+// the latitude beyond which (spherical) web mercator coordinates are clamped
+
+const WEB_MERCATOR_MAX_LATITUDE = 85.0511287798066
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180.0
+}
+
+func degrees(r float64) float64 {
+	return r * 180.0 / math.Pi
+}
+
+func checkLatitude(lat float64) error {
+
+	if math.IsNaN(lat) || lat < -90.0 || lat > 90.0 {
+		return errors.New("Invalid latitude")
+	}
+
+	return nil
+}
+
+// helmert transforms lon, lat on the "from" ellipsoid to lon, lat on the "to"
+// ellipsoid by way of geocentric (cartesian) coordinates.
+
+func helmert(lon float64, lat float64, from Ellipsoid, to Ellipsoid, params HelmertParameters) (float64, float64) {
+
+	phi := radians(lat)
+	lambda := radians(lon)
+
+	e2 := from.EccentricitySquared()
+	nu := from.A / math.Sqrt(1.0-e2*math.Sin(phi)*math.Sin(phi))
+
+	x := nu * math.Cos(phi) * math.Cos(lambda)
+	y := nu * math.Cos(phi) * math.Sin(lambda)
+	z := (1.0 - e2) * nu * math.Sin(phi)
+
+	s := params.S * 1e-6
+	rx := radians(params.RX / 3600.0)
+	ry := radians(params.RY / 3600.0)
+	rz := radians(params.RZ / 3600.0)
+
+	x2 := params.TX + (1.0+s)*x - rz*y + ry*z
+	y2 := params.TY + rz*x + (1.0+s)*y - rx*z
+	z2 := params.TZ - ry*x + rx*y + (1.0+s)*z
+
+	e2 = to.EccentricitySquared()
+	p := math.Sqrt(x2*x2 + y2*y2)
+
+	phi = math.Atan2(z2, p*(1.0-e2))
+
+	for i := 0; i < 10; i++ {
+		nu = to.A / math.Sqrt(1.0-e2*math.Sin(phi)*math.Sin(phi))
+		phi = math.Atan2(z2+e2*nu*math.Sin(phi), p)
+	}
+
+	lambda = math.Atan2(y2, x2)
+
+	return degrees(lambda), degrees(phi)
+}
+
+// meridionalArc returns the distance along the meridian from the equator to
+// phi (Snyder 3-21)
+
+func meridionalArc(e Ellipsoid, phi float64) float64 {
+
+	e2 := e.EccentricitySquared()
+	e4 := e2 * e2
+	e6 := e4 * e2
+
+	return e.A * ((1.0-e2/4.0-3.0*e4/64.0-5.0*e6/256.0)*phi -
+		(3.0*e2/8.0+3.0*e4/32.0+45.0*e6/1024.0)*math.Sin(2.0*phi) +
+		(15.0*e4/256.0+45.0*e6/1024.0)*math.Sin(4.0*phi) -
+		(35.0*e6/3072.0)*math.Sin(6.0*phi))
+}
+
+// transverseMercator (Snyder 8-9 to 8-10)
+
+func transverseMercator(e Ellipsoid, lon0 float64, lat0 float64, k0 float64, false_easting float64, false_northing float64) projectionFunc {
+
+	e2 := e.EccentricitySquared()
+	ep2 := e2 / (1.0 - e2)
+
+	lambda0 := radians(lon0)
+	m0 := meridionalArc(e, radians(lat0))
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		phi := radians(lat)
+
+		sin_phi := math.Sin(phi)
+		cos_phi := math.Cos(phi)
+		tan_phi := math.Tan(phi)
+
+		n := e.A / math.Sqrt(1.0-e2*sin_phi*sin_phi)
+		t := tan_phi * tan_phi
+		c := ep2 * cos_phi * cos_phi
+		a := normalizeRadians(radians(lon)-lambda0) * cos_phi
+		m := meridionalArc(e, phi)
+
+		a2 := a * a
+		a3 := a2 * a
+		a4 := a3 * a
+		a5 := a4 * a
+		a6 := a5 * a
+
+		x := k0 * n * (a + (1.0-t+c)*a3/6.0 + (5.0-18.0*t+t*t+72.0*c-58.0*ep2)*a5/120.0)
+		y := k0 * (m - m0 + n*tan_phi*(a2/2.0+(5.0-t+9.0*c+4.0*c*c)*a4/24.0+(61.0-58.0*t+t*t+600.0*c-330.0*ep2)*a6/720.0))
+
+		return x + false_easting, y + false_northing, nil
+	}
+}
+
+// mercator (Snyder 7-6 to 7-7)
+
+func mercator(e Ellipsoid, lon0 float64, k0 float64) projectionFunc {
+
+	ecc := math.Sqrt(e.EccentricitySquared())
+	lambda0 := radians(lon0)
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		if math.Abs(lat) >= 90.0 {
+			return 0.0, 0.0, errors.New("Mercator is undefined at the poles")
+		}
+
+		phi := radians(lat)
+		es := ecc * math.Sin(phi)
+
+		x := e.A * k0 * normalizeRadians(radians(lon)-lambda0)
+		y := e.A * k0 * math.Log(math.Tan(math.Pi/4.0+phi/2.0)*math.Pow((1.0-es)/(1.0+es), ecc/2.0))
+
+		return x, y, nil
+	}
+}
+
+// webMercator is the spherical mercator projection, using the WGS84 semi-major
+// axis as the radius of the sphere, with latitudes clamped to +/- 85.05
+
+func webMercator() projectionFunc {
+
+	r := WGS84.A
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		lat = math.Max(-WEB_MERCATOR_MAX_LATITUDE, math.Min(WEB_MERCATOR_MAX_LATITUDE, lat))
+
+		x := r * radians(lon)
+		y := r * math.Log(math.Tan(math.Pi/4.0+radians(lat)/2.0))
+
+		return x, y, nil
+	}
+}
+
+// lambertConformalConic is the two standard parallel variant (Snyder 15-1 to
+// 15-11)
+
+func lambertConformalConic(e Ellipsoid, lon0 float64, lat0 float64, lat1 float64, lat2 float64, false_easting float64, false_northing float64) projectionFunc {
+
+	ecc := math.Sqrt(e.EccentricitySquared())
+
+	m := func(phi float64) float64 {
+		s := ecc * math.Sin(phi)
+		return math.Cos(phi) / math.Sqrt(1.0-s*s)
+	}
+
+	t := func(phi float64) float64 {
+		s := ecc * math.Sin(phi)
+		return math.Tan(math.Pi/4.0-phi/2.0) / math.Pow((1.0-s)/(1.0+s), ecc/2.0)
+	}
+
+	phi1 := radians(lat1)
+	phi2 := radians(lat2)
+
+	m1 := m(phi1)
+	m2 := m(phi2)
+	t1 := t(phi1)
+	t2 := t(phi2)
+
+	n := (math.Log(m1) - math.Log(m2)) / (math.Log(t1) - math.Log(t2))
+	f := m1 / (n * math.Pow(t1, n))
+	rho0 := e.A * f * math.Pow(t(radians(lat0)), n)
+
+	lambda0 := radians(lon0)
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		rho := 0.0
+
+		// the pole opposite the cone's apex is at infinity
+
+		if math.Abs(lat) < 90.0 {
+			rho = e.A * f * math.Pow(t(radians(lat)), n)
+		} else if lat*n < 0.0 {
+			return 0.0, 0.0, errors.New("Point can not be projected")
+		}
+
+		theta := n * normalizeRadians(radians(lon)-lambda0)
+
+		x := rho * math.Sin(theta)
+		y := rho0 - rho*math.Cos(theta)
+
+		return x + false_easting, y + false_northing, nil
+	}
+}
+
+// authalicQ (Snyder 3-12)
+
+func authalicQ(ecc float64, phi float64) float64 {
+
+	sin_phi := math.Sin(phi)
+	es := ecc * sin_phi
+
+	return (1.0 - ecc*ecc) * (sin_phi/(1.0-es*es) - (1.0/(2.0*ecc))*math.Log((1.0-es)/(1.0+es)))
+}
+
+// albersEqualArea (Snyder 14-1 to 14-6)
+
+func albersEqualArea(e Ellipsoid, lon0 float64, lat0 float64, lat1 float64, lat2 float64, false_easting float64, false_northing float64) projectionFunc {
+
+	ecc := math.Sqrt(e.EccentricitySquared())
+
+	m := func(phi float64) float64 {
+		s := ecc * math.Sin(phi)
+		return math.Cos(phi) / math.Sqrt(1.0-s*s)
+	}
+
+	phi1 := radians(lat1)
+	phi2 := radians(lat2)
+
+	m1 := m(phi1)
+	m2 := m(phi2)
+	q0 := authalicQ(ecc, radians(lat0))
+	q1 := authalicQ(ecc, phi1)
+	q2 := authalicQ(ecc, phi2)
+
+	n := (m1*m1 - m2*m2) / (q2 - q1)
+	c := m1*m1 + n*q1
+	rho0 := e.A * math.Sqrt(c-n*q0) / n
+
+	lambda0 := radians(lon0)
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		q := authalicQ(ecc, radians(lat))
+
+		rho := e.A * math.Sqrt(math.Max(0.0, c-n*q)) / n
+		theta := n * normalizeRadians(radians(lon)-lambda0)
+
+		x := rho * math.Sin(theta)
+		y := rho0 - rho*math.Cos(theta)
+
+		return x + false_easting, y + false_northing, nil
+	}
+}
+
+// lambertAzimuthalEqualArea is the oblique ellipsoidal form (Snyder 24-2 to
+// 24-20)
+
+func lambertAzimuthalEqualArea(e Ellipsoid, lon0 float64, lat0 float64, false_easting float64, false_northing float64) projectionFunc {
+
+	ecc := math.Sqrt(e.EccentricitySquared())
+
+	phi1 := radians(lat0)
+	lambda0 := radians(lon0)
+
+	qp := authalicQ(ecc, math.Pi/2.0)
+	q1 := authalicQ(ecc, phi1)
+
+	beta1 := math.Asin(q1 / qp)
+	rq := e.A * math.Sqrt(qp/2.0)
+
+	s1 := ecc * math.Sin(phi1)
+	m1 := math.Cos(phi1) / math.Sqrt(1.0-s1*s1)
+
+	d := e.A * m1 / (rq * math.Cos(beta1))
+
+	return func(lon float64, lat float64) (float64, float64, error) {
+
+		err := checkLatitude(lat)
+
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+
+		q := authalicQ(ecc, radians(lat))
+		beta := math.Asin(math.Max(-1.0, math.Min(1.0, q/qp)))
+
+		dl := normalizeRadians(radians(lon) - lambda0)
+
+		denom := 1.0 + math.Sin(beta1)*math.Sin(beta) + math.Cos(beta1)*math.Cos(beta)*math.Cos(dl)
+
+		if denom <= 0.0 {
+			return 0.0, 0.0, errors.New("Point can not be projected")
+		}
+
+		b := rq * math.Sqrt(2.0/denom)
+
+		x := b * d * math.Cos(beta) * math.Sin(dl)
+		y := (b / d) * (math.Cos(beta1)*math.Sin(beta) - math.Sin(beta1)*math.Cos(beta)*math.Cos(dl))
+
+		return x + false_easting, y + false_northing, nil
+	}
+}
+
+// normalizeRadians wraps r in to the range -PI to PI
+
+func normalizeRadians(r float64) float64 {
+
+	for r > math.Pi {
+		r -= 2.0 * math.Pi
+	}
+
+	for r < -math.Pi {
+		r += 2.0 * math.Pi
+	}
+
+	return r
+}
@@ -0,0 +1,284 @@
+package projection
+
+// Snyder, J.P. 1987. "Map Projections: A Working Manual"
+// https://pubs.usgs.gov/pp/1395/report.pdf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Projection converts WGS84 longitudes and latitudes (in decimal degrees) in to
+// the coordinate reference system identified by EPSG().
+
+type Projection interface {
+	EPSG() int
+	Name() string
+	Project(lon float64, lat float64) (float64, float64, error)
+	WKT() string
+	IsGeographic() bool
+}
+
+type projectionFunc func(lon float64, lat float64) (float64, float64, error)
+
+type wktProjection struct {
+	epsg       int
+	name       string
+	wkt        string
+	geographic bool
+	project    projectionFunc
+}
+
+func (p *wktProjection) EPSG() int {
+	return p.epsg
+}
+
+func (p *wktProjection) Name() string {
+	return p.name
+}
+
+func (p *wktProjection) Project(lon float64, lat float64) (float64, float64, error) {
+	return p.project(lon, lat)
+}
+
+func (p *wktProjection) WKT() string {
+	return p.wkt
+}
+
+func (p *wktProjection) IsGeographic() bool {
+	return p.geographic
+}
+
+// Codes returns the list of (non-UTM) EPSG codes that NewProjection knows
+// about. In addition to these all of the WGS84 UTM zones (EPSG:32601 to
+// EPSG:32660 and EPSG:32701 to EPSG:32760) are supported.
+
+func Codes() []string {
+
+	codes := make([]string, 0)
+
+	for code := range constructors {
+		codes = append(codes, fmt.Sprintf("EPSG:%d", code))
+	}
+
+	sort.Strings(codes)
+	return codes
+}
+
+// NewProjection returns a Projection for code which may be either an integer
+// ("3857") or prefixed with "EPSG:" ("EPSG:3857").
+
+func NewProjection(code string) (Projection, error) {
+
+	str_code := strings.TrimPrefix(strings.ToUpper(code), "EPSG:")
+
+	epsg, err := strconv.Atoi(str_code)
+
+	if err != nil {
+		msg := fmt.Sprintf("Invalid EPSG code '%s'", code)
+		return nil, errors.New(msg)
+	}
+
+	return NewProjectionFromEPSG(epsg)
+}
+
+func NewProjectionFromEPSG(epsg int) (Projection, error) {
+
+	if epsg > 32600 && epsg <= 32660 {
+		return newUTMProjection(epsg, epsg-32600, true), nil
+	}
+
+	if epsg > 32700 && epsg <= 32760 {
+		return newUTMProjection(epsg, epsg-32700, false), nil
+	}
+
+	constructor, ok := constructors[epsg]
+
+	if !ok {
+		msg := fmt.Sprintf("Unsupported EPSG code '%d'", epsg)
+		return nil, errors.New(msg)
+	}
+
+	return constructor(), nil
+}
+
+// all of the datums below other than OSGB 1936 (EPSG:27700) are treated as
+// being equivalent to WGS84 which is accurate to within a metre or two - if
+// you need survey-grade accuracy you should be using a proper GIS tool
+
+const GCS_WGS_1984 = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+var constructors = map[int]func() Projection{
+	4326:  newWGS84Projection,
+	3857:  newWebMercatorProjection,
+	3395:  newWorldMercatorProjection,
+	27700: newBritishNationalGridProjection,
+	2154:  newLambert93Projection,
+	3035:  newETRSLAEAProjection,
+	5070:  newConusAlbersProjection,
+	3577:  newAustraliaAlbersProjection,
+	2193:  newNZTMProjection,
+}
+
+func newWGS84Projection() Projection {
+
+	project := func(lon float64, lat float64) (float64, float64, error) {
+		return lon, lat, nil
+	}
+
+	p := wktProjection{
+		epsg:       4326,
+		name:       "WGS 84",
+		wkt:        GCS_WGS_1984,
+		geographic: true,
+		project:    project,
+	}
+
+	return &p
+}
+
+func newWebMercatorProjection() Projection {
+
+	wkt := `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",` + GCS_WGS_1984 + `,PROJECTION["Mercator_Auxiliary_Sphere"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",0.0],PARAMETER["Standard_Parallel_1",0.0],PARAMETER["Auxiliary_Sphere_Type",0.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    3857,
+		name:    "WGS 84 / Pseudo-Mercator",
+		wkt:     wkt,
+		project: webMercator(),
+	}
+
+	return &p
+}
+
+func newWorldMercatorProjection() Projection {
+
+	wkt := `PROJCS["WGS_1984_World_Mercator",` + GCS_WGS_1984 + `,PROJECTION["Mercator"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",0.0],PARAMETER["Standard_Parallel_1",0.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    3395,
+		name:    "WGS 84 / World Mercator",
+		wkt:     wkt,
+		project: mercator(WGS84, 0.0, 1.0),
+	}
+
+	return &p
+}
+
+func newUTMProjection(epsg int, zone int, north bool) Projection {
+
+	hemisphere := "N"
+	false_northing := 0.0
+
+	if !north {
+		hemisphere = "S"
+		false_northing = 10000000.0
+	}
+
+	central_meridian := float64((zone * 6) - 183)
+
+	wkt := fmt.Sprintf(`PROJCS["WGS_1984_UTM_Zone_%d%s",%s,PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",500000.0],PARAMETER["False_Northing",%.1f],PARAMETER["Central_Meridian",%.1f],PARAMETER["Scale_Factor",0.9996],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`, zone, hemisphere, GCS_WGS_1984, false_northing, central_meridian)
+
+	p := wktProjection{
+		epsg:    epsg,
+		name:    fmt.Sprintf("WGS 84 / UTM zone %d%s", zone, hemisphere),
+		wkt:     wkt,
+		project: transverseMercator(WGS84, central_meridian, 0.0, 0.9996, 500000.0, false_northing),
+	}
+
+	return &p
+}
+
+func newBritishNationalGridProjection() Projection {
+
+	wkt := `PROJCS["British_National_Grid",GEOGCS["GCS_OSGB_1936",DATUM["D_OSGB_1936",SPHEROID["Airy_1830",6377563.396,299.3249646]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",400000.0],PARAMETER["False_Northing",-100000.0],PARAMETER["Central_Meridian",-2.0],PARAMETER["Scale_Factor",0.9996012717],PARAMETER["Latitude_Of_Origin",49.0],UNIT["Meter",1.0]]`
+
+	tm := transverseMercator(AIRY_1830, -2.0, 49.0, 0.9996012717, 400000.0, -100000.0)
+
+	project := func(lon float64, lat float64) (float64, float64, error) {
+		lon, lat = helmert(lon, lat, WGS84, AIRY_1830, WGS84_TO_OSGB36)
+		return tm(lon, lat)
+	}
+
+	p := wktProjection{
+		epsg:    27700,
+		name:    "OSGB 1936 / British National Grid",
+		wkt:     wkt,
+		project: project,
+	}
+
+	return &p
+}
+
+func newLambert93Projection() Projection {
+
+	wkt := `PROJCS["RGF_1993_Lambert_93",GEOGCS["GCS_RGF_1993",DATUM["D_RGF_1993",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Lambert_Conformal_Conic"],PARAMETER["False_Easting",700000.0],PARAMETER["False_Northing",6600000.0],PARAMETER["Central_Meridian",3.0],PARAMETER["Standard_Parallel_1",49.0],PARAMETER["Standard_Parallel_2",44.0],PARAMETER["Latitude_Of_Origin",46.5],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    2154,
+		name:    "RGF93 / Lambert-93",
+		wkt:     wkt,
+		project: lambertConformalConic(GRS80, 3.0, 46.5, 49.0, 44.0, 700000.0, 6600000.0),
+	}
+
+	return &p
+}
+
+func newETRSLAEAProjection() Projection {
+
+	wkt := `PROJCS["ETRS_1989_LAEA",GEOGCS["GCS_ETRS_1989",DATUM["D_ETRS_1989",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Lambert_Azimuthal_Equal_Area"],PARAMETER["False_Easting",4321000.0],PARAMETER["False_Northing",3210000.0],PARAMETER["Central_Meridian",10.0],PARAMETER["Latitude_Of_Origin",52.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    3035,
+		name:    "ETRS89-extended / LAEA Europe",
+		wkt:     wkt,
+		project: lambertAzimuthalEqualArea(GRS80, 10.0, 52.0, 4321000.0, 3210000.0),
+	}
+
+	return &p
+}
+
+func newConusAlbersProjection() Projection {
+
+	wkt := `PROJCS["NAD_1983_Contiguous_USA_Albers",GEOGCS["GCS_North_American_1983",DATUM["D_North_American_1983",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Albers"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",-96.0],PARAMETER["Standard_Parallel_1",29.5],PARAMETER["Standard_Parallel_2",45.5],PARAMETER["Latitude_Of_Origin",23.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    5070,
+		name:    "NAD83 / Conus Albers",
+		wkt:     wkt,
+		project: albersEqualArea(GRS80, -96.0, 23.0, 29.5, 45.5, 0.0, 0.0),
+	}
+
+	return &p
+}
+
+func newAustraliaAlbersProjection() Projection {
+
+	wkt := `PROJCS["GDA_1994_Australia_Albers",GEOGCS["GCS_GDA_1994",DATUM["D_GDA_1994",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Albers"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",132.0],PARAMETER["Standard_Parallel_1",-18.0],PARAMETER["Standard_Parallel_2",-36.0],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    3577,
+		name:    "GDA94 / Australian Albers",
+		wkt:     wkt,
+		project: albersEqualArea(GRS80, 132.0, 0.0, -18.0, -36.0, 0.0, 0.0),
+	}
+
+	return &p
+}
+
+func newNZTMProjection() Projection {
+
+	wkt := `PROJCS["NZGD_2000_New_Zealand_Transverse_Mercator",GEOGCS["GCS_NZGD_2000",DATUM["D_NZGD_2000",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",1600000.0],PARAMETER["False_Northing",10000000.0],PARAMETER["Central_Meridian",173.0],PARAMETER["Scale_Factor",0.9996],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`
+
+	p := wktProjection{
+		epsg:    2193,
+		name:    "NZGD2000 / New Zealand Transverse Mercator 2000",
+		wkt:     wkt,
+		project: transverseMercator(GRS80, 173.0, 0.0, 0.9996, 1600000.0, 10000000.0),
+	}
+
+	return &p
+}
@@ -0,0 +1,82 @@
+package projection
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+
+	// expected values are from the EPSG guidance notes (number 7, part 2)
+	// or derived from them
+
+	tests := []struct {
+		code string
+		lon  float64
+		lat  float64
+		x    float64
+		y    float64
+	}{
+		{"EPSG:4326", 1.0, 2.0, 1.0, 2.0},
+		{"EPSG:3857", 10.0, 50.0, 1113194.91, 6446275.84},
+		{"EPSG:3857", 180.0, 0.0, 20037508.34, 0.0},
+		{"EPSG:3395", 120.0, 50.0, 13358338.90, 6413524.59},
+		{"EPSG:3035", 5.0, 50.0, 3962799.45, 2999718.85},
+		{"EPSG:32631", 3.0, 0.0, 500000.0, 0.0},
+		{"EPSG:32631", 3.0, 45.0, 500000.0, 4982950.40},
+	}
+
+	for _, test := range tests {
+
+		p, err := NewProjection(test.code)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s, %s", test.code, err)
+		}
+
+		x, y, err := p.Project(test.lon, test.lat)
+
+		if err != nil {
+			t.Fatalf("Failed to project %f,%f to %s, %s", test.lon, test.lat, test.code, err)
+		}
+
+		if math.Abs(x-test.x) > 0.01 || math.Abs(y-test.y) > 0.01 {
+			t.Errorf("%s: expected %f,%f for %f,%f but got %f,%f", test.code, test.x, test.y, test.lon, test.lat, x, y)
+		}
+	}
+}
+
+func TestNewProjection(t *testing.T) {
+
+	for _, code := range Codes() {
+
+		p, err := NewProjection(code)
+
+		if err != nil {
+			t.Errorf("Failed to create %s, %s", code, err)
+			continue
+		}
+
+		if p.WKT() == "" {
+			t.Errorf("%s has no WKT", code)
+		}
+	}
+
+	for _, code := range []string{"3857", "epsg:3857", "EPSG:32760"} {
+
+		_, err := NewProjection(code)
+
+		if err != nil {
+			t.Errorf("Failed to create %s, %s", code, err)
+		}
+	}
+
+	for _, code := range []string{"", "EPSG:", "EPSG:1234", "EPSG:32661"} {
+
+		_, err := NewProjection(code)
+
+		if err == nil {
+			t.Errorf("Expected %s to be rejected", code)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package shapefile
+
+import (
+	"errors"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
+	"math"
+)
+
+// The default maximum length, in decimal degrees, of an edge before it is
+// densified when reprojecting shapes. See ProjectShape for details.
+
+const DEFAULT_DENSIFY = 0.1
+
+// ProjectShape returns a copy of s (whose coordinates are WGS84 longitudes
+// and latitudes) with its coordinates projected using proj. Before being
+// projected the edges of POLYLINE and POLYGON shapes that are longer than
+// densify decimal degrees are split so that they still follow the (curved)
+// path of the original edge in the new coordinate system. If densify is 0
+// edges are not split.
+
+func ProjectShape(s shp.Shape, proj projection.Projection, densify float64) (shp.Shape, error) {
+
+	if proj.IsGeographic() {
+		return s, nil
+	}
+
+	switch shape := s.(type) {
+
+	case *shp.Point:
+
+		pt, err := projectPoint(*shape, proj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &pt, nil
+
+	case *shp.MultiPoint:
+
+		points, err := projectPoints(shape.Points, proj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		multi := shp.MultiPoint{
+			Box:       shp.BBoxFromPoints(points),
+			NumPoints: int32(len(points)),
+			Points:    points,
+		}
+
+		return &multi, nil
+
+	case *shp.PolyLine:
+
+		parts, err := projectParts(shapeParts(shape.Parts, shape.Points), proj, densify)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return shp.NewPolyLine(parts), nil
+
+	case *shp.Polygon:
+
+		rings, err := projectParts(shapeParts(shape.Parts, shape.Points), proj, densify)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return newPolygon(rings), nil
+
+	default:
+		return nil, errors.New("Unsupported shape type")
+	}
+}
+
+func projectParts(parts [][]shp.Point, proj projection.Projection, densify float64) ([][]shp.Point, error) {
+
+	projected := make([][]shp.Point, len(parts))
+
+	for i, pts := range parts {
+
+		if densify > 0.0 {
+			pts = densifyPoints(pts, densify)
+		}
+
+		p, err := projectPoints(pts, proj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		projected[i] = p
+	}
+
+	return projected, nil
+}
+
+func projectPoints(pts []shp.Point, proj projection.Projection) ([]shp.Point, error) {
+
+	projected := make([]shp.Point, len(pts))
+
+	for i, pt := range pts {
+
+		p, err := projectPoint(pt, proj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		projected[i] = p
+	}
+
+	return projected, nil
+}
+
+func projectPoint(pt shp.Point, proj projection.Projection) (shp.Point, error) {
+
+	x, y, err := proj.Project(pt.X, pt.Y)
+
+	if err != nil {
+		return shp.Point{}, err
+	}
+
+	return shp.Point{X: x, Y: y}, nil
+}
+
+// densifyPoints returns a copy of pts where each segment longer than max is
+// split in to equal parts no longer than max. Both the length of a segment
+// and the new points are measured in (planar) decimal degrees rather than
+// along the great circle since GeoJSON edges are straight lines in longitude
+// and latitude and that is what the projected edges should follow.
+
+func densifyPoints(pts []shp.Point, max float64) []shp.Point {
+
+	if len(pts) < 2 {
+		return pts
+	}
+
+	densified := []shp.Point{pts[0]}
+
+	for i := 1; i < len(pts); i++ {
+
+		a := pts[i-1]
+		b := pts[i]
+
+		dx := b.X - a.X
+		dy := b.Y - a.Y
+
+		length := math.Sqrt(dx*dx + dy*dy)
+		steps := int(math.Ceil(length / max))
+
+		for j := 1; j < steps; j++ {
+
+			f := float64(j) / float64(steps)
+			densified = append(densified, shp.Point{X: a.X + dx*f, Y: a.Y + dy*f})
+		}
+
+		densified = append(densified, b)
+	}
+
+	return densified
+}
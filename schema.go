@@ -0,0 +1,474 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBF field types. See also: https://www.clicketyclick.dk/databases/xbase/format/data_types.html
+
+const (
+	FIELD_STRING  = 'C'
+	FIELD_NUMBER  = 'N'
+	FIELD_FLOAT   = 'F'
+	FIELD_DATE    = 'D'
+	FIELD_LOGICAL = 'L'
+	FIELD_MEMO    = 'M'
+)
+
+// The names of the built-in schemas. "default" is the schema returned by
+// NewDefaultSchema, "spr" is the schema returned by NewSPRSchema and "infer"
+// is a schema inferred from all of the features (see also NewInferredSchema).
+
+const (
+	SCHEMA_DEFAULT = "default"
+	SCHEMA_SPR     = "spr"
+	SCHEMA_INFER   = "infer"
+)
+
+func Schemas() []string {
+
+	return []string{
+		SCHEMA_DEFAULT,
+		SCHEMA_INFER,
+		SCHEMA_SPR,
+	}
+}
+
+func IsValidSchema(test string) bool {
+
+	valid := false
+
+	for _, name := range Schemas() {
+
+		if name == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// NewSchema returns the built-in schema called name.
+
+func NewSchema(name string) (Schema, error) {
+
+	switch name {
+	case SCHEMA_DEFAULT:
+		return NewDefaultSchema(), nil
+	case SCHEMA_SPR:
+		return NewSPRSchema(), nil
+	case SCHEMA_INFER:
+		return NewInferredSchema(0, 0.0)
+	default:
+		msg := fmt.Sprintf("Invalid schema '%s'", name)
+		return nil, errors.New(msg)
+	}
+}
+
+// SchemaField describes a single DBF field. Names are limited to 10 (ASCII)
+// characters. Property is the (WOF) property the field is derived from, for
+// example "wof:parent_id". If Name is empty a unique name is derived from
+// Property when the writer is created (see also DBFFieldName).
+
+type SchemaField struct {
+	Name      string
+	Property  string
+	Type      byte
+	Size      uint8
+	Precision uint8
+}
+
+// Schema defines the attributes written for each feature. Fields returns the
+// list of DBF fields and Row returns the values for those fields, in the same
+// order, for a feature. See SchemaField.DBFValue for the types of values that
+// can be written to each type of field. Values should fit in the size of
+// their field.
+
+type Schema interface {
+	Fields() []SchemaField
+	Row(geojson.Feature) ([]interface{}, error)
+}
+
+// ExpandableSchema is implemented by schemas whose columns depend on the
+// features being written, for example one column for each placetype found in
+// their hierarchies. If NeedsExpanding returns true then ExpandFromFeature
+// should be called for every feature before a writer is created since the
+// list of columns can't change once it has been written.
+
+type ExpandableSchema interface {
+	Schema
+	NeedsExpanding() bool
+	ExpandFromFeature(geojson.Feature)
+}
+
+// DefaultSchema is the schema used by NewDefaultWriterOptions: the ID (a
+// number), NAME, PLACETYPE, INCEPTION and CESSATION properties of a feature.
+// INCEPTION and CESSATION are DATE fields so EDTF values that can't be
+// resolved to a single day (see EDTFDate) like "uuuu", intervals or sets are
+// written as NULL.
+
+type DefaultSchema struct{}
+
+func NewDefaultSchema() Schema {
+	s := DefaultSchema{}
+	return &s
+}
+
+func (s *DefaultSchema) Fields() []SchemaField {
+
+	return []SchemaField{
+		SchemaField{Name: "ID", Property: "wof:id", Type: FIELD_NUMBER, Size: 19},
+		SchemaField{Name: "NAME", Property: "wof:name", Type: FIELD_STRING, Size: 64},
+		SchemaField{Name: "PLACETYPE", Property: "wof:placetype", Type: FIELD_STRING, Size: 64},
+		SchemaField{Name: "INCEPTION", Property: "edtf:inception", Type: FIELD_DATE},
+		SchemaField{Name: "CESSATION", Property: "edtf:cessation", Type: FIELD_DATE},
+	}
+}
+
+func (s *DefaultSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	row := []interface{}{
+		whosonfirst.Id(f),
+		f.Name(),
+		f.Placetype(),
+		edtfValue(whosonfirst.Inception(f)),
+		edtfValue(whosonfirst.Cessation(f)),
+	}
+
+	return row, nil
+}
+
+// MultiSchema writes the columns of several schemas, one after the other.
+
+type MultiSchema struct {
+	schemas []Schema
+}
+
+func NewMultiSchema(schemas ...Schema) Schema {
+
+	s := MultiSchema{
+		schemas: schemas,
+	}
+
+	return &s
+}
+
+func (s *MultiSchema) NeedsExpanding() bool {
+
+	for _, schema := range s.schemas {
+
+		e, ok := schema.(ExpandableSchema)
+
+		if ok && e.NeedsExpanding() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *MultiSchema) ExpandFromFeature(f geojson.Feature) {
+
+	for _, schema := range s.schemas {
+
+		e, ok := schema.(ExpandableSchema)
+
+		if ok && e.NeedsExpanding() {
+			e.ExpandFromFeature(f)
+		}
+	}
+}
+
+func (s *MultiSchema) Fields() []SchemaField {
+
+	fields := make([]SchemaField, 0)
+
+	for _, schema := range s.schemas {
+		fields = append(fields, schema.Fields()...)
+	}
+
+	return fields
+}
+
+func (s *MultiSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	row := make([]interface{}, 0)
+
+	for _, schema := range s.schemas {
+
+		schema_row, err := schema.Row(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(schema_row) != len(schema.Fields()) {
+			msg := fmt.Sprintf("Schema returned %d values but defines %d fields", len(schema_row), len(schema.Fields()))
+			return nil, errors.New(msg)
+		}
+
+		row = append(row, schema_row...)
+	}
+
+	return row, nil
+}
+
+// edtfValue returns the date for edtf_str or nil if it can't be resolved to
+// a single day.
+
+func edtfValue(edtf_str string) interface{} {
+
+	t, ok := EDTFDate(edtf_str)
+
+	if !ok {
+		return nil
+	}
+
+	return t
+}
+
+// floatProperty returns the numeric value of path in f or nil if it is
+// missing or isn't a number.
+
+func floatProperty(f geojson.Feature, path string) interface{} {
+
+	rsp := gjson.GetBytes(f.Bytes(), path)
+
+	if rsp.Type != gjson.Number {
+		return nil
+	}
+
+	return rsp.Float()
+}
+
+// DBFField returns the go-shp representation of field.
+
+func (field SchemaField) DBFField() (shp.Field, error) {
+
+	if field.Name == "" || len(field.Name) > 10 {
+		msg := fmt.Sprintf("Invalid field name '%s', names must be between 1 and 10 characters", field.Name)
+		return shp.Field{}, errors.New(msg)
+	}
+
+	for _, r := range field.Name {
+
+		if r > 127 {
+			msg := fmt.Sprintf("Invalid field name '%s', names must be ASCII", field.Name)
+			return shp.Field{}, errors.New(msg)
+		}
+	}
+
+	switch field.Type {
+	case FIELD_STRING:
+		return shp.StringField(field.Name, field.Size), nil
+	case FIELD_NUMBER:
+		return shp.NumberField(field.Name, field.Size), nil
+	case FIELD_FLOAT:
+		return shp.FloatField(field.Name, field.Size, field.Precision), nil
+	case FIELD_DATE:
+		return shp.DateField(field.Name), nil
+	case FIELD_LOGICAL:
+		// go-shp doesn't have a constructor for logical fields
+		dbf_field := shp.Field{Fieldtype: FIELD_LOGICAL, Size: 1}
+		copy(dbf_field.Name[:], []byte(field.Name))
+		return dbf_field, nil
+	case FIELD_MEMO:
+		// the number of a block in the .dbt file, see also: overflow.go
+		dbf_field := shp.Field{Fieldtype: FIELD_MEMO, Size: 10}
+		copy(dbf_field.Name[:], []byte(field.Name))
+		return dbf_field, nil
+	default:
+		msg := fmt.Sprintf("Invalid type '%c' for field %s", field.Type, field.Name)
+		return shp.Field{}, errors.New(msg)
+	}
+}
+
+// DBFValue converts value to the (formatted) value that go-shp writes for
+// field. Values may be:
+//
+//	FIELD_STRING   a string, an int, an int64 or a float64
+//	FIELD_NUMBER   an int, an int64 or a float64
+//	FIELD_FLOAT    an int, an int64 or a float64
+//	FIELD_DATE     a time.Time or a "YYYYMMDD" string
+//	FIELD_LOGICAL  a bool
+//
+// A nil value (or a NaN float) is written as an empty (null) value.
+
+func (field SchemaField) DBFValue(value interface{}) (interface{}, error) {
+
+	if value == nil {
+		return field.nullValue(), nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		value = int(v)
+	case float64:
+
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return field.nullValue(), nil
+		}
+	}
+
+	switch field.Type {
+
+	case FIELD_STRING:
+
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+
+	case FIELD_NUMBER, FIELD_FLOAT:
+
+		// numbers are right-justified, which go-shp doesn't do
+
+		var str_value string
+
+		switch v := value.(type) {
+		case int:
+
+			if field.Type == FIELD_FLOAT || field.Precision > 0 {
+				str_value = strconv.FormatFloat(float64(v), 'f', int(field.Precision), 64)
+			} else {
+				str_value = strconv.Itoa(v)
+			}
+
+		case float64:
+			str_value = strconv.FormatFloat(v, 'f', int(field.Precision), 64)
+		}
+
+		if len(str_value) > int(field.Size) {
+			msg := fmt.Sprintf("Value %s is too wide for field %s (%d)", str_value, field.Name, field.Size)
+			return nil, errors.New(msg)
+		}
+
+		if str_value != "" {
+			return fmt.Sprintf("%*s", int(field.Size), str_value), nil
+		}
+
+	case FIELD_DATE:
+
+		switch v := value.(type) {
+		case time.Time:
+
+			if v.Year() < 0 || v.Year() > 9999 {
+				msg := fmt.Sprintf("Date %s for field %s is out of range", v, field.Name)
+				return nil, errors.New(msg)
+			}
+
+			return v.Format("20060102"), nil
+
+		case string:
+
+			_, err := time.Parse("20060102", v)
+
+			if err != nil {
+				msg := fmt.Sprintf("Invalid date '%s' for field %s, dates must be YYYYMMDD", v, field.Name)
+				return nil, errors.New(msg)
+			}
+
+			return v, nil
+		}
+
+	case FIELD_LOGICAL:
+
+		switch v := value.(type) {
+		case bool:
+
+			if v {
+				return "T", nil
+			}
+
+			return "F", nil
+		}
+	}
+
+	msg := fmt.Sprintf("Unsupported value type %T for field %s ('%c')", value, field.Name, field.Type)
+	return nil, errors.New(msg)
+}
+
+// nullValue returns the value used to write an empty value for field. Logical
+// fields use "?" which is the dBase convention for an unknown value.
+
+func (field SchemaField) nullValue() string {
+
+	if field.Type == FIELD_LOGICAL {
+		return "?"
+	}
+
+	size := field.Size
+
+	if field.Type == FIELD_DATE {
+		size = 8
+	}
+
+	return strings.Repeat(" ", int(size))
+}
+
+// The most fields, and the longest record (in bytes, including the deletion
+// flag), that a DBF file can have. go-shp stores the record length as an
+// int16.
+
+const (
+	max_dbf_fields        = 255
+	max_dbf_record_length = 32767
+)
+
+// dbfFields returns the go-shp representation of fields, checking that field
+// names are valid and unique and that there aren't too many, or too wide,
+// fields for a DBF file.
+
+func dbfFields(schema_fields []SchemaField) ([]shp.Field, error) {
+
+	if len(schema_fields) > max_dbf_fields {
+		msg := fmt.Sprintf("Too many fields (%d), DBF files can have at most %d fields", len(schema_fields), max_dbf_fields)
+		return nil, errors.New(msg)
+	}
+
+	fields := make([]shp.Field, 0)
+	seen := make(map[string]bool)
+	record_length := 1
+
+	for _, field := range schema_fields {
+
+		dbf_field, err := field.DBFField()
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, ok := seen[field.Name]
+
+		if ok {
+			msg := fmt.Sprintf("Duplicate field name '%s'", field.Name)
+			return nil, errors.New(msg)
+		}
+
+		seen[field.Name] = true
+		fields = append(fields, dbf_field)
+
+		record_length += int(dbf_field.Size)
+	}
+
+	if record_length > max_dbf_record_length {
+		msg := fmt.Sprintf("Fields are too wide (%d bytes), DBF records can be at most %d bytes", record_length, max_dbf_record_length)
+		return nil, errors.New(msg)
+	}
+
+	return fields, nil
+}
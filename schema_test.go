@@ -0,0 +1,315 @@
+package shapefile
+
+import (
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDBFValue(t *testing.T) {
+
+	str := SchemaField{Name: "NAME", Type: FIELD_STRING, Size: 8}
+	num := SchemaField{Name: "ID", Type: FIELD_NUMBER, Size: 19}
+	small := SchemaField{Name: "SMALL", Type: FIELD_NUMBER, Size: 3}
+	num_precision := SchemaField{Name: "NUM", Type: FIELD_NUMBER, Size: 8, Precision: 2}
+	flt := SchemaField{Name: "AREA", Type: FIELD_FLOAT, Size: 10, Precision: 3}
+	date := SchemaField{Name: "DATE", Type: FIELD_DATE}
+	logical := SchemaField{Name: "FLAG", Type: FIELD_LOGICAL}
+
+	tests := []struct {
+		label    string
+		field    SchemaField
+		value    interface{}
+		expected interface{}
+	}{
+		{"string", str, "hello", "hello"},
+		{"string from int", str, 42, "42"},
+		{"string from int64", str, int64(42), "42"},
+		{"string from float", str, 1.5, "1.5"},
+		{"null string", str, nil, "        "},
+		{"number", num, 101736545, "          101736545"},
+		{"large number", num, int64(1108955671), "         1108955671"},
+		{"negative number", num, -1, "                 -1"},
+		{"number from float", num, 1.6, "                  2"},
+		{"number with precision", num_precision, 3, "    3.00"},
+		{"null number", num, nil, "                   "},
+		{"NaN number", num, math.NaN(), "                   "},
+		{"infinite number", num, math.Inf(1), "                   "},
+		{"float", flt, 0.0512345, "     0.051"},
+		{"float from int", flt, 7, "     7.000"},
+		{"null float", flt, nil, "          "},
+		{"date", date, time.Date(1642, 5, 17, 0, 0, 0, 0, time.UTC), "16420517"},
+		{"date string", date, "19840601", "19840601"},
+		{"null date", date, nil, "        "},
+		{"true", logical, true, "T"},
+		{"false", logical, false, "F"},
+		{"null logical", logical, nil, "?"},
+	}
+
+	for _, test := range tests {
+
+		v, err := test.field.DBFValue(test.value)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		if v != test.expected {
+			t.Errorf("%s: expected '%v' but got '%v'", test.label, test.expected, v)
+		}
+	}
+
+	invalid := []struct {
+		label string
+		field SchemaField
+		value interface{}
+	}{
+		{"too wide", small, 1234},
+		{"float too wide", flt, 12345678.9},
+		{"string in number", num, "42"},
+		{"bool in string", str, true},
+		{"int in logical", logical, 1},
+		{"invalid date string", date, "1984-06-01"},
+		{"invalid day", date, "19840231"},
+		{"date out of range", date, time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"int in date", date, 19840601},
+	}
+
+	for _, test := range invalid {
+
+		_, err := test.field.DBFValue(test.value)
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.label)
+		}
+	}
+}
+
+func TestDBFField(t *testing.T) {
+
+	tests := []struct {
+		field     SchemaField
+		fieldtype byte
+		size      uint8
+		precision uint8
+	}{
+		{SchemaField{Name: "NAME", Type: FIELD_STRING, Size: 64}, 'C', 64, 0},
+		{SchemaField{Name: "ID", Type: FIELD_NUMBER, Size: 19}, 'N', 19, 0},
+		{SchemaField{Name: "AREA", Type: FIELD_FLOAT, Size: 19, Precision: 10}, 'F', 19, 10},
+		{SchemaField{Name: "INCEPTION", Type: FIELD_DATE}, 'D', 8, 0},
+		{SchemaField{Name: "CURRENT", Type: FIELD_LOGICAL}, 'L', 1, 0},
+		{SchemaField{Name: "OVERFLOW", Type: FIELD_MEMO}, 'M', 10, 0},
+	}
+
+	for _, test := range tests {
+
+		f, err := test.field.DBFField()
+
+		if err != nil {
+			t.Errorf("%s: %s", test.field.Name, err)
+			continue
+		}
+
+		if f.String() != test.field.Name || f.Fieldtype != test.fieldtype || f.Size != test.size || f.Precision != test.precision {
+			t.Errorf("%s: unexpected field %v", test.field.Name, f)
+		}
+	}
+
+	invalid := []SchemaField{
+		SchemaField{Name: "", Type: FIELD_STRING, Size: 1},
+		SchemaField{Name: "ELEVENCHARS", Type: FIELD_STRING, Size: 1},
+		SchemaField{Name: "NÄME", Type: FIELD_STRING, Size: 1},
+		SchemaField{Name: "BLOB", Type: 'B', Size: 1},
+	}
+
+	for _, field := range invalid {
+
+		_, err := field.DBFField()
+
+		if err == nil {
+			t.Errorf("%s: expected an error", field.Name)
+		}
+	}
+
+	_, err := dbfFields([]SchemaField{
+		SchemaField{Name: "ID", Type: FIELD_NUMBER, Size: 19},
+		SchemaField{Name: "ID", Type: FIELD_STRING, Size: 19},
+	})
+
+	if err == nil {
+		t.Error("expected duplicate field names to be rejected")
+	}
+}
+
+func TestDefaultSchemaRow(t *testing.T) {
+
+	body := `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montréal","wof:placetype":"locality","wof:repo":"whosonfirst-data","wof:parent_id":-1,"wof:hierarchy":[],"geom:latitude":45.5,"geom:longitude":-73.6,"geom:bbox":"-73.6,45.5,-73.6,45.5","edtf:inception":"1642-05-17~","edtf:cessation":"uuuu","geom:area":0.0512345},"geometry":{"type":"Point","coordinates":[-73.6,45.5]}}`
+
+	f, err := feature.NewWOFFeature([]byte(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := NewDefaultSchema()
+	fields := schema.Fields()
+
+	row, err := schema.Row(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(row) != len(fields) {
+		t.Fatalf("expected %d values but got %d", len(fields), len(row))
+	}
+
+	expected := []string{
+		"          101736545",
+		"Montréal",
+		"locality",
+		"16420517",
+		"        ",
+	}
+
+	for i, field := range fields {
+
+		v, err := field.DBFValue(row[i])
+
+		if err != nil {
+			t.Errorf("%s: %s", field.Name, err)
+			continue
+		}
+
+		if v != expected[i] {
+			t.Errorf("%s: expected '%s' but got '%v'", field.Name, expected[i], v)
+		}
+	}
+}
+
+func TestMultiSchema(t *testing.T) {
+
+	body := `{"type":"Feature","properties":{"wof:id":1,"wof:name":"Null Island","wof:placetype":"locality","wof:repo":"whosonfirst-data","wof:parent_id":-1,"wof:hierarchy":[],"geom:latitude":0,"geom:longitude":0,"geom:bbox":"0,0,0,0","wof:concordances":{"wd:id":"Q340"}},"geometry":{"type":"Point","coordinates":[0,0]}}`
+
+	f, err := feature.NewWOFFeature([]byte(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := NewMultiSchema(NewDefaultSchema(), NewConcordancesSchema([]string{"wd:id"}))
+
+	fields := schema.Fields()
+	row, err := schema.Row(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := len(NewDefaultSchema().Fields()) + 1
+
+	if len(fields) != count || len(row) != count {
+		t.Fatalf("expected %d fields and values but got %d and %d", count, len(fields), len(row))
+	}
+
+	if row[count-1] != "Q340" {
+		t.Errorf("expected the last value to be Q340 but got %v", row[count-1])
+	}
+}
+
+func TestNewSchema(t *testing.T) {
+
+	for _, name := range Schemas() {
+
+		_, err := NewSchema(name)
+
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	_, err := NewSchema("bogus")
+
+	if err == nil {
+		t.Error("expected an invalid schema name to be rejected")
+	}
+}
+
+func TestDBFFieldsLimits(t *testing.T) {
+
+	wide := make([]SchemaField, 140)
+
+	for i := range wide {
+		wide[i] = SchemaField{Name: fmt.Sprintf("F%d", i), Type: FIELD_STRING, Size: 254}
+	}
+
+	many := make([]SchemaField, 256)
+
+	for i := range many {
+		many[i] = SchemaField{Name: fmt.Sprintf("F%d", i), Type: FIELD_LOGICAL}
+	}
+
+	tests := []struct {
+		label  string
+		fields []SchemaField
+		ok     bool
+	}{
+		{"widest", wide[0:129], true},
+		{"too wide", wide, false},
+		{"most fields", many[0:255], true},
+		{"too many fields", many, false},
+	}
+
+	for _, test := range tests {
+
+		_, err := dbfFields(test.fields)
+
+		if test.ok && err != nil {
+			t.Errorf("%s: %s", test.label, err)
+		}
+
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.label)
+		}
+	}
+
+	// the writer checks the final list of fields
+
+	root, err := ioutil.TempDir("", "limits")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	sf := &SchemaFile{
+		Fields: make([]SchemaFileField, len(wide)),
+	}
+
+	for i, field := range wide {
+		sf.Fields[i] = SchemaFileField{Path: "properties." + field.Name, Name: field.Name, Type: "string", Size: field.Size}
+	}
+
+	schema, err := NewFileSchemaFromSchemaFile(sf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewDefaultWriterOptions()
+	opts.Schema = schema
+
+	_, err = NewWriterWithOptions(filepath.Join(root, "limits.shp"), shp.POLYGON, opts)
+
+	if err == nil {
+		t.Error("expected a writer with records that are too wide to fail")
+	}
+}
@@ -0,0 +1,483 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transforms that can be applied to the value of a FileSchema field before it
+// is written. "first" uses the first element of a list, "join" joins the
+// elements of a list using the field's separator (or ",") and "date" resolves
+// an EDTF string, an RFC 3339 timestamp or a Unix timestamp to a date.
+
+const (
+	TRANSFORM_FIRST = "first"
+	TRANSFORM_JOIN  = "join"
+	TRANSFORM_DATE  = "date"
+)
+
+func Transforms() []string {
+
+	return []string{
+		TRANSFORM_DATE,
+		TRANSFORM_FIRST,
+		TRANSFORM_JOIN,
+	}
+}
+
+func IsValidTransform(test string) bool {
+
+	valid := false
+
+	for _, transform := range Transforms() {
+
+		if transform == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// The names of the field types in a schema file, which may also be given as
+// DBF type codes ("C", "N", "F", "D" or "L").
+
+var schema_file_types = map[string]byte{
+	"string":  FIELD_STRING,
+	"number":  FIELD_NUMBER,
+	"float":   FIELD_FLOAT,
+	"date":    FIELD_DATE,
+	"logical": FIELD_LOGICAL,
+}
+
+// SchemaFileField is a single field in a schema file. Path is a gjson path in
+// to the feature, for example "properties.wof:parent_id". If Name is empty it
+// is derived from Path (see also DBFFieldName). Type is one of "string" (the
+// default), "number", "float", "date" or "logical" and if Size is 0 a default
+// size for the type is used. Default is written when Path doesn't exist or
+// its (transformed) value is null or empty. Transform is one of the TRANSFORM_
+// constants and Separator is the separator used by the "join" transform.
+
+type SchemaFileField struct {
+	Path      string      `json:"path" yaml:"path"`
+	Name      string      `json:"name,omitempty" yaml:"name,omitempty"`
+	Type      string      `json:"type,omitempty" yaml:"type,omitempty"`
+	Size      uint8       `json:"size,omitempty" yaml:"size,omitempty"`
+	Precision uint8       `json:"precision,omitempty" yaml:"precision,omitempty"`
+	Default   interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	Transform string      `json:"transform,omitempty" yaml:"transform,omitempty"`
+	Separator string      `json:"separator,omitempty" yaml:"separator,omitempty"`
+}
+
+type SchemaFile struct {
+	Fields []SchemaFileField `json:"fields" yaml:"fields"`
+}
+
+// FileSchema is a Schema defined by a (JSON or YAML) schema file, for example:
+//
+//	{
+//		"fields": [
+//			{ "path": "properties.wof:id", "name": "ID", "type": "number" },
+//			{ "path": "properties.wof:name", "name": "NAME", "size": 128 },
+//			{ "path": "properties.edtf:inception", "name": "INCEPTION", "type": "date" },
+//			{ "path": "properties.wof:lang_x_spoken", "name": "LANGS", "transform": "join", "default": "unknown" }
+//		]
+//	}
+
+type FileSchema struct {
+	fields   []SchemaFileField
+	types    []byte
+	defaults []interface{}
+}
+
+// NewFileSchema reads a schema file from path. Files whose extension is ".yaml"
+// or ".yml" are parsed as YAML, all others as JSON. Either way keys that aren't
+// part of the schema file format, like a misspelled "tranform", are an error.
+
+func NewFileSchema(path string) (Schema, error) {
+
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sf SchemaFile
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(body, &sf)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&sf)
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Failed to parse schema file %s because %s", path, err)
+		return nil, errors.New(msg)
+	}
+
+	return NewFileSchemaFromSchemaFile(&sf)
+}
+
+// WriteSchemaFile writes sf to path. Files whose extension is ".yaml" or ".yml"
+// are written as YAML, all others as JSON.
+
+func WriteSchemaFile(path string, sf *SchemaFile) error {
+
+	var body []byte
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		body, err = yaml.Marshal(sf)
+	default:
+		body, err = json.MarshalIndent(sf, "", "  ")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, body, 0644)
+}
+
+func NewFileSchemaFromSchemaFile(sf *SchemaFile) (Schema, error) {
+
+	if len(sf.Fields) == 0 {
+		return nil, errors.New("Schema file doesn't define any fields")
+	}
+
+	s := FileSchema{
+		fields:   make([]SchemaFileField, len(sf.Fields)),
+		types:    make([]byte, len(sf.Fields)),
+		defaults: make([]interface{}, len(sf.Fields)),
+	}
+
+	for i, field := range sf.Fields {
+
+		if field.Path == "" {
+			msg := fmt.Sprintf("Field %d is missing a path", i)
+			return nil, errors.New(msg)
+		}
+
+		field_type, err := schemaFileType(field.Type)
+
+		if err != nil {
+			msg := fmt.Sprintf("Invalid type for %s, %s", field.Path, err)
+			return nil, errors.New(msg)
+		}
+
+		if field.Transform != "" && !IsValidTransform(field.Transform) {
+			msg := fmt.Sprintf("Invalid transform '%s' for %s", field.Transform, field.Path)
+			return nil, errors.New(msg)
+		}
+
+		if field.Size == 0 {
+
+			switch field_type {
+			case FIELD_STRING:
+				field.Size = 254
+			case FIELD_NUMBER:
+				field.Size = 19
+			case FIELD_FLOAT:
+				field.Size = 19
+				field.Precision = 8
+			}
+		}
+
+		s.fields[i] = field
+		s.types[i] = field_type
+
+		if field.Default == nil {
+			continue
+		}
+
+		// defaults are converted the same way as the values in a
+		// feature so that, for example, a date can be "1970-01-01"
+
+		enc_default, err := json.Marshal(field.Default)
+
+		if err != nil {
+			msg := fmt.Sprintf("Invalid default for %s, %s", field.Path, err)
+			return nil, errors.New(msg)
+		}
+
+		s.defaults[i] = s.value(i, gjson.ParseBytes(enc_default))
+
+		if s.defaults[i] == nil {
+			msg := fmt.Sprintf("Invalid default for %s, %s can not be converted to a %s", field.Path, enc_default, field.Type)
+			return nil, errors.New(msg)
+		}
+	}
+
+	return &s, nil
+}
+
+func schemaFileType(str_type string) (byte, error) {
+
+	if str_type == "" {
+		return FIELD_STRING, nil
+	}
+
+	field_type, ok := schema_file_types[strings.ToLower(str_type)]
+
+	if ok {
+		return field_type, nil
+	}
+
+	for _, t := range schema_file_types {
+
+		if str_type == string(t) {
+			return t, nil
+		}
+	}
+
+	msg := fmt.Sprintf("unknown type '%s'", str_type)
+	return 0, errors.New(msg)
+}
+
+func (s *FileSchema) Fields() []SchemaField {
+
+	fields := make([]SchemaField, len(s.fields))
+
+	for i, field := range s.fields {
+
+		fields[i] = SchemaField{
+			Name:      field.Name,
+			Property:  strings.TrimPrefix(field.Path, "properties."),
+			Type:      s.types[i],
+			Size:      field.Size,
+			Precision: field.Precision,
+		}
+	}
+
+	return fields
+}
+
+func (s *FileSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	body := f.Bytes()
+	row := make([]interface{}, len(s.fields))
+
+	for i, field := range s.fields {
+
+		row[i] = s.value(i, gjson.GetBytes(body, field.Path))
+
+		if row[i] == nil {
+			row[i] = s.defaults[i]
+		}
+	}
+
+	return row, nil
+}
+
+// value returns rsp, transformed and converted to the type of field i, or nil
+// if it doesn't exist or can not be converted.
+
+func (s *FileSchema) value(i int, rsp gjson.Result) interface{} {
+
+	field := s.fields[i]
+
+	if !rsp.Exists() || rsp.Type == gjson.Null {
+		return nil
+	}
+
+	switch field.Transform {
+
+	case TRANSFORM_FIRST:
+
+		if rsp.IsArray() {
+
+			values := rsp.Array()
+
+			if len(values) == 0 {
+				return nil
+			}
+
+			rsp = values[0]
+		}
+
+	case TRANSFORM_JOIN:
+
+		if rsp.IsArray() {
+
+			sep := field.Separator
+
+			if sep == "" {
+				sep = ","
+			}
+
+			values := make([]string, 0)
+
+			for _, v := range rsp.Array() {
+				values = append(values, v.String())
+			}
+
+			if len(values) == 0 {
+				return nil
+			}
+
+			return convertString(strings.Join(values, sep), s.types[i])
+		}
+
+	case TRANSFORM_DATE:
+
+		t, ok := resultDate(rsp)
+
+		if !ok {
+			return nil
+		}
+
+		if s.types[i] == FIELD_DATE {
+			return t
+		}
+
+		return convertString(t.Format("2006-01-02"), s.types[i])
+	}
+
+	switch s.types[i] {
+
+	case FIELD_DATE:
+
+		t, ok := resultDate(rsp)
+
+		if !ok {
+			return nil
+		}
+
+		return t
+
+	case FIELD_LOGICAL:
+
+		switch rsp.Type {
+		case gjson.True:
+			return true
+		case gjson.False:
+			return false
+		case gjson.Number:
+			// existential flags are 1, 0 or -1 (unknown)
+			return flagValue(rsp.Int())
+		}
+
+	case FIELD_NUMBER, FIELD_FLOAT:
+
+		if rsp.Type != gjson.Number {
+			break
+		}
+
+		// don't lose the precision of large integers, like IDs
+
+		if s.types[i] == FIELD_NUMBER && field.Precision == 0 {
+			return rsp.Int()
+		}
+
+		return rsp.Float()
+	}
+
+	if rsp.Type == gjson.JSON && s.types[i] != FIELD_STRING {
+		return nil
+	}
+
+	return convertString(rsp.String(), s.types[i])
+}
+
+// convertString converts str_value to the type of a field, returning nil if
+// it is empty or can not be converted.
+
+func convertString(str_value string, field_type byte) interface{} {
+
+	if str_value == "" {
+		return nil
+	}
+
+	switch field_type {
+
+	case FIELD_NUMBER, FIELD_FLOAT:
+
+		v, err := strconv.ParseFloat(str_value, 64)
+
+		if err != nil {
+			return nil
+		}
+
+		return v
+
+	case FIELD_LOGICAL:
+
+		switch strings.ToLower(str_value) {
+		case "true", "t", "yes", "y", "1":
+			return true
+		case "false", "f", "no", "n", "0":
+			return false
+		default:
+			return nil
+		}
+
+	case FIELD_DATE:
+
+		t, ok := stringDate(str_value)
+
+		if !ok {
+			return nil
+		}
+
+		return t
+
+	default:
+		return str_value
+	}
+}
+
+// resultDate resolves rsp to a date. Numbers are treated as Unix timestamps
+// and strings are resolved using stringDate.
+
+func resultDate(rsp gjson.Result) (time.Time, bool) {
+
+	switch rsp.Type {
+	case gjson.Number:
+		return time.Unix(rsp.Int(), 0).UTC(), true
+	case gjson.String:
+		return stringDate(rsp.String())
+	default:
+		return time.Time{}, false
+	}
+}
+
+// stringDate resolves str_date, an EDTF string (see also EDTFDate), an RFC
+// 3339 timestamp or a "YYYYMMDD" string, to a date.
+
+func stringDate(str_date string) (time.Time, bool) {
+
+	t, ok := EDTFDate(str_date)
+
+	if ok {
+		return t, true
+	}
+
+	t, err := time.Parse(time.RFC3339, str_date)
+
+	if err == nil {
+		return t.UTC(), true
+	}
+
+	t, err = time.Parse("20060102", str_date)
+
+	if err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
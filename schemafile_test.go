@@ -0,0 +1,64 @@
+package shapefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFileSchema(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "shapefile")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		filename string
+		body     string
+		valid    bool
+	}{
+		{"valid.json", `{"fields":[{"path":"properties.wof:id","name":"ID","type":"number"},{"path":"properties.wof:name","size":128}]}`, true},
+		{"valid.yaml", "fields:\n  - path: properties.wof:id\n    name: ID\n    type: number\n  - path: properties.wof:name\n    size: 128\n", true},
+		{"unknown.json", `{"fields":[{"path":"properties.wof:lang_x_spoken","tranform":"join"}]}`, false},
+		{"unknown.yaml", "fields:\n  - path: properties.wof:lang_x_spoken\n    tranform: join\n", false},
+		{"toplevel.json", `{"fields":[{"path":"properties.wof:id"}],"feilds":[]}`, false},
+		{"empty.json", `{"fields":[]}`, false},
+		{"type.json", `{"fields":[{"path":"properties.wof:id","type":"integer"}]}`, false},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(root, test.filename)
+
+		err := ioutil.WriteFile(path, []byte(test.body), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := NewFileSchema(path)
+
+		if test.valid && err != nil {
+			t.Errorf("%s: %s", test.filename, err)
+			continue
+		}
+
+		if !test.valid {
+
+			if err == nil {
+				t.Errorf("%s: expected an error", test.filename)
+			}
+
+			continue
+		}
+
+		if len(s.Fields()) != 2 {
+			t.Errorf("%s: expected 2 fields but got %d", test.filename, len(s.Fields()))
+		}
+	}
+}
@@ -4,30 +4,190 @@ package shapefile
 
 import (
 	"errors"
+	"fmt"
 	"github.com/jonas-p/go-shp"
 	"github.com/tidwall/gjson"
 	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
-	"github.com/whosonfirst/go-whosonfirst-geojson-v2/properties/whosonfirst"
 	"github.com/whosonfirst/go-whosonfirst-log"
+	"github.com/whosonfirst/go-whosonfirst-shapefile/projection"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 type Writer struct {
-	shapewriter *shp.Writer
-	shapetype   shp.ShapeType // https://godoc.org/github.com/jonas-p/go-shp#ShapeType
-	path        string
-	Logger      *log.WOFLogger
+	shapewriter    *shp.Writer
+	shapetype      shp.ShapeType // https://godoc.org/github.com/jonas-p/go-shp#ShapeType
+	path           string
+	Logger         *log.WOFLogger
+	ShapeOptions   *ShapeOptions
+	options        *WriterOptions
+	count          int64
+	skipped        int64
+	auto           bool
+	writers        map[string]*Writer
+	nulls          []int32
+	null_idx       int
+	source_idx     int
+	clipped_idx    int
+	repairs_idx    int
+	truncated_idx  int
+	computed_idx   int
+	overflow_idx   int
+	overflow       *overflowTable
+	pending        []overflowValue
+	fields         []SchemaField
+	encoding       dbfEncoding
+	bbox           shp.Box
+	z_range        [2]float64
+	m_range        [2]float64
+	has_z          bool
+	has_m          bool
+	vertices_in    int64
+	vertices_out   int64
+	transliterated int64
+	replaced       int64
+	truncated      int64
+}
+
+// WriterOptions define how features are converted and written. Schema defines
+// the attributes written for each feature (see also NewDefaultSchema). If
+// NullShapes is true then features whose geometry can not be converted to the
+// writer's shape type are written as Null shapes, with their full set of
+// attributes and the reason their geometry was rejected, rather than being
+// skipped. FieldNames overrides the DBF names of schema fields, keyed by
+// property (see also SchemaField.Property) and FieldMap is the format of the
+// sidecar file describing each field (see also WriteFieldMap). Encoding is
+// the character encoding of text attributes (see also Encodings). Overflow
+// is the format of the table that text values which are too wide for their
+// field are written to in full (see also OverflowFormats). Computed is the
+// list of attributes computed from the shape written for each feature (see
+// also ComputedAttributes). If RecordRepairs is true a REPAIRS field listing
+// the repairs made to each feature's geometry (see ShapeOptions.Validation)
+// is added.
+
+type WriterOptions struct {
+	ShapeOptions  *ShapeOptions
+	Schema        Schema
+	NullShapes    bool
+	FieldNames    map[string]string
+	FieldMap      string
+	Encoding      string
+	Overflow      string
+	Computed      []string
+	RecordRepairs bool
+}
+
+func NewDefaultWriterOptions() *WriterOptions {
+
+	opts := WriterOptions{
+		ShapeOptions:  NewDefaultShapeOptions(),
+		Schema:        NewDefaultSchema(),
+		NullShapes:    false,
+		FieldNames:    make(map[string]string),
+		FieldMap:      FIELD_MAP_CSV,
+		Encoding:      ENCODING_UTF8,
+		Overflow:      OVERFLOW_NONE,
+		Computed:      make([]string, 0),
+		RecordRepairs: false,
+	}
+
+	return &opts
+}
+
+// The strategies used to derive the points in a MULTIPOINT record. "vertices"
+// returns every vertex in the geometry (omitting the closing vertex of polygon
+// rings) and "distinct" returns each unique coordinate once, in the order it
+// was first encountered.
+
+const (
+	MULTIPOINT_VERTICES = "vertices"
+	MULTIPOINT_DISTINCT = "distinct"
+)
+
+// ShapeOptions define how features are converted to shapes. ZProperty and
+// MProperty are the names of the (WOF) properties used to assign Z and M
+// values to the Z and M shape types. If ZProperty is empty the third
+// coordinate of each position is used instead. Since the shapefile spec has
+// no "no data" value for Z, points whose elevation is not known are assigned
+// ZUnknown (0.0 by default). If MProperty is empty (or missing from a feature)
+// M values are recorded as "no data" (see M_NODATA). PointSources
+// is the ordered list of sources used to derive POINT shapes. See
+// PointForFeature for details. POLYLINE and POLYGON shapes with edges that
+// cross the antimeridian are handled using the Antimeridian strategy (see
+// AntimeridianShape) which defaults to "none" so that shapes are written as-is
+// unless a caller asks for them to be split or normalized. If Clip is not nil
+// shapes are cut at the edge of the clip region (see ClipRegion.ClipShape). If
+// Projection is not nil shapes are reprojected, densifying edges longer than
+// Densify decimal degrees (see ProjectShape). If SimplifyTolerance is greater
+// than zero POLYLINE and POLYGON shapes are simplified using SimplifyAlgorithm
+// (see SimplifyShape) after they have been reprojected. Finally shapes are
+// checked, and possibly repaired, according to the Validation policy (see
+// ValidateShape) which defaults to "none" so that geometries are only
+// modified if a caller asks for them to be repaired.
+
+type ShapeOptions struct {
+	MultiPointStrategy string
+	ZProperty          string
+	ZUnknown           float64
+	MProperty          string
+	PointSources       []string
+	SimplifyTolerance  float64
+	SimplifyAlgorithm  string
+	Projection         projection.Projection
+	Densify            float64
+	Clip               *ClipRegion
+	Antimeridian       string
+	Validation         string
+}
+
+func NewDefaultShapeOptions() *ShapeOptions {
+
+	opts := ShapeOptions{
+		MultiPointStrategy: MULTIPOINT_VERTICES,
+		PointSources:       DefaultPointSources(),
+		SimplifyTolerance:  0.0,
+		SimplifyAlgorithm:  SIMPLIFY_DOUGLAS_PEUCKER,
+		Projection:         nil,
+		Densify:            DEFAULT_DENSIFY,
+		Clip:               nil,
+		Antimeridian:       ANTIMERIDIAN_NONE,
+		Validation:         VALIDATION_NONE,
+	}
+
+	return &opts
+}
+
+// ShapeReport records details about how a feature was converted to a shape.
+// PointSource is the source that was used to derive POINT shapes. VerticesIn
+// and VerticesOut are the number of vertices in the shape before and after
+// simplification. Clipped is true if the shape was cut by a clip region.
+// Repairs is the list of repairs made to the shape when it was validated.
+
+type ShapeReport struct {
+	PointSource string
+	VerticesIn  int
+	VerticesOut int
+	Clipped     bool
+	Repairs     []string
 }
 
 func ShapeTypes() []string {
 
 	return []string{
+		"AUTO",
 		"MULTIPOINT",
+		"MULTIPOINTM",
+		"MULTIPOINTZ",
 		"POINT",
+		"POINTM",
+		"POINTZ",
 		"POLYGON",
+		"POLYGONM",
+		"POLYGONZ",
 		"POLYLINE",
+		"POLYLINEM",
+		"POLYLINEZ",
 	}
 }
 
@@ -46,26 +206,75 @@ func IsValidShapeType(test string) bool {
 	return valid
 }
 
+func MultiPointStrategies() []string {
+
+	return []string{
+		MULTIPOINT_DISTINCT,
+		MULTIPOINT_VERTICES,
+	}
+}
+
+func IsValidMultiPointStrategy(test string) bool {
+
+	valid := false
+
+	for _, strategy := range MultiPointStrategies() {
+
+		if strategy == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
 func NewWriterFromString(path string, shapetype string) (*Writer, error) {
+	return NewWriterFromStringWithOptions(path, shapetype, NewDefaultWriterOptions())
+}
+
+func NewWriterFromStringWithOptions(path string, shapetype string, opts *WriterOptions) (*Writer, error) {
 
 	// https://godoc.org/github.com/jonas-p/go-shp#ShapeType
 
 	switch strings.ToUpper(shapetype) {
 
+	case "AUTO":
+		return NewAutoWriterWithOptions(path, opts)
 	case "MULTIPOINT":
-		return NewWriter(path, shp.MULTIPOINT)
+		return NewWriterWithOptions(path, shp.MULTIPOINT, opts)
 	case "POLYLINE":
-		return NewWriter(path, shp.POLYLINE)
+		return NewWriterWithOptions(path, shp.POLYLINE, opts)
 	case "POINT":
-		return NewWriter(path, shp.POINT)
+		return NewWriterWithOptions(path, shp.POINT, opts)
 	case "POLYGON":
-		return NewWriter(path, shp.POLYGON)
+		return NewWriterWithOptions(path, shp.POLYGON, opts)
+	case "MULTIPOINTZ":
+		return NewWriterWithOptions(path, shp.MULTIPOINTZ, opts)
+	case "POLYLINEZ":
+		return NewWriterWithOptions(path, shp.POLYLINEZ, opts)
+	case "POINTZ":
+		return NewWriterWithOptions(path, shp.POINTZ, opts)
+	case "POLYGONZ":
+		return NewWriterWithOptions(path, shp.POLYGONZ, opts)
+	case "MULTIPOINTM":
+		return NewWriterWithOptions(path, shp.MULTIPOINTM, opts)
+	case "POLYLINEM":
+		return NewWriterWithOptions(path, shp.POLYLINEM, opts)
+	case "POINTM":
+		return NewWriterWithOptions(path, shp.POINTM, opts)
+	case "POLYGONM":
+		return NewWriterWithOptions(path, shp.POLYGONM, opts)
 	default:
 		return nil, errors.New("Unsupported shape type")
 	}
 }
 
 func NewWriter(path string, shapetype shp.ShapeType) (*Writer, error) {
+	return NewWriterWithOptions(path, shapetype, NewDefaultWriterOptions())
+}
+
+func NewWriterWithOptions(path string, shapetype shp.ShapeType, opts *WriterOptions) (*Writer, error) {
 
 	abs_path, err := filepath.Abs(path)
 
@@ -73,65 +282,259 @@ func NewWriter(path string, shapetype shp.ShapeType) (*Writer, error) {
 		return nil, err
 	}
 
-	shapewriter, err := shp.Create(abs_path, shapetype)
+	// the columns defined by the schema are followed by any columns that
+	// record how the shape was derived
+
+	schema_fields := opts.Schema.Fields()
+
+	computed_idx := -1
+
+	if len(opts.Computed) > 0 {
+
+		for _, attr := range opts.Computed {
+
+			if !IsValidComputedAttribute(attr) {
+				msg := fmt.Sprintf("Invalid computed attribute '%s'", attr)
+				return nil, errors.New(msg)
+			}
+		}
+
+		computed_idx = len(schema_fields)
+		schema_fields = append(schema_fields, computedFields(opts.Computed)...)
+	}
+
+	source_idx := -1
+
+	if baseShapeType(shapetype) == shp.POINT {
+		schema_fields = append(schema_fields, SchemaField{Name: POINT_SOURCE_FIELD, Type: FIELD_STRING, Size: 32})
+		source_idx = len(schema_fields) - 1
+	}
+
+	clipped_idx := -1
+
+	if opts.ShapeOptions.Clip != nil {
+		schema_fields = append(schema_fields, SchemaField{Name: CLIPPED_FIELD, Type: FIELD_NUMBER, Size: 1})
+		clipped_idx = len(schema_fields) - 1
+	}
+
+	repairs_idx := -1
+
+	if opts.RecordRepairs {
+		schema_fields = append(schema_fields, SchemaField{Name: REPAIRS_FIELD, Type: FIELD_STRING, Size: 64})
+		repairs_idx = len(schema_fields) - 1
+	}
+
+	null_idx := -1
+
+	if opts.NullShapes {
+		schema_fields = append(schema_fields, SchemaField{Name: NULL_REASON_FIELD, Type: FIELD_STRING, Size: 254})
+		null_idx = len(schema_fields) - 1
+	}
+
+	if !IsValidOverflowFormat(opts.Overflow) {
+		return nil, errors.New("Invalid overflow format")
+	}
+
+	truncated_idx := -1
+	overflow_idx := -1
+
+	if opts.Overflow != OVERFLOW_NONE {
+		schema_fields = append(schema_fields, SchemaField{Name: TRUNCATED_FIELD, Type: FIELD_STRING, Size: 254})
+		truncated_idx = len(schema_fields) - 1
+	}
+
+	if opts.Overflow == OVERFLOW_DBT {
+		schema_fields = append(schema_fields, SchemaField{Name: OVERFLOW_FIELD, Type: FIELD_MEMO, Size: 10})
+		overflow_idx = len(schema_fields) - 1
+	}
+
+	if !IsValidFieldMapFormat(opts.FieldMap) {
+		return nil, errors.New("Invalid field map format")
+	}
+
+	encoding, ok := dbf_encodings[opts.Encoding]
+
+	if !ok {
+		return nil, errors.New("Invalid encoding")
+	}
+
+	schema_fields, err = mapFieldNames(schema_fields, opts.FieldNames)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// something something something SPR...
-	// https://github.com/whosonfirst/go-whosonfirst-spr
+	fields, err := dbfFields(schema_fields)
 
-	// there is also a whole stack of pre-existing logic here that I
-	// am not keen to formalize but that should be possible to support:
-	// https://github.com/whosonfirst/py-mapzen-whosonfirst-utils/blob/master/scripts/wof-csv-to-feature-collection
+	if err != nil {
+		return nil, err
+	}
 
-	// so maybe some sort of generic AttributesFunction for which we
-	// can define a sensible default (SPR, etc) but that people can
-	// override to suit their needs... or something like that
-	// (20180815/thisisaaronland)
+	shapewriter, err := shp.Create(abs_path, shapetype)
 
-	fields := []shp.Field{
-		shp.StringField("ID", 64),
-		shp.StringField("NAME", 64),
-		shp.StringField("PLACETYPE", 64),
-		shp.StringField("INCEPTION", 64),
-		shp.StringField("CESSATION", 64),
+	if err != nil {
+		return nil, err
 	}
 
 	shapewriter.SetFields(fields)
 
+	var overflow *overflowTable
+
+	if opts.Overflow != OVERFLOW_NONE {
+
+		overflow, err = newOverflowTable(abs_path, opts.Overflow)
+
+		if err != nil {
+			shapewriter.Close()
+			return nil, err
+		}
+	}
+
 	logger := log.SimpleWOFLogger()
 
 	wr := Writer{
-		shapewriter: shapewriter,
-		shapetype:   shapetype,
-		Logger:      logger,
-		path:        abs_path,
+		shapewriter:   shapewriter,
+		shapetype:     shapetype,
+		Logger:        logger,
+		ShapeOptions:  opts.ShapeOptions,
+		options:       opts,
+		path:          abs_path,
+		nulls:         make([]int32, 0),
+		null_idx:      null_idx,
+		source_idx:    source_idx,
+		clipped_idx:   clipped_idx,
+		repairs_idx:   repairs_idx,
+		truncated_idx: truncated_idx,
+		computed_idx:  computed_idx,
+		overflow_idx:  overflow_idx,
+		overflow:      overflow,
+		pending:       make([]overflowValue, 0),
+		fields:        schema_fields,
+		encoding:      encoding,
 	}
 
 	return &wr, nil
 }
 
 func (wr *Writer) Close() error {
+
+	if wr.auto {
+		return wr.closeWriters()
+	}
+
 	wr.shapewriter.Close()
-	return wr.WriteProjFile()
+
+	err := wr.patchNullShapes()
+
+	if err != nil {
+		return err
+	}
+
+	err = wr.patchMeasureRanges()
+
+	if err != nil {
+		return err
+	}
+
+	err = wr.patchLanguageDriver()
+
+	if err != nil {
+		return err
+	}
+
+	err = wr.closeOverflow()
+
+	if err != nil {
+		return err
+	}
+
+	err = wr.WriteProjFile()
+
+	if err != nil {
+		return err
+	}
+
+	err = wr.WriteCodePageFile()
+
+	if err != nil {
+		return err
+	}
+
+	return wr.WriteFieldMap()
+}
+
+// Counts returns the number of records written to each shapefile, keyed
+// by the absolute path of the shapefile.
+
+func (wr *Writer) Counts() map[string]int64 {
+
+	counts := make(map[string]int64)
+
+	if wr.auto {
+
+		for _, child := range wr.writers {
+			counts[child.path] = child.count
+		}
+
+		return counts
+	}
+
+	counts[wr.path] = wr.count
+	return counts
+}
+
+// Vertices returns the total number of vertices in the shapes written before
+// and after simplification.
+
+func (wr *Writer) Vertices() (int64, int64) {
+
+	vertices_in := wr.vertices_in
+	vertices_out := wr.vertices_out
+
+	for _, child := range wr.writers {
+		vertices_in += child.vertices_in
+		vertices_out += child.vertices_out
+	}
+
+	return vertices_in, vertices_out
+}
+
+// Skipped returns the number of features that could not be written to a
+// shapefile, for example because their geometry can not be represented by
+// the writer's shape type or because it falls outside of the clip region.
+
+func (wr *Writer) Skipped() int64 {
+
+	skipped := wr.skipped
+
+	for _, child := range wr.writers {
+		skipped += child.skipped
+	}
+
+	return skipped
 }
 
 func (wr *Writer) WriteProjFile() error {
 
 	prj_path := strings.Replace(wr.path, ".shp", ".prj", -1)
 
-	fh, err := os.OpenFile(prj_path, os.O_RDWR|os.O_CREATE, 0644)
+	fh, err := os.OpenFile(prj_path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 
 	if err != nil {
-		return nil
+		return err
 	}
 
-	_, err = fh.Write([]byte(`GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["Degree",0.017453292519943295]]`))
+	wkt := projection.GCS_WGS_1984
+
+	if wr.ShapeOptions.Projection != nil {
+		wkt = wr.ShapeOptions.Projection.WKT()
+	}
+
+	_, err = fh.Write([]byte(wkt))
 
 	if err != nil {
-		return nil
+		fh.Close()
+		return err
 	}
 
 	return fh.Close()
@@ -139,98 +542,300 @@ func (wr *Writer) WriteProjFile() error {
 
 func (wr *Writer) AddFeature(f geojson.Feature) (int32, error) {
 
-	s, err := FeatureToShape(f, wr.shapetype)
+	if wr.auto {
+		return wr.addFeatureAuto(f)
+	}
 
-	if err != nil {
+	s, report, err := FeatureToShapeWithReport(f, wr.shapetype, wr.ShapeOptions)
+
+	if err == ErrOutsideClipRegion {
+		wr.skipped += 1
+		return -1, nil
+	}
+
+	if err != nil && !wr.options.NullShapes {
+
+		if err == ErrDegenerateClip {
+			wr.Logger.Warning("Skipping %s because %s", f.Id(), err)
+		}
+
+		wr.skipped += 1
 		return -1, nil
 	}
 
+	if err != nil {
+		return wr.addNullFeature(f, report, err)
+	}
+
+	row, err := wr.rowForFeature(f)
+
+	if err != nil {
+		return -1, err
+	}
+
 	idx := wr.shapewriter.Write(s)
-	i := int(idx)
 
-	// something something something SPR...
-	// see notes about attributes above...
-	// (20180815/thisisaaronland)
+	if wr.count == int64(len(wr.nulls)) {
+		wr.bbox = s.BBox()
+	} else {
+		wr.bbox.Extend(s.BBox())
+	}
+
+	wr.extendMeasureRanges(s)
+
+	wr.count += 1
 
-	wr.shapewriter.WriteAttribute(i, 0, f.Id())
-	wr.shapewriter.WriteAttribute(i, 1, f.Name())
-	wr.shapewriter.WriteAttribute(i, 2, f.Placetype())
-	wr.shapewriter.WriteAttribute(i, 3, whosonfirst.Inception(f))
-	wr.shapewriter.WriteAttribute(i, 4, whosonfirst.Cessation(f))
+	wr.vertices_in += int64(report.VerticesIn)
+	wr.vertices_out += int64(report.VerticesOut)
+
+	wr.writeAttributes(int(idx), s, row, report)
+
+	err = wr.flushOverflow(int(idx), f)
+
+	if err != nil {
+		return idx, err
+	}
 
 	return idx, nil
 }
 
+// rowForFeature returns the values defined by the writer's schema for f.
+// Values that can't be written to their field, for example numbers that are
+// too wide for a field whose size was inferred from a sample of features, are
+// replaced with NULL and logged rather than failing the whole record.
+
+func (wr *Writer) rowForFeature(f geojson.Feature) ([]interface{}, error) {
+
+	row, err := wr.options.Schema.Row(f)
+
+	if err != nil {
+		msg := fmt.Sprintf("Failed to derive attributes for %s because %s", f.Id(), err)
+		return nil, errors.New(msg)
+	}
+
+	fields := wr.options.Schema.Fields()
+	count := len(fields)
+
+	if len(row) != count {
+		msg := fmt.Sprintf("Schema returned %d values for %s but defines %d fields", len(row), f.Id(), count)
+		return nil, errors.New(msg)
+	}
+
+	values := make([]interface{}, count)
+
+	for idx, value := range row {
+
+		v, err := fields[idx].DBFValue(value)
+
+		if err != nil {
+			wr.Logger.Warning("Failed to derive %s for %s because %s, writing NULL instead", fields[idx].Name, f.Id(), err)
+			v = fields[idx].nullValue()
+		}
+
+		values[idx] = v
+	}
+
+	return values, nil
+}
+
+// writeAttributes writes row, the values for the writer's schema, followed by
+// the attributes computed from s (which is nil for Null shapes) and those
+// recorded in report.
+
+func (wr *Writer) writeAttributes(i int, s shp.Shape, row []interface{}, report *ShapeReport) {
+
+	for idx, value := range row {
+		wr.writeAttribute(i, idx, value)
+	}
+
+	if wr.computed_idx != -1 {
+
+		proj := wr.ShapeOptions.Projection
+		geographic := proj == nil || proj.IsGeographic()
+
+		for offset, value := range computedValues(wr.options.Computed, s, geographic) {
+
+			idx := wr.computed_idx + offset
+			v, err := wr.fields[idx].DBFValue(value)
+
+			if err != nil {
+				wr.Logger.Warning("Failed to write %s for record %d because %s", wr.fields[idx].Name, i, err)
+				continue
+			}
+
+			wr.writeAttribute(i, idx, v)
+		}
+	}
+
+	if wr.source_idx != -1 {
+		wr.writeAttribute(i, wr.source_idx, report.PointSource)
+	}
+
+	if wr.clipped_idx != -1 {
+
+		clipped := 0
+
+		if report.Clipped {
+			clipped = 1
+		}
+
+		wr.writeAttribute(i, wr.clipped_idx, clipped)
+	}
+
+	if wr.repairs_idx != -1 {
+		wr.writeAttribute(i, wr.repairs_idx, strings.Join(report.Repairs, ","))
+	}
+
+	// addNullFeature writes the actual reason after this
+
+	if wr.null_idx != -1 {
+		wr.writeAttribute(i, wr.null_idx, "")
+	}
+
+	// and flushOverflow writes these for records that were truncated
+
+	if wr.truncated_idx != -1 {
+		wr.writeAttribute(i, wr.truncated_idx, "")
+	}
+
+	if wr.overflow_idx != -1 {
+		wr.writeAttribute(i, wr.overflow_idx, fmt.Sprintf("%10s", ""))
+	}
+}
+
 func FeatureToShape(f geojson.Feature, shapetype shp.ShapeType) (shp.Shape, error) {
+	return FeatureToShapeWithOptions(f, shapetype, NewDefaultShapeOptions())
+}
 
-	switch shapetype {
+func FeatureToShapeWithOptions(f geojson.Feature, shapetype shp.ShapeType, opts *ShapeOptions) (shp.Shape, error) {
+	s, _, err := FeatureToShapeWithReport(f, shapetype, opts)
+	return s, err
+}
+
+// FeatureToShapeWithReport returns a shape for f along with a ShapeReport
+// describing how the shape was derived.
+
+func FeatureToShapeWithReport(f geojson.Feature, shapetype shp.ShapeType, opts *ShapeOptions) (shp.Shape, *ShapeReport, error) {
+
+	report := new(ShapeReport)
+
+	var s shp.Shape
+	var err error
+
+	switch baseShapeType(shapetype) {
 
 	case shp.MULTIPOINT:
-		return FeatureToMultiPoint(f)
+		s, err = FeatureToMultiPointWithStrategy(f, opts.MultiPointStrategy)
 	case shp.POLYLINE:
-		return FeatureToPolyline(f)
+		s, err = FeatureToPolyline(f)
 	case shp.POINT:
-		return FeatureToPoint(f)
+		s, report.PointSource, err = featureToPointWithSources(f, opts.PointSources)
 	case shp.POLYGON:
-		return FeatureToPolygon(f)
+		s, err = FeatureToPolygon(f)
 	default:
-		return nil, errors.New("Unsupported shape type")
+		err = errors.New("Unsupported shape type")
 	}
-}
 
-func FeatureToMultiPoint(f geojson.Feature) (shp.Shape, error) {
+	if err != nil {
+		return nil, report, err
+	}
 
-	coords := gjson.GetBytes(f.Bytes(), "geometry.coordinates")
+	s, _, err = AntimeridianShape(s, opts.Antimeridian)
 
-	if !coords.Exists() {
-		return nil, errors.New("Missing coordinates")
+	if err != nil {
+		return nil, report, err
 	}
 
-	points := make([]shp.Point, 0)
+	// clip regions are always WGS84 so this needs to happen before shapes
+	// are reprojected (normalized shapes are compared to the clip region
+	// as-is so clip regions need to use the same 0 to 360 range)
 
-	swlat := 0.0
-	swlon := 0.0
-	nelat := 0.0
-	nelon := 0.0
+	if opts.Clip != nil {
 
-	for _, c := range coords.Array() {
+		s, report.Clipped, err = opts.Clip.ClipShape(s)
 
-		pt := c.Array()
+		if err != nil {
+			return nil, report, err
+		}
+	}
 
-		lat := pt[1].Float()
-		lon := pt[0].Float()
+	if opts.Projection != nil {
 
-		shp_pt := shp.Point{lon, lat}
-		points = append(points, shp_pt)
+		s, err = ProjectShape(s, opts.Projection, opts.Densify)
 
-		if lat < swlat {
-			swlat = lat
+		if err != nil {
+			return nil, report, err
 		}
+	}
 
-		if lon < swlon {
-			swlon = lon
-		}
+	report.VerticesIn = countVertices(s)
 
-		if lat > nelat {
-			lat = nelat
-		}
+	if opts.SimplifyTolerance > 0.0 {
+
+		s, err = SimplifyShape(s, opts.SimplifyTolerance, opts.SimplifyAlgorithm)
 
-		if lon > nelon {
-			lon = nelon
+		if err != nil {
+			return nil, report, err
 		}
+	}
+
+	report.VerticesOut = countVertices(s)
+
+	s, report.Repairs, err = ValidateShape(s, opts.Validation)
+
+	if err != nil {
+		return nil, report, err
+	}
+
+	switch shapetype {
+
+	case shp.MULTIPOINTZ, shp.POLYLINEZ, shp.POINTZ, shp.POLYGONZ:
+		s, err = shapeToZ(f, s, opts)
+	case shp.MULTIPOINTM, shp.POLYLINEM, shp.POINTM, shp.POLYGONM:
+		s, err = shapeToM(f, s, opts)
+	}
+
+	if err != nil {
+		return nil, report, err
+	}
+
+	return s, report, nil
+}
+
+func FeatureToMultiPoint(f geojson.Feature) (shp.Shape, error) {
+	return FeatureToMultiPointWithStrategy(f, MULTIPOINT_VERTICES)
+}
+
+func FeatureToMultiPointWithStrategy(f geojson.Feature, strategy string) (shp.Shape, error) {
+
+	if !IsValidMultiPointStrategy(strategy) {
+		return nil, errors.New("Unsupported multipoint strategy")
+	}
+
+	g := gjson.GetBytes(f.Bytes(), "geometry")
 
+	if !g.Exists() {
+		return nil, errors.New("Missing geometry")
 	}
 
-	box := shp.Box{
-		swlon, swlat, nelon, nelat,
+	points, err := pointsForGeometry(g)
+
+	if err != nil {
+		return nil, err
 	}
 
-	num := int32(len(points))
+	if strategy == MULTIPOINT_DISTINCT {
+		points = distinctPoints(points)
+	}
+
+	if len(points) == 0 {
+		return nil, errors.New("Feature has no points")
+	}
 
 	multi := shp.MultiPoint{
-		NumPoints: num,
+		Box:       shp.BBoxFromPoints(points),
+		NumPoints: int32(len(points)),
 		Points:    points,
-		Box:       box,
 	}
 
 	return &multi, nil
@@ -238,75 +843,120 @@ func FeatureToMultiPoint(f geojson.Feature) (shp.Shape, error) {
 
 func FeatureToPolyline(f geojson.Feature) (shp.Shape, error) {
 
-	coords := gjson.GetBytes(f.Bytes(), "geometry.coordinates")
+	// LineStrings become a single part, MultiLineStrings one part per
+	// line and polygons one part per ring (exterior and interior) so that
+	// it's possible to export administrative outlines as lines
+
+	g := gjson.GetBytes(f.Bytes(), "geometry")
 
-	if !coords.Exists() {
-		return nil, errors.New("Missing coordinates")
+	if !g.Exists() {
+		return nil, errors.New("Missing geometry")
 	}
 
-	points := make([]shp.Point, 0)
+	lines, err := linesForGeometry(g)
 
-	for _, c := range coords.Array() {
+	if err != nil {
+		return nil, err
+	}
 
-		pt := c.Array()
+	parts := make([][]shp.Point, 0)
 
-		lat := pt[1].Float()
-		lon := pt[0].Float()
+	for _, pts := range lines {
+
+		if len(pts) < 2 {
+			continue
+		}
 
-		shp_pt := shp.Point{lon, lat}
-		points = append(points, shp_pt)
+		parts = append(parts, pts)
 	}
 
-	poly := [][]shp.Point{points}
+	if len(parts) == 0 {
+		return nil, errors.New("Feature has no valid lines")
+	}
 
-	polygon := shp.NewPolyLine(poly)
-	return polygon, nil
+	return shp.NewPolyLine(parts), nil
 }
 
 func FeatureToPoint(f geojson.Feature) (shp.Shape, error) {
+	return FeatureToPointWithSources(f, DefaultPointSources())
+}
+
+// FeatureToPointWithSources returns a point derived from the first source
+// in sources that can be resolved for f. See PointForFeature for details.
+
+func FeatureToPointWithSources(f geojson.Feature, sources []string) (shp.Shape, error) {
+	s, _, err := featureToPointWithSources(f, sources)
+	return s, err
+}
+
+func featureToPointWithSources(f geojson.Feature, sources []string) (shp.Shape, string, error) {
 
-	c, err := whosonfirst.Centroid(f)
+	pt, source, err := PointForFeature(f, sources)
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	coord := c.Coord()
-
-	pt := shp.Point{coord.X, coord.Y}
-	return &pt, nil
+	return &pt, source, nil
 }
 
+// FeatureToPolygon returns a polygon for a feature whose geometry is a Polygon
+// or a MultiPolygon. Other geometry types, and invalid positions, are errors.
+
 func FeatureToPolygon(f geojson.Feature) (shp.Shape, error) {
 
-	polys, err := f.Polygons()
+	g := gjson.GetBytes(f.Bytes(), "geometry")
+
+	if !g.Exists() {
+		return nil, errors.New("Missing geometry")
+	}
+
+	t := g.Get("type").String()
+
+	if t != "Polygon" && t != "MultiPolygon" {
+		msg := fmt.Sprintf("Geometry type '%s' can not be represented as polygons", t)
+		return nil, errors.New(msg)
+	}
+
+	polys, err := polygonsForGeometry(g)
 
 	if err != nil {
 		return nil, err
 	}
 
-	points := make([][]shp.Point, 0)
+	rings := make([][]shp.Point, 0)
 
 	for _, poly := range polys {
 
-		/*
-		if len(poly.InteriorRings()) > 0 {
-			return nil, errors.New("Polygon has interior rings")
+		ext_pts := closeRing(poly[0])
+
+		if len(ext_pts) < 4 {
+			continue
 		}
-		*/
-		
-		ext := poly.ExteriorRing()
 
-		pts := make([]shp.Point, 0)
+		// the ESRI spec says outer rings are clockwise and holes are
+		// counter-clockwise which is the opposite of RFC 7946 so we
+		// just force the issue rather than trusting the input...
+
+		rings = append(rings, orientRing(ext_pts, true))
+
+		for _, inner := range poly[1:] {
 
-		for _, coord := range ext.Vertices() {
-			pt := shp.Point{coord.X, coord.Y}
-			pts = append(pts, pt)
+			// skip anything that can't possibly be a ring
+
+			inner_pts := closeRing(inner)
+
+			if len(inner_pts) < 4 {
+				continue
+			}
+
+			rings = append(rings, orientRing(inner_pts, false))
 		}
+	}
 
-		points = append(points, pts)
+	if len(rings) == 0 {
+		return nil, errors.New("Feature has no valid polygon rings")
 	}
 
-	polygon := shp.NewPolyLine(points)
-	return polygon, nil
+	return newPolygon(rings), nil
 }
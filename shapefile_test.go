@@ -0,0 +1,339 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"testing"
+)
+
+func testFeature(t *testing.T, body string) geojson.Feature {
+
+	f, err := feature.NewGeoJSONFeature([]byte(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestFeatureToPolygon(t *testing.T) {
+
+	// input rings are wound the RFC 7946 way (counter-clockwise shells,
+	// clockwise holes) which is the opposite of the ESRI spec
+
+	tests := []struct {
+		label     string
+		geometry  string
+		clockwise []bool
+		sizes     []int
+		box       shp.Box
+	}{
+		{
+			label:     "polygon with hole",
+			geometry:  `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,8],[8,8],[8,2],[2,2]]]}`,
+			clockwise: []bool{true, false},
+			sizes:     []int{5, 5},
+			box:       shp.Box{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10},
+		},
+		{
+			label:     "unclosed rings",
+			geometry:  `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10]],[[2,2],[2,8],[8,8],[8,2]]]}`,
+			clockwise: []bool{true, false},
+			sizes:     []int{5, 5},
+			box:       shp.Box{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10},
+		},
+		{
+			label:     "multipolygon",
+			geometry:  `{"type":"MultiPolygon","coordinates":[[[[0,0],[0,10],[10,10],[10,0],[0,0]],[[2,2],[8,2],[8,8],[2,8],[2,2]]],[[[20,20],[30,20],[30,30],[20,30],[20,20]]]]}`,
+			clockwise: []bool{true, false, true},
+			sizes:     []int{5, 5, 5},
+			box:       shp.Box{MinX: 0, MinY: 0, MaxX: 30, MaxY: 30},
+		},
+		{
+			label:     "too few points",
+			geometry:  `{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[8,8],[2,2]]],[[[20,20],[30,30],[20,20]]]]}`,
+			clockwise: []bool{true},
+			sizes:     []int{5},
+			box:       shp.Box{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10},
+		},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+test.geometry+`}`)
+
+		s, err := FeatureToPolygon(f)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		poly, ok := s.(*shp.Polygon)
+
+		if !ok {
+			t.Errorf("%s: expected a polygon but got %T", test.label, s)
+			continue
+		}
+
+		rings := shapeParts(poly.Parts, poly.Points)
+
+		if len(rings) != len(test.clockwise) {
+			t.Errorf("%s: expected %d rings but got %d", test.label, len(test.clockwise), len(rings))
+			continue
+		}
+
+		for i, ring := range rings {
+
+			if len(ring) != test.sizes[i] {
+				t.Errorf("%s: expected ring %d to have %d points but got %d", test.label, i, test.sizes[i], len(ring))
+			}
+
+			if ring[0] != ring[len(ring)-1] {
+				t.Errorf("%s: ring %d is not closed", test.label, i)
+			}
+
+			if isClockwise(ring) != test.clockwise[i] {
+				t.Errorf("%s: expected ring %d clockwise to be %t", test.label, i, test.clockwise[i])
+			}
+		}
+
+		if !boxEquals(poly.BBox(), test.box) {
+			t.Errorf("%s: expected a bounding box of %v but got %v", test.label, test.box, poly.BBox())
+		}
+	}
+}
+
+func TestFeatureToPolygonInvalid(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		geometry string
+	}{
+		{"no valid rings", `{"type":"Polygon","coordinates":[[[0,0],[0,10],[0,0]]]}`},
+		{"point", `{"type":"Point","coordinates":[5,7]}`},
+		{"multipoint", `{"type":"MultiPoint","coordinates":[[0,0],[10,0],[10,10],[0,10]]}`},
+		{"linestring", `{"type":"LineString","coordinates":[[0,0],[10,0],[10,10],[0,0]]}`},
+		{"short position", `{"type":"Polygon","coordinates":[[[5],[6,8],[10,10],[0,10],[5]]]}`},
+		{"string position", `{"type":"Polygon","coordinates":[[[0,0],["10",0],[10,10],[0,0]]]}`},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+test.geometry+`}`)
+
+		_, err := FeatureToPolygon(f)
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.label)
+		}
+	}
+}
+
+func TestFeatureToPolyline(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		geometry string
+		sizes    []int
+	}{
+		{
+			label:    "linestring",
+			geometry: `{"type":"LineString","coordinates":[[0,0],[1,1],[2,0]]}`,
+			sizes:    []int{3},
+		},
+		{
+			label:    "multilinestring",
+			geometry: `{"type":"MultiLineString","coordinates":[[[0,0],[1,1]],[[2,2],[3,3],[4,2]],[[5,5]]]}`,
+			sizes:    []int{2, 3},
+		},
+		{
+			label:    "polygon with hole",
+			geometry: `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,8],[8,8],[8,2],[2,2]]]}`,
+			sizes:    []int{5, 5},
+		},
+		{
+			label:    "multipolygon",
+			geometry: `{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,8],[8,8],[8,2],[2,2]]],[[[20,20],[30,20],[30,30],[20,20]]]]}`,
+			sizes:    []int{5, 5, 4},
+		},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+test.geometry+`}`)
+
+		s, err := FeatureToPolyline(f)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		pl, ok := s.(*shp.PolyLine)
+
+		if !ok {
+			t.Errorf("%s: expected a polyline but got %T", test.label, s)
+			continue
+		}
+
+		parts := shapeParts(pl.Parts, pl.Points)
+
+		if len(parts) != len(test.sizes) {
+			t.Errorf("%s: expected %d parts but got %d", test.label, len(test.sizes), len(parts))
+			continue
+		}
+
+		for i, part := range parts {
+
+			if len(part) != test.sizes[i] {
+				t.Errorf("%s: expected part %d to have %d points but got %d", test.label, i, test.sizes[i], len(part))
+			}
+		}
+	}
+}
+
+func TestFeatureToPolylineInvalid(t *testing.T) {
+
+	geometries := []string{
+		`{"type":"Point","coordinates":[0,0]}`,
+		`{"type":"LineString","coordinates":[[0,0]]}`,
+		`{"type":"LineString","coordinates":[[0,0],[1]]}`,
+	}
+
+	for _, geom := range geometries {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+geom+`}`)
+
+		_, err := FeatureToPolyline(f)
+
+		if err == nil {
+			t.Errorf("expected %s to fail", geom)
+		}
+	}
+}
+
+func TestFeatureToMultiPoint(t *testing.T) {
+
+	tests := []struct {
+		label    string
+		geometry string
+		vertices int
+		distinct int
+		box      shp.Box
+	}{
+		{
+			label:    "point",
+			geometry: `{"type":"Point","coordinates":[-73.5,45.5]}`,
+			vertices: 1,
+			distinct: 1,
+			box:      shp.Box{MinX: -73.5, MinY: 45.5, MaxX: -73.5, MaxY: 45.5},
+		},
+		{
+			label:    "multipoint",
+			geometry: `{"type":"MultiPoint","coordinates":[[-10,-20],[10,20],[-10,-20]]}`,
+			vertices: 3,
+			distinct: 2,
+			box:      shp.Box{MinX: -10, MinY: -20, MaxX: 10, MaxY: 20},
+		},
+		{
+			label:    "linestring",
+			geometry: `{"type":"LineString","coordinates":[[1,1],[2,5],[3,1],[1,1]]}`,
+			vertices: 4,
+			distinct: 3,
+			box:      shp.Box{MinX: 1, MinY: 1, MaxX: 3, MaxY: 5},
+		},
+		{
+			label:    "multilinestring",
+			geometry: `{"type":"MultiLineString","coordinates":[[[1,1],[2,2]],[[2,2],[3,-3]]]}`,
+			vertices: 4,
+			distinct: 3,
+			box:      shp.Box{MinX: 1, MinY: -3, MaxX: 3, MaxY: 2},
+		},
+		{
+			// the closing vertex of each ring is omitted
+
+			label:    "polygon",
+			geometry: `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,8],[8,8],[8,2],[2,2]]]}`,
+			vertices: 8,
+			distinct: 8,
+			box:      shp.Box{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10},
+		},
+		{
+			label:    "multipolygon",
+			geometry: `{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,0]]],[[[10,10],[20,10],[20,20],[10,10]]]]}`,
+			vertices: 6,
+			distinct: 5,
+			box:      shp.Box{MinX: 0, MinY: 0, MaxX: 20, MaxY: 20},
+		},
+		{
+			label:    "geometry collection",
+			geometry: `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[5,5]},{"type":"LineString","coordinates":[[5,5],[6,-6]]}]}`,
+			vertices: 3,
+			distinct: 2,
+			box:      shp.Box{MinX: 5, MinY: -6, MaxX: 6, MaxY: 5},
+		},
+	}
+
+	for _, test := range tests {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+test.geometry+`}`)
+
+		for strategy, count := range map[string]int{MULTIPOINT_VERTICES: test.vertices, MULTIPOINT_DISTINCT: test.distinct} {
+
+			s, err := FeatureToMultiPointWithStrategy(f, strategy)
+
+			if err != nil {
+				t.Errorf("%s (%s): %s", test.label, strategy, err)
+				continue
+			}
+
+			multi, ok := s.(*shp.MultiPoint)
+
+			if !ok {
+				t.Errorf("%s (%s): expected a multipoint but got %T", test.label, strategy, s)
+				continue
+			}
+
+			if int(multi.NumPoints) != count || len(multi.Points) != count {
+				t.Errorf("%s (%s): expected %d points but got %d", test.label, strategy, count, len(multi.Points))
+			}
+
+			if !boxEquals(multi.BBox(), test.box) {
+				t.Errorf("%s (%s): expected a bounding box of %v but got %v", test.label, strategy, test.box, multi.BBox())
+			}
+		}
+	}
+}
+
+func TestFeatureToMultiPointInvalid(t *testing.T) {
+
+	geometries := []string{
+		`{"type":"MultiPoint","coordinates":[[0,0],[1]]}`,
+		`{"type":"MultiPoint","coordinates":[[0,0],["1","2"]]}`,
+		`{"type":"LineString","coordinates":[0,0]}`,
+		`{"type":"MultiPoint","coordinates":[[0,0],[181,0]]}`,
+		`{"type":"MultiPoint","coordinates":[[0,0],[0,-91]]}`,
+	}
+
+	for _, geom := range geometries {
+
+		f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":`+geom+`}`)
+
+		_, err := FeatureToMultiPointWithStrategy(f, MULTIPOINT_VERTICES)
+
+		if err == nil {
+			t.Errorf("expected %s to fail", geom)
+		}
+	}
+
+	f := testFeature(t, `{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Point","coordinates":[0,0]}}`)
+
+	_, err := FeatureToMultiPointWithStrategy(f, "bogus")
+
+	if err == nil {
+		t.Error("expected an invalid strategy to fail")
+	}
+}
@@ -0,0 +1,468 @@
+package shapefile
+
+import (
+	"container/heap"
+	"errors"
+	"github.com/jonas-p/go-shp"
+	"math"
+)
+
+// The algorithms used to simplify POLYLINE and POLYGON shapes. Both use the
+// same (ShapeOptions.SimplifyTolerance) tolerance, measured in the units of
+// the output coordinates: for "douglas-peucker" it is the maximum distance a
+// removed vertex may be from the simplified line and for "visvalingam" it is
+// the square root of the smallest effective area a vertex must have to be
+// retained.
+
+const (
+	SIMPLIFY_DOUGLAS_PEUCKER = "douglas-peucker"
+	SIMPLIFY_VISVALINGAM     = "visvalingam"
+)
+
+func SimplifyAlgorithms() []string {
+
+	return []string{
+		SIMPLIFY_DOUGLAS_PEUCKER,
+		SIMPLIFY_VISVALINGAM,
+	}
+}
+
+func IsValidSimplifyAlgorithm(test string) bool {
+
+	valid := false
+
+	for _, algo := range SimplifyAlgorithms() {
+
+		if algo == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// SimplifyShape returns a simplified copy of s if it is a PolyLine or a
+// Polygon. Other shapes are returned as-is. Polygon rings are never reduced
+// below four points (three distinct vertices and a closing vertex) and holes
+// are only simplified if they remain inside their (simplified) shell.
+
+func SimplifyShape(s shp.Shape, tolerance float64, algorithm string) (shp.Shape, error) {
+
+	if !IsValidSimplifyAlgorithm(algorithm) {
+		return nil, errors.New("Unsupported simplification algorithm")
+	}
+
+	if tolerance <= 0.0 {
+		return s, nil
+	}
+
+	simplify := func(pts []shp.Point) []shp.Point {
+
+		if algorithm == SIMPLIFY_VISVALINGAM {
+			return simplifyVisvalingam(pts, tolerance)
+		}
+
+		return simplifyDouglasPeucker(pts, tolerance)
+	}
+
+	switch shape := s.(type) {
+
+	case *shp.PolyLine:
+
+		parts := make([][]shp.Point, 0)
+
+		for _, pts := range shapeParts(shape.Parts, shape.Points) {
+			parts = append(parts, simplify(pts))
+		}
+
+		return shp.NewPolyLine(parts), nil
+
+	case *shp.Polygon:
+
+		rings := make([][]shp.Point, 0)
+
+		for _, poly := range groupRings(shapeParts(shape.Parts, shape.Points)) {
+			rings = append(rings, simplifyPolygon(poly, simplify)...)
+		}
+
+		return newPolygon(rings), nil
+
+	default:
+		return s, nil
+	}
+}
+
+// simplifyPolygon simplifies the rings (shell first, followed by its holes)
+// of a single polygon.
+
+func simplifyPolygon(rings [][]shp.Point, simplify func([]shp.Point) []shp.Point) [][]shp.Point {
+
+	simplifyRing := func(ring []shp.Point) []shp.Point {
+
+		s := simplify(ring)
+
+		if len(s) < 4 {
+			return ring
+		}
+
+		return s
+	}
+
+	shell := simplifyRing(rings[0])
+	holes := make([][]shp.Point, 0)
+
+	for _, hole := range rings[1:] {
+		holes = append(holes, simplifyRing(hole))
+	}
+
+	// if the simplified shell has cut across any of the original holes
+	// then give up and use the original shell
+
+	for _, hole := range rings[1:] {
+
+		if !ringInsideRing(hole, shell) {
+			shell = rings[0]
+			break
+		}
+	}
+
+	for i, hole := range holes {
+
+		if !ringInsideRing(hole, shell) {
+			holes[i] = rings[i+1]
+		}
+	}
+
+	// likewise simplified holes can cross, or swallow, each other in which
+	// case one of them is replaced by the original until there are no more
+	// overlaps (since simplifying only removes vertices a hole with as many
+	// vertices as the original is the original)
+
+	simplified := func(i int) bool {
+		return len(holes[i]) != len(rings[i+1])
+	}
+
+	for changed := true; changed; {
+
+		changed = false
+
+		for i := range holes {
+
+			for j := 0; j < i; j++ {
+
+				if !simplified(i) && !simplified(j) {
+					continue
+				}
+
+				if !ringsOverlap(holes[i], holes[j]) {
+					continue
+				}
+
+				k := i
+
+				if !simplified(i) {
+					k = j
+				}
+
+				holes[k] = rings[k+1]
+				changed = true
+			}
+		}
+	}
+
+	return append([][]shp.Point{shell}, holes...)
+}
+
+// simplifyDouglasPeucker simplifies pts using the Ramer-Douglas-Peucker
+// algorithm. The first and last points are always retained.
+
+func simplifyDouglasPeucker(pts []shp.Point, tolerance float64) []shp.Point {
+
+	count := len(pts)
+
+	if count < 3 {
+		return pts
+	}
+
+	keep := make([]bool, count)
+	keep[0] = true
+	keep[count-1] = true
+
+	sq_tolerance := tolerance * tolerance
+
+	stack := [][2]int{{0, count - 1}}
+
+	for len(stack) > 0 {
+
+		span := stack[len(stack)-1]
+		stack = stack[0 : len(stack)-1]
+
+		first := span[0]
+		last := span[1]
+
+		max_dist := 0.0
+		idx := -1
+
+		for i := first + 1; i < last; i++ {
+
+			d := segmentDistanceSquared(pts[i].X, pts[i].Y, pts[first], pts[last])
+
+			if d > max_dist {
+				max_dist = d
+				idx = i
+			}
+		}
+
+		if idx != -1 && max_dist > sq_tolerance {
+			keep[idx] = true
+			stack = append(stack, [2]int{first, idx}, [2]int{idx, last})
+		}
+	}
+
+	simplified := make([]shp.Point, 0)
+
+	for i, pt := range pts {
+
+		if keep[i] {
+			simplified = append(simplified, pt)
+		}
+	}
+
+	return simplified
+}
+
+type vwVertex struct {
+	idx   int
+	area  float64
+	index int // position in the heap
+}
+
+type vwQueue []*vwVertex
+
+func (q vwQueue) Len() int {
+	return len(q)
+}
+
+func (q vwQueue) Less(i, j int) bool {
+	return q[i].area < q[j].area
+}
+
+func (q vwQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *vwQueue) Push(x interface{}) {
+	v := x.(*vwVertex)
+	v.index = len(*q)
+	*q = append(*q, v)
+}
+
+func (q *vwQueue) Pop() interface{} {
+	old := *q
+	count := len(old)
+	v := old[count-1]
+	*q = old[0 : count-1]
+	return v
+}
+
+// simplifyVisvalingam simplifies pts using the Visvalingam-Whyatt algorithm,
+// removing vertices whose effective area is less than tolerance squared. The
+// first and last points are always retained.
+
+func simplifyVisvalingam(pts []shp.Point, tolerance float64) []shp.Point {
+
+	count := len(pts)
+
+	if count < 3 {
+		return pts
+	}
+
+	min_area := tolerance * tolerance
+
+	prev := make([]int, count)
+	next := make([]int, count)
+	vertices := make([]*vwVertex, count)
+
+	triangleArea := func(a int, b int, c int) float64 {
+		return math.Abs((pts[a].X-pts[c].X)*(pts[b].Y-pts[a].Y)-(pts[a].X-pts[b].X)*(pts[c].Y-pts[a].Y)) / 2.0
+	}
+
+	q := make(vwQueue, 0)
+
+	for i := 0; i < count; i++ {
+
+		prev[i] = i - 1
+		next[i] = i + 1
+
+		if i == 0 || i == count-1 {
+			continue
+		}
+
+		v := vwVertex{
+			idx:  i,
+			area: triangleArea(i-1, i, i+1),
+		}
+
+		vertices[i] = &v
+		heap.Push(&q, &v)
+	}
+
+	removed := make([]bool, count)
+	max_area := 0.0
+
+	for q.Len() > 0 {
+
+		v := heap.Pop(&q).(*vwVertex)
+
+		// ensure that a vertex is never eliminated before the vertices
+		// that were eliminated before it
+
+		area := math.Max(v.area, max_area)
+
+		if area >= min_area {
+			break
+		}
+
+		max_area = area
+		removed[v.idx] = true
+
+		p := prev[v.idx]
+		n := next[v.idx]
+
+		next[p] = n
+		prev[n] = p
+
+		for _, i := range []int{p, n} {
+
+			if vertices[i] == nil {
+				continue
+			}
+
+			if prev[i] < 0 || next[i] >= count {
+				continue
+			}
+
+			vertices[i].area = triangleArea(prev[i], i, next[i])
+			heap.Fix(&q, vertices[i].index)
+		}
+	}
+
+	simplified := make([]shp.Point, 0)
+
+	for i, pt := range pts {
+
+		if !removed[i] {
+			simplified = append(simplified, pt)
+		}
+	}
+
+	return simplified
+}
+
+// shapeParts splits points in to parts using the offsets in parts.
+
+func shapeParts(parts []int32, points []shp.Point) [][]shp.Point {
+
+	split := make([][]shp.Point, len(parts))
+
+	for i, start := range parts {
+
+		end := int32(len(points))
+
+		if i < len(parts)-1 {
+			end = parts[i+1]
+		}
+
+		split[i] = points[start:end]
+	}
+
+	return split
+}
+
+// groupRings groups the (ESRI oriented) rings of a Polygon shape in to
+// polygons where each clockwise ring starts a new polygon and each
+// counter-clockwise ring is a hole in the polygon preceding it.
+
+func groupRings(rings [][]shp.Point) [][][]shp.Point {
+
+	polys := make([][][]shp.Point, 0)
+
+	for _, ring := range rings {
+
+		if isClockwise(ring) || len(polys) == 0 {
+			polys = append(polys, [][]shp.Point{ring})
+			continue
+		}
+
+		last := len(polys) - 1
+		polys[last] = append(polys[last], ring)
+	}
+
+	return polys
+}
+
+// ringInsideRing returns true if every vertex of inner is inside (or on the
+// edge of) outer and none of their edges cross. Testing the vertices alone
+// isn't enough since a simplified shell can cut across the edge of a hole
+// whose vertices are all still inside it.
+
+func ringInsideRing(inner []shp.Point, outer []shp.Point) bool {
+
+	rings := [][]shp.Point{outer}
+
+	for _, pt := range inner {
+
+		d := pointToPolygonDistance(pt.X, pt.Y, rings)
+
+		if d < 0.0 {
+			return false
+		}
+	}
+
+	return !ringsCross([][]shp.Point{outer, inner})
+}
+
+// ringsOverlap returns true if the edges of a and b cross or if either ring
+// has a vertex inside the other. Rings that only touch do not overlap.
+
+func ringsOverlap(a []shp.Point, b []shp.Point) bool {
+
+	if !boxIntersects(shp.BBoxFromPoints(a), shp.BBoxFromPoints(b)) {
+		return false
+	}
+
+	for _, pair := range [][2][]shp.Point{{a, b}, {b, a}} {
+
+		rings := [][]shp.Point{pair[1]}
+
+		for _, pt := range pair[0] {
+
+			if pointToPolygonDistance(pt.X, pt.Y, rings) > 0.0 {
+				return true
+			}
+		}
+	}
+
+	return ringsCross([][]shp.Point{a, b})
+}
+
+// countVertices returns the number of vertices in s.
+
+func countVertices(s shp.Shape) int {
+
+	switch shape := s.(type) {
+	case *shp.Point:
+		return 1
+	case *shp.MultiPoint:
+		return len(shape.Points)
+	case *shp.PolyLine:
+		return len(shape.Points)
+	case *shp.Polygon:
+		return len(shape.Points)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,124 @@
+package shapefile
+
+import (
+	"github.com/jonas-p/go-shp"
+	"testing"
+)
+
+func testRing(coords ...float64) []shp.Point {
+
+	pts := make([]shp.Point, 0)
+
+	for i := 0; i < len(coords)-1; i += 2 {
+		pts = append(pts, shp.Point{X: coords[i], Y: coords[i+1]})
+	}
+
+	return pts
+}
+
+func TestRingInsideRing(t *testing.T) {
+
+	// a square with a notch cut in to its bottom edge, up to (5,5)
+	notched := testRing(0, 0, 0, 10, 10, 10, 10, 0, 6, 0, 5, 5, 4, 0, 0, 0)
+
+	tests := []struct {
+		label  string
+		inner  []shp.Point
+		outer  []shp.Point
+		inside bool
+	}{
+		{"inside", testRing(2, 6, 2, 8, 8, 8, 8, 6, 2, 6), notched, true},
+		{"vertex outside", testRing(2, 6, 2, 12, 8, 8, 8, 6, 2, 6), notched, false},
+		{"edge crosses", testRing(3, 4, 5, 8, 7, 4, 3, 4), notched, false},
+		{"touches", testRing(0, 2, 2, 8, 3, 2, 0, 2), notched, true},
+	}
+
+	for _, test := range tests {
+
+		inside := ringInsideRing(test.inner, test.outer)
+
+		if inside != test.inside {
+			t.Errorf("%s: expected %t but got %t", test.label, test.inside, inside)
+		}
+	}
+}
+
+func TestSimplifyPolygonKeepsHoles(t *testing.T) {
+
+	// the shell's top edge bulges up to (5,10.5) which Douglas-Peucker
+	// removes, cutting across the top of the hole
+
+	shell := testRing(0, 0, 0, 10, 5, 10.5, 10, 10, 10, 0, 0, 0)
+	hole := testRing(4, 9, 5, 10.2, 6, 9, 4, 9)
+
+	simplify := func(pts []shp.Point) []shp.Point {
+		return simplifyDouglasPeucker(pts, 1.0)
+	}
+
+	rings := simplifyPolygon([][]shp.Point{shell, hole}, simplify)
+
+	if len(rings[0]) != len(shell) {
+		t.Fatalf("expected the original shell (%d vertices) but got %d vertices", len(shell), len(rings[0]))
+	}
+
+	if !ringInsideRing(rings[1], rings[0]) {
+		t.Fatal("hole is not inside shell")
+	}
+}
+
+func TestSimplifyPolygonHolesOverlap(t *testing.T) {
+
+	// the top edge of the first hole dips down to (5,9.5) around the
+	// second hole which Douglas-Peucker removes, swallowing the second
+	// hole
+
+	shell := testRing(0, 0, 0, 20, 20, 20, 20, 0, 0, 0)
+	hole_a := testRing(2, 2, 2, 10, 5, 9.5, 8, 10, 8, 2, 2, 2)
+	hole_b := testRing(4.8, 9.8, 5.2, 9.8, 5, 9.95, 4.8, 9.8)
+
+	simplify := func(pts []shp.Point) []shp.Point {
+		return simplifyDouglasPeucker(pts, 1.0)
+	}
+
+	if !ringsOverlap(simplify(hole_a), hole_b) {
+		t.Fatal("expected the simplified hole to overlap the other hole")
+	}
+
+	rings := simplifyPolygon([][]shp.Point{shell, hole_a, hole_b}, simplify)
+
+	if len(rings) != 3 {
+		t.Fatalf("expected 3 rings but got %d", len(rings))
+	}
+
+	if len(rings[1]) != len(hole_a) {
+		t.Errorf("expected the original hole (%d vertices) but got %d vertices", len(hole_a), len(rings[1]))
+	}
+
+	if ringsOverlap(rings[1], rings[2]) {
+		t.Error("holes overlap")
+	}
+}
+
+func TestRingsOverlap(t *testing.T) {
+
+	square := testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0)
+
+	tests := []struct {
+		label   string
+		ring    []shp.Point
+		overlap bool
+	}{
+		{"disjoint", testRing(20, 20, 20, 30, 30, 30, 30, 20, 20, 20), false},
+		{"touches", testRing(10, 0, 10, 10, 20, 10, 20, 0, 10, 0), false},
+		{"crosses", testRing(5, 5, 5, 15, 15, 15, 15, 5, 5, 5), true},
+		{"inside", testRing(2, 2, 2, 8, 8, 8, 8, 2, 2, 2), true},
+		{"contains", testRing(-5, -5, -5, 15, 15, 15, 15, -5, -5, -5), true},
+	}
+
+	for _, test := range tests {
+
+		if ringsOverlap(square, test.ring) != test.overlap {
+			t.Errorf("%s: expected %t", test.label, test.overlap)
+		}
+	}
+}
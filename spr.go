@@ -0,0 +1,167 @@
+package shapefile
+
+import (
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2"
+	"strconv"
+	"strings"
+)
+
+// SPRSchema writes the full standard places response (SPR) for each feature
+// as returned by geojson.Feature.SPR(). See also:
+// https://github.com/whosonfirst/go-whosonfirst-spr
+//
+//	ID          wof:id
+//	PARENT_ID   wof:parent_id
+//	NAME        wof:name
+//	PLACETYPE   wof:placetype
+//	COUNTRY     wof:country
+//	REPO        wof:repo
+//	PATH        the relative path of the feature
+//	URI         the absolute URI of the feature
+//	LAT, LON    the feature's centroid
+//	MIN_LAT ... the feature's bounding box (MIN_LAT, MIN_LON, MAX_LAT, MAX_LON)
+//	IS_CURRENT  mz:is_current
+//	IS_DEPREC   is the feature deprecated
+//	IS_CEASED   is the feature ceased
+//	IS_SUPERSD  is the feature superseded
+//	IS_SUPSING  is the feature superseding other features
+//	SUPER_BY    wof:superseded_by, as a comma-separated list
+//	SUPERSEDES  wof:supersedes, as a comma-separated list
+//	LASTMOD     wof:lastmodified, as a Unix timestamp
+//	GEOM_AREA   geom:area, which isn't part of the SPR
+//
+// IDs are written as numbers and existential flags as logical values which
+// are null (rather than true or false) if the flag is unknown. PARENT_ID and
+// LASTMOD are null if their property is missing or isn't a number, rather
+// than the -1 or 0 that the SPR would otherwise report, as is GEOM_AREA.
+
+type SPRSchema struct{}
+
+func NewSPRSchema() Schema {
+	s := SPRSchema{}
+	return &s
+}
+
+func (s *SPRSchema) Fields() []SchemaField {
+
+	return []SchemaField{
+		SchemaField{Name: "ID", Property: "wof:id", Type: FIELD_NUMBER, Size: 19},
+		SchemaField{Name: "PARENT_ID", Property: "wof:parent_id", Type: FIELD_NUMBER, Size: 19},
+		SchemaField{Name: "NAME", Property: "wof:name", Type: FIELD_STRING, Size: 254},
+		SchemaField{Name: "PLACETYPE", Property: "wof:placetype", Type: FIELD_STRING, Size: 32},
+		SchemaField{Name: "COUNTRY", Property: "wof:country", Type: FIELD_STRING, Size: 8},
+		SchemaField{Name: "REPO", Property: "wof:repo", Type: FIELD_STRING, Size: 64},
+		SchemaField{Name: "PATH", Type: FIELD_STRING, Size: 64},
+		SchemaField{Name: "URI", Type: FIELD_STRING, Size: 128},
+		SchemaField{Name: "LAT", Property: "mz:latitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "LON", Property: "mz:longitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "MIN_LAT", Property: "mz:min_latitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "MIN_LON", Property: "mz:min_longitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "MAX_LAT", Property: "mz:max_latitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "MAX_LON", Property: "mz:max_longitude", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		SchemaField{Name: "IS_CURRENT", Property: "mz:is_current", Type: FIELD_LOGICAL},
+		SchemaField{Name: "IS_DEPREC", Property: "edtf:deprecated", Type: FIELD_LOGICAL},
+		SchemaField{Name: "IS_CEASED", Property: "edtf:cessation", Type: FIELD_LOGICAL},
+		SchemaField{Name: "IS_SUPERSD", Type: FIELD_LOGICAL},
+		SchemaField{Name: "IS_SUPSING", Type: FIELD_LOGICAL},
+		SchemaField{Name: "SUPER_BY", Property: "wof:superseded_by", Type: FIELD_STRING, Size: 254},
+		SchemaField{Name: "SUPERSEDES", Property: "wof:supersedes", Type: FIELD_STRING, Size: 254},
+		SchemaField{Name: "LASTMOD", Property: "wof:lastmodified", Type: FIELD_NUMBER, Size: 12},
+		SchemaField{Name: "GEOM_AREA", Property: "geom:area", Type: FIELD_FLOAT, Size: 19, Precision: 10},
+	}
+}
+
+func (s *SPRSchema) Row(f geojson.Feature) ([]interface{}, error) {
+
+	spr, err := f.SPR()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the WOF SPR's MaxLatitude returns the centroid's latitude so the
+	// bounding box is read from the feature instead
+
+	bboxes, err := f.BoundingBoxes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	mbr := bboxes.MBR()
+
+	row := []interface{}{
+		idValue(spr.Id()),
+		idValue(stringProperty(f, "wof:parent_id")),
+		spr.Name(),
+		spr.Placetype(),
+		spr.Country(),
+		spr.Repo(),
+		spr.Path(),
+		spr.URI(),
+		spr.Latitude(),
+		spr.Longitude(),
+		mbr.Min.Y,
+		mbr.Min.X,
+		mbr.Max.Y,
+		mbr.Max.X,
+		flagValue(spr.IsCurrent().Flag()),
+		flagValue(spr.IsDeprecated().Flag()),
+		flagValue(spr.IsCeased().Flag()),
+		flagValue(spr.IsSuperseded().Flag()),
+		flagValue(spr.IsSuperseding().Flag()),
+		joinIds(spr.SupersededBy()),
+		joinIds(spr.Supersedes()),
+		idValue(stringProperty(f, "wof:lastmodified")),
+		floatProperty(f, "properties.geom:area"),
+	}
+
+	return row, nil
+}
+
+// idValue returns str_id as an integer or nil if it isn't one.
+
+func idValue(str_id string) interface{} {
+
+	id, err := strconv.ParseInt(str_id, 10, 64)
+
+	if err != nil {
+		return nil
+	}
+
+	return id
+}
+
+// stringProperty returns the (WOF) property of f as a string or an empty
+// string if it is missing.
+
+func stringProperty(f geojson.Feature, property string) string {
+	return gjson.GetBytes(f.Bytes(), "properties."+property).String()
+}
+
+// flagValue returns the logical value of an existential flag or nil if the
+// flag is unknown (-1).
+
+func flagValue(flag int64) interface{} {
+
+	switch flag {
+	case 1:
+		return true
+	case 0:
+		return false
+	default:
+		return nil
+	}
+}
+
+func joinIds(ids []int64) string {
+
+	str_ids := make([]string, len(ids))
+
+	for i, id := range ids {
+		str_ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	return strings.Join(str_ids, ",")
+}
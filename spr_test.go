@@ -0,0 +1,196 @@
+package shapefile
+
+import (
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"testing"
+)
+
+func TestSPRSchemaFields(t *testing.T) {
+
+	expected := []SchemaField{
+		{Name: "ID", Type: FIELD_NUMBER, Size: 19},
+		{Name: "PARENT_ID", Type: FIELD_NUMBER, Size: 19},
+		{Name: "NAME", Type: FIELD_STRING, Size: 254},
+		{Name: "PLACETYPE", Type: FIELD_STRING, Size: 32},
+		{Name: "COUNTRY", Type: FIELD_STRING, Size: 8},
+		{Name: "REPO", Type: FIELD_STRING, Size: 64},
+		{Name: "PATH", Type: FIELD_STRING, Size: 64},
+		{Name: "URI", Type: FIELD_STRING, Size: 128},
+		{Name: "LAT", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "LON", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "MIN_LAT", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "MIN_LON", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "MAX_LAT", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "MAX_LON", Type: FIELD_FLOAT, Size: 19, Precision: 8},
+		{Name: "IS_CURRENT", Type: FIELD_LOGICAL},
+		{Name: "IS_DEPREC", Type: FIELD_LOGICAL},
+		{Name: "IS_CEASED", Type: FIELD_LOGICAL},
+		{Name: "IS_SUPERSD", Type: FIELD_LOGICAL},
+		{Name: "IS_SUPSING", Type: FIELD_LOGICAL},
+		{Name: "SUPER_BY", Type: FIELD_STRING, Size: 254},
+		{Name: "SUPERSEDES", Type: FIELD_STRING, Size: 254},
+		{Name: "LASTMOD", Type: FIELD_NUMBER, Size: 12},
+		{Name: "GEOM_AREA", Type: FIELD_FLOAT, Size: 19, Precision: 10},
+	}
+
+	fields := NewSPRSchema().Fields()
+
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields but got %d", len(expected), len(fields))
+	}
+
+	for i, field := range fields {
+
+		e := expected[i]
+
+		if field.Name != e.Name || field.Type != e.Type || field.Size != e.Size || field.Precision != e.Precision {
+			t.Errorf("field %d: expected %s (%c %d.%d) but got %s (%c %d.%d)", i, e.Name, e.Type, e.Size, e.Precision, field.Name, field.Type, field.Size, field.Precision)
+		}
+	}
+
+	_, err := dbfFields(fields)
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSPRSchemaRow(t *testing.T) {
+
+	required := `"wof:id":101736545,"wof:name":"Montréal","wof:placetype":"locality","wof:repo":"whosonfirst-data-admin-ca","geom:latitude":45.5,"geom:longitude":-73.6,"geom:bbox":"-73.9,45.4,-73.4,45.7"`
+	geometry := `{"type":"Polygon","coordinates":[[[-73.9,45.4],[-73.4,45.4],[-73.4,45.7],[-73.9,45.7],[-73.9,45.4]]]}`
+
+	tests := []struct {
+		label    string
+		props    string
+		expected []interface{}
+	}{
+		{
+			label: "full",
+			props: `"wof:parent_id":85874359,"wof:country":"CA","lbl:latitude":45.51,"lbl:longitude":-73.58,"mz:is_current":1,"edtf:cessation":"","wof:superseded_by":[],"wof:supersedes":[1,2],"wof:lastmodified":1566000000,"geom:area":0.0512345`,
+			expected: []interface{}{
+				int64(101736545),
+				int64(85874359),
+				"Montréal",
+				"locality",
+				"CA",
+				"whosonfirst-data-admin-ca",
+				"101/736/545/101736545.geojson",
+				"https://data.whosonfirst.org/101/736/545/101736545.geojson",
+				45.51,
+				-73.58,
+				45.4,
+				-73.9,
+				45.7,
+				-73.4,
+				true,
+				false,
+				false,
+				false,
+				true,
+				"",
+				"1,2",
+				int64(1566000000),
+				0.0512345,
+			},
+		},
+		{
+			// SPR defaults, other than PARENT_ID and LASTMOD which are
+			// null rather than -1, and the geom: centroid; superseded
+			// features aren't current
+			label: "missing",
+			props: `"wof:superseded_by":[3]`,
+			expected: []interface{}{
+				int64(101736545),
+				nil,
+				"Montréal",
+				"locality",
+				"XX",
+				"whosonfirst-data-admin-ca",
+				"101/736/545/101736545.geojson",
+				"https://data.whosonfirst.org/101/736/545/101736545.geojson",
+				45.5,
+				-73.6,
+				45.4,
+				-73.9,
+				45.7,
+				-73.4,
+				false,
+				false,
+				nil,
+				true,
+				false,
+				"3",
+				"",
+				nil,
+				nil,
+			},
+		},
+		{
+			label: "non-numeric",
+			props: `"wof:parent_id":"unknown","wof:lastmodified":"yesterday","mz:is_current":0,"edtf:deprecated":"2019-01-01","edtf:cessation":"2018-12-31","geom:area":"big"`,
+			expected: []interface{}{
+				int64(101736545),
+				nil,
+				"Montréal",
+				"locality",
+				"XX",
+				"whosonfirst-data-admin-ca",
+				"101/736/545/101736545.geojson",
+				"https://data.whosonfirst.org/101/736/545/101736545.geojson",
+				45.5,
+				-73.6,
+				45.4,
+				-73.9,
+				45.7,
+				-73.4,
+				false,
+				true,
+				true,
+				false,
+				false,
+				"",
+				"",
+				nil,
+				nil,
+			},
+		},
+	}
+
+	s := NewSPRSchema()
+	fields := s.Fields()
+
+	for _, test := range tests {
+
+		f, err := feature.NewWOFFeature([]byte(`{"type":"Feature","properties":{` + required + `,` + test.props + `},"geometry":` + geometry + `}`))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row, err := s.Row(f)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		if len(row) != len(fields) {
+			t.Errorf("%s: expected %d values but got %d", test.label, len(fields), len(row))
+			continue
+		}
+
+		for i, v := range row {
+
+			if v != test.expected[i] {
+				t.Errorf("%s: expected %s to be %v (%T) but got %v (%T)", test.label, fields[i].Name, test.expected[i], test.expected[i], v, v)
+			}
+
+			_, err := fields[i].DBFValue(v)
+
+			if err != nil {
+				t.Errorf("%s: %s", test.label, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The name of the DBF field used to record the repairs made to a feature's
+// geometry when WriterOptions.RecordRepairs is true.
+
+const REPAIRS_FIELD = "REPAIRS"
+
+// Validation policies. "none" writes shapes as-is. "repair" fixes the
+// problems that can be fixed (see the REPAIR_ constants below) and rejects
+// shapes with problems that can't, like NaN coordinates or polygon rings that
+// cross one another. "reject" rejects any shape that would need repairing.
+
+const (
+	VALIDATION_NONE   = "none"
+	VALIDATION_REPAIR = "repair"
+	VALIDATION_REJECT = "reject"
+)
+
+// The repairs that can be made to a shape. These are the values recorded in
+// ShapeReport.Repairs.
+
+const (
+	REPAIR_CLOSED_RING     = "closed_ring"
+	REPAIR_REPEATED_POINTS = "repeated_points"
+	REPAIR_DROPPED_PART    = "dropped_part"
+	REPAIR_ORIENTATION     = "orientation"
+	REPAIR_SPLIT_BOWTIE    = "split_bowtie"
+)
+
+func ValidationPolicies() []string {
+
+	return []string{
+		VALIDATION_NONE,
+		VALIDATION_REJECT,
+		VALIDATION_REPAIR,
+	}
+}
+
+func IsValidValidationPolicy(test string) bool {
+
+	valid := false
+
+	for _, policy := range ValidationPolicies() {
+
+		if policy == test {
+			valid = true
+			break
+		}
+	}
+
+	return valid
+}
+
+// ValidateShape checks that s can be read by other applications (notably
+// ArcGIS) and returns a repaired copy of s, according to policy, along with
+// the list of repairs that were made. If s can not be repaired, or policy is
+// "reject" and s would need to be repaired, an error is returned.
+
+func ValidateShape(s shp.Shape, policy string) (shp.Shape, []string, error) {
+
+	repairs := make([]string, 0)
+
+	if policy == VALIDATION_NONE {
+		return s, repairs, nil
+	}
+
+	if !IsValidValidationPolicy(policy) {
+		return nil, repairs, errors.New("Invalid validation policy")
+	}
+
+	v := validator{
+		repairs: repairs,
+	}
+
+	var repaired shp.Shape
+	var err error
+
+	switch shape := s.(type) {
+
+	case *shp.Point:
+
+		err = checkCoordinates([]shp.Point{*shape})
+		repaired = s
+
+	case *shp.MultiPoint:
+
+		err = checkCoordinates(shape.Points)
+		repaired = s
+
+	case *shp.PolyLine:
+
+		err = checkCoordinates(shape.Points)
+
+		if err == nil {
+			repaired, err = v.validatePolyLine(shape)
+		}
+
+	case *shp.Polygon:
+
+		err = checkCoordinates(shape.Points)
+
+		if err == nil {
+			repaired, err = v.validatePolygon(shape)
+		}
+
+	default:
+		err = errors.New("Unsupported shape type")
+	}
+
+	if err != nil {
+		return nil, v.repairs, err
+	}
+
+	if len(v.repairs) == 0 {
+		return s, v.repairs, nil
+	}
+
+	if policy == VALIDATION_REJECT {
+		msg := fmt.Sprintf("Invalid geometry, needs the following repairs: %s", strings.Join(v.repairs, ","))
+		return nil, v.repairs, errors.New(msg)
+	}
+
+	return repaired, v.repairs, nil
+}
+
+type validator struct {
+	repairs []string
+}
+
+func (v *validator) repaired(repair string) {
+
+	for _, r := range v.repairs {
+
+		if r == repair {
+			return
+		}
+	}
+
+	v.repairs = append(v.repairs, repair)
+}
+
+func checkCoordinates(pts []shp.Point) error {
+
+	for _, pt := range pts {
+
+		if math.IsNaN(pt.X) || math.IsNaN(pt.Y) || math.IsInf(pt.X, 0) || math.IsInf(pt.Y, 0) {
+			return errors.New("Invalid geometry, coordinates contain NaN or infinite values")
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validatePolyLine(shape *shp.PolyLine) (shp.Shape, error) {
+
+	lines := make([][]shp.Point, 0)
+
+	for _, line := range shapeParts(shape.Parts, shape.Points) {
+
+		deduped := dedupePoints(line)
+
+		if len(deduped) != len(line) {
+			v.repaired(REPAIR_REPEATED_POINTS)
+		}
+
+		if len(deduped) < 2 {
+			v.repaired(REPAIR_DROPPED_PART)
+			continue
+		}
+
+		lines = append(lines, deduped)
+	}
+
+	if len(lines) == 0 {
+		return nil, errors.New("Invalid geometry, polyline has no parts with two or more distinct points")
+	}
+
+	return shp.NewPolyLine(lines), nil
+}
+
+func (v *validator) validatePolygon(shape *shp.Polygon) (shp.Shape, error) {
+
+	rings := make([][]shp.Point, 0)
+
+	for _, ring := range shapeParts(shape.Parts, shape.Points) {
+
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			v.repaired(REPAIR_CLOSED_RING)
+			ring = closeRing(ring)
+		}
+
+		deduped := dedupePoints(ring)
+
+		if len(deduped) != len(ring) {
+			v.repaired(REPAIR_REPEATED_POINTS)
+		}
+
+		// don't check the area yet since a symmetrical bow-tie has
+		// none until it is split
+
+		if len(deduped) < 4 {
+			v.repaired(REPAIR_DROPPED_PART)
+			continue
+		}
+
+		split := splitSelfIntersections(deduped)
+
+		if len(split) != 1 {
+			v.repaired(REPAIR_SPLIT_BOWTIE)
+		}
+
+		for _, r := range split {
+
+			if len(r) < 4 || ringArea(r) == 0.0 {
+				v.repaired(REPAIR_DROPPED_PART)
+				continue
+			}
+
+			rings = append(rings, r)
+		}
+	}
+
+	if len(rings) == 0 {
+		return nil, errors.New("Invalid geometry, polygon has no valid rings")
+	}
+
+	if ringsCross(rings) {
+		return nil, errors.New("Invalid geometry, polygon rings intersect one another")
+	}
+
+	return newPolygon(v.orderRings(rings)), nil
+}
+
+// orderRings works out which rings are shells and which are holes based on
+// how deeply they are nested inside other rings, makes sure that shells are
+// clockwise and holes are counter-clockwise and returns them with each shell
+// followed by its holes.
+
+func (v *validator) orderRings(rings [][]shp.Point) [][]shp.Point {
+
+	count := len(rings)
+
+	depth := make([]int, count)
+	parent := make([]int, count)
+	areas := make([]float64, count)
+
+	for i, ring := range rings {
+		areas[i] = math.Abs(ringArea(ring))
+	}
+
+	for i, ring := range rings {
+
+		parent[i] = -1
+
+		// the middle of the first edge is less likely to be shared
+		// with another ring than a vertex is
+
+		test := shp.Point{
+			X: (ring[0].X + ring[1].X) / 2.0,
+			Y: (ring[0].Y + ring[1].Y) / 2.0,
+		}
+
+		for j, other := range rings {
+
+			if i == j || !pointInRing(test, other) {
+				continue
+			}
+
+			depth[i] += 1
+
+			if parent[i] == -1 || areas[j] < areas[parent[i]] {
+				parent[i] = j
+			}
+		}
+	}
+
+	ordered := make([][]shp.Point, 0)
+
+	for i, ring := range rings {
+
+		if depth[i]%2 != 0 {
+			continue
+		}
+
+		if !isClockwise(ring) {
+			v.repaired(REPAIR_ORIENTATION)
+			ring = reverseRing(ring)
+		}
+
+		ordered = append(ordered, ring)
+
+		for j, hole := range rings {
+
+			if depth[j]%2 == 0 || parent[j] != i {
+				continue
+			}
+
+			if isClockwise(hole) {
+				v.repaired(REPAIR_ORIENTATION)
+				hole = reverseRing(hole)
+			}
+
+			ordered = append(ordered, hole)
+		}
+	}
+
+	return ordered
+}
+
+// splitSelfIntersections splits a (closed) ring that crosses itself, like a
+// bow-tie, in to two or more rings that don't.
+
+func splitSelfIntersections(ring []shp.Point) [][]shp.Point {
+
+	done := make([][]shp.Point, 0)
+	todo := [][]shp.Point{ring}
+
+	// this should never happen but just in case rounding errors
+	// conspire to keep finding the same intersection...
+
+	max_splits := len(ring)
+	splits := 0
+
+	for len(todo) > 0 {
+
+		r := todo[len(todo)-1]
+		todo = todo[0 : len(todo)-1]
+
+		if splits >= max_splits {
+			done = append(done, r)
+			continue
+		}
+
+		c, ok := findCrossing([][]shp.Point{r}, true)
+
+		if !ok {
+			done = append(done, r)
+			continue
+		}
+
+		splits += 1
+
+		i := c.edge_a
+		j := c.edge_b
+		n := len(r)
+
+		a := []shp.Point{c.pt}
+		a = append(a, r[i+1:j+1]...)
+		a = append(a, c.pt)
+
+		b := []shp.Point{c.pt}
+		b = append(b, r[j+1:n-1]...)
+		b = append(b, r[0:i+1]...)
+		b = append(b, c.pt)
+
+		for _, part := range [][]shp.Point{a, b} {
+
+			part = dedupePoints(part)
+
+			if len(part) >= 4 && ringArea(part) != 0.0 {
+				todo = append(todo, part)
+			}
+		}
+	}
+
+	return done
+}
+
+func ringsCross(rings [][]shp.Point) bool {
+
+	_, ok := findCrossing(rings, false)
+	return ok
+}
+
+type validationEdge struct {
+	ring int
+	idx  int
+	a    shp.Point
+	b    shp.Point
+	minx float64
+	maxx float64
+}
+
+type crossing struct {
+	edge_a int
+	edge_b int
+	pt     shp.Point
+}
+
+// findCrossing returns the first place where the edges of rings cross (rather
+// than touch). If same_ring is true only edges belonging to the same ring
+// are compared, otherwise only edges belonging to different rings are. Edges
+// are sorted by their minimum X coordinate so that only edges whose extents
+// overlap need to be compared.
+
+func findCrossing(rings [][]shp.Point, same_ring bool) (crossing, bool) {
+
+	edges := make([]validationEdge, 0)
+
+	for r, ring := range rings {
+
+		for i := 0; i < len(ring)-1; i++ {
+
+			a := ring[i]
+			b := ring[i+1]
+
+			e := validationEdge{
+				ring: r,
+				idx:  i,
+				a:    a,
+				b:    b,
+				minx: math.Min(a.X, b.X),
+				maxx: math.Max(a.X, b.X),
+			}
+
+			edges = append(edges, e)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].minx < edges[j].minx
+	})
+
+	for i, e1 := range edges {
+
+		for _, e2 := range edges[i+1:] {
+
+			if e2.minx > e1.maxx {
+				break
+			}
+
+			if (e1.ring == e2.ring) != same_ring {
+				continue
+			}
+
+			// adjacent edges always share a vertex
+
+			if same_ring {
+
+				last := len(rings[e1.ring]) - 2
+				d := e1.idx - e2.idx
+
+				if d == 1 || d == -1 || (e1.idx == 0 && e2.idx == last) || (e2.idx == 0 && e1.idx == last) {
+					continue
+				}
+			}
+
+			t, _, ok, _ := segmentIntersection(e1.a, e1.b, e2.a, e2.b)
+
+			if !ok {
+				continue
+			}
+
+			pt := shp.Point{
+				X: e1.a.X + t*(e1.b.X-e1.a.X),
+				Y: e1.a.Y + t*(e1.b.Y-e1.a.Y),
+			}
+
+			c := crossing{
+				edge_a: e1.idx,
+				edge_b: e2.idx,
+				pt:     pt,
+			}
+
+			if c.edge_a > c.edge_b {
+				c.edge_a, c.edge_b = c.edge_b, c.edge_a
+			}
+
+			return c, true
+		}
+	}
+
+	return crossing{}, false
+}
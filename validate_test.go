@@ -0,0 +1,347 @@
+package shapefile
+
+import (
+	"fmt"
+	"github.com/jonas-p/go-shp"
+	"github.com/whosonfirst/go-whosonfirst-geojson-v2/feature"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateShapePolygon(t *testing.T) {
+
+	tests := []struct {
+		label   string
+		rings   [][]shp.Point
+		repairs []string
+		parts   int
+		area    float64
+	}{
+		{
+			label: "valid",
+			rings: [][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0)},
+			parts: 1,
+			area:  100.0,
+		},
+		{
+			label:   "unclosed ring",
+			rings:   [][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0)},
+			repairs: []string{REPAIR_CLOSED_RING},
+			parts:   1,
+			area:    100.0,
+		},
+		{
+			label:   "duplicate vertex",
+			rings:   [][]shp.Point{testRing(0, 0, 0, 10, 0, 10, 10, 10, 10, 0, 0, 0)},
+			repairs: []string{REPAIR_REPEATED_POINTS},
+			parts:   1,
+			area:    100.0,
+		},
+		{
+			label:   "counter-clockwise shell",
+			rings:   [][]shp.Point{testRing(0, 0, 10, 0, 10, 10, 0, 10, 0, 0)},
+			repairs: []string{REPAIR_ORIENTATION},
+			parts:   1,
+			area:    100.0,
+		},
+		{
+			// the two halves of a bow-tie are wound in opposite directions
+
+			label:   "bow-tie",
+			rings:   [][]shp.Point{testRing(0, 0, 10, 10, 10, 0, 0, 10, 0, 0)},
+			repairs: []string{REPAIR_SPLIT_BOWTIE, REPAIR_ORIENTATION},
+			parts:   2,
+			area:    50.0,
+		},
+		{
+			label:   "too few points",
+			rings:   [][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0), testRing(20, 20, 20, 30, 20, 20)},
+			repairs: []string{REPAIR_DROPPED_PART},
+			parts:   1,
+			area:    100.0,
+		},
+		{
+			label:   "collapsed ring",
+			rings:   [][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0), testRing(20, 20, 20, 30, 20, 40, 20, 20)},
+			repairs: []string{REPAIR_DROPPED_PART},
+			parts:   1,
+			area:    100.0,
+		},
+		{
+			// an island inside a hole, listed before its shell
+
+			label:   "nested rings",
+			rings:   [][]shp.Point{testRing(4, 4, 4, 6, 6, 6, 6, 4, 4, 4), testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0), testRing(2, 2, 8, 2, 8, 8, 2, 8, 2, 2)},
+			repairs: []string{},
+			parts:   3,
+			area:    100.0 - 36.0 + 4.0,
+		},
+		{
+			label:   "hole with the wrong orientation",
+			rings:   [][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0), testRing(2, 2, 2, 8, 8, 8, 8, 2, 2, 2)},
+			repairs: []string{REPAIR_ORIENTATION},
+			parts:   2,
+			area:    100.0 - 36.0,
+		},
+	}
+
+	for _, test := range tests {
+
+		s, repairs, err := ValidateShape(newPolygon(test.rings), VALIDATION_REPAIR)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.label, err)
+			continue
+		}
+
+		if strings.Join(repairs, ",") != strings.Join(test.repairs, ",") {
+			t.Errorf("%s: expected repairs '%s' but got '%s'", test.label, strings.Join(test.repairs, ","), strings.Join(repairs, ","))
+		}
+
+		poly := s.(*shp.Polygon)
+
+		if int(poly.NumParts) != test.parts {
+			t.Errorf("%s: expected %d parts but got %d", test.label, test.parts, poly.NumParts)
+		}
+
+		// shells are clockwise and holes counter-clockwise so this
+		// is only right if the rings were oriented properly
+
+		area := shapeArea(s)
+
+		if math.Abs(area-test.area) > 1e-9 {
+			t.Errorf("%s: expected an area of %f but got %f", test.label, test.area, area)
+		}
+
+		for i, ring := range groupRings(shapeParts(poly.Parts, poly.Points)) {
+
+			if !isClockwise(ring[0]) {
+				t.Errorf("%s: shell %d is not clockwise", test.label, i)
+			}
+
+			for _, hole := range ring[1:] {
+
+				if isClockwise(hole) {
+					t.Errorf("%s: hole in shell %d is not counter-clockwise", test.label, i)
+				}
+			}
+		}
+
+		// and the result should be valid as-is
+
+		_, repairs, err = ValidateShape(s, VALIDATION_REJECT)
+
+		if err != nil {
+			t.Errorf("%s: repaired shape is still invalid, %s", test.label, err)
+		}
+	}
+}
+
+func TestValidateShapeInvalid(t *testing.T) {
+
+	nan := math.NaN()
+
+	tests := map[string]shp.Shape{
+		"NaN polygon":        newPolygon([][]shp.Point{testRing(0, 0, 0, nan, 10, 10, 10, 0, 0, 0)}),
+		"NaN point":          &shp.Point{X: nan, Y: 0},
+		"infinite line":      shp.NewPolyLine([][]shp.Point{testRing(0, 0, math.Inf(1), 10)}),
+		"rings cross":        newPolygon([][]shp.Point{testRing(0, 0, 0, 10, 10, 10, 10, 0, 0, 0), testRing(5, 5, 5, 15, 15, 15, 15, 5, 5, 5)}),
+		"no valid rings":     newPolygon([][]shp.Point{testRing(0, 0, 0, 10, 0, 0)}),
+		"no valid line part": shp.NewPolyLine([][]shp.Point{testRing(1, 1, 1, 1)}),
+	}
+
+	for label, s := range tests {
+
+		for _, policy := range []string{VALIDATION_REPAIR, VALIDATION_REJECT} {
+
+			_, _, err := ValidateShape(s, policy)
+
+			if err == nil {
+				t.Errorf("%s: expected %s policy to return an error", label, policy)
+			}
+		}
+	}
+}
+
+func TestValidateShapeReject(t *testing.T) {
+
+	bowtie := newPolygon([][]shp.Point{testRing(0, 0, 10, 10, 10, 0, 0, 10, 0, 0)})
+
+	_, repairs, err := ValidateShape(bowtie, VALIDATION_REJECT)
+
+	if err == nil {
+		t.Fatal("expected reject policy to return an error")
+	}
+
+	if len(repairs) == 0 || repairs[0] != REPAIR_SPLIT_BOWTIE {
+		t.Errorf("expected repairs to be reported, got %v", repairs)
+	}
+
+	out, repairs, err := ValidateShape(bowtie, VALIDATION_NONE)
+
+	if err != nil || len(repairs) != 0 || out != bowtie {
+		t.Errorf("expected none policy to leave the shape as-is")
+	}
+}
+
+func TestValidateShapePolyLine(t *testing.T) {
+
+	line := shp.NewPolyLine([][]shp.Point{testRing(0, 0, 0, 0, 5, 5, 10, 10), testRing(3, 3, 3, 3)})
+
+	s, repairs, err := ValidateShape(line, VALIDATION_REPAIR)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(repairs, ",") != REPAIR_REPEATED_POINTS+","+REPAIR_DROPPED_PART {
+		t.Errorf("unexpected repairs %v", repairs)
+	}
+
+	pl := s.(*shp.PolyLine)
+
+	if pl.NumParts != 1 || pl.NumPoints != 3 {
+		t.Errorf("expected 1 part with 3 points but got %d parts with %d points", pl.NumParts, pl.NumPoints)
+	}
+}
+
+func TestSplitSelfIntersections(t *testing.T) {
+
+	// a figure eight with two crossings
+
+	ring := testRing(0, 0, 0, 2, 4, 0, 8, 2, 8, 0, 4, 2, 0, 0)
+	rings := splitSelfIntersections(ring)
+
+	if len(rings) != 3 {
+		t.Fatalf("expected 3 rings but got %d", len(rings))
+	}
+
+	area := 0.0
+
+	for _, r := range rings {
+
+		if len(findCrossingsForTest(r)) > 0 {
+			t.Errorf("ring %v still crosses itself", r)
+		}
+
+		area += math.Abs(ringArea(r))
+	}
+
+	if math.Abs(area-8.0) > 1e-9 {
+		t.Errorf("expected a total area of 8 but got %f", area)
+	}
+}
+
+func findCrossingsForTest(ring []shp.Point) []crossing {
+
+	c, ok := findCrossing([][]shp.Point{ring}, true)
+
+	if !ok {
+		return nil
+	}
+
+	return []crossing{c}
+}
+
+func TestWriterRecordRepairs(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "repairs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	features := []string{
+		`{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[10,10],[0,10],[0,0]]]}}`,
+		`{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Polygon","coordinates":[[[0,0],[0,10],[10,10],[10,0],[0,0]]]}}`,
+	}
+
+	for _, record := range []bool{false, true} {
+
+		path := filepath.Join(root, fmt.Sprintf("%t.shp", record))
+
+		opts := NewDefaultWriterOptions()
+		opts.ShapeOptions.Validation = VALIDATION_REPAIR
+		opts.RecordRepairs = record
+
+		wr, err := NewWriterWithOptions(path, shp.POLYGON, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, body := range features {
+
+			f, err := feature.NewGeoJSONFeature([]byte(body))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = wr.AddFeature(f)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = wr.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rdr, err := shp.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		idx := -1
+
+		for i, field := range rdr.Fields() {
+
+			if field.String() == REPAIRS_FIELD {
+				idx = i
+			}
+		}
+
+		if !record {
+
+			if idx != -1 {
+				t.Error("expected no REPAIRS field by default")
+			}
+
+			rdr.Close()
+			continue
+		}
+
+		if idx == -1 {
+			rdr.Close()
+			t.Fatal("expected a REPAIRS field")
+		}
+
+		expected := []string{REPAIR_REPEATED_POINTS, ""}
+
+		for i, e := range expected {
+
+			v := rdr.ReadAttribute(i, idx)
+
+			if strings.Contains(v, "\x00") {
+				t.Errorf("record %d has NUL bytes in its REPAIRS field", i)
+			}
+
+			if strings.TrimSpace(v) != e {
+				t.Errorf("expected record %d to have repairs '%s' but got '%s'", i, e, v)
+			}
+		}
+
+		rdr.Close()
+	}
+}